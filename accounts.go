@@ -5,7 +5,6 @@ import (
 	"fmt"
 
 	"github.com/Seklfreak/nordigen-lunchmoney-sync/lunchmoney"
-	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
@@ -13,12 +12,31 @@ import (
 func printAccounts(
 	ctx context.Context,
 	nordigenRequisitionIDs []string,
-	nordigenClient *nordigen.Client,
+	nordigenClient nordigenAPI,
 	lunchmoneyClient *lunchmoney.Client,
 	log *zap.Logger,
 ) error {
+	// print the accounts of all requisitions if none are configured
+	if len(nordigenRequisitionIDs) == 0 {
+		requisitions, err := nordigenClient.ListAllRequisitions(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to list requisitions")
+		}
+
+		for _, requisition := range requisitions {
+			log.Info("nordigen requisition",
+				zap.String("id", requisition.ID),
+				zap.String("institution_id", requisition.InstitutionID),
+				zap.String("status", requisition.Status),
+				zap.Time("created", requisition.Created),
+			)
+
+			nordigenRequisitionIDs = append(nordigenRequisitionIDs, requisition.ID)
+		}
+	}
+
 	for _, nordigenRequisitionID := range nordigenRequisitionIDs {
-		nordigenAccountList, err := nordigenClient.ListAccounts(ctx, nordigenRequisitionID)
+		nordigenAccountList, err := nordigenClient.GetRequisition(ctx, nordigenRequisitionID)
 		if err != nil {
 			return errors.Wrapf(err, "failed to list accounts for requestion ID %q", nordigenRequisitionID)
 		}
@@ -48,8 +66,8 @@ func printAccounts(
 
 			for _, balance := range nordigenAccountBalances {
 				balances[balance.BalanceType] = fmt.Sprintf(
-					"%.2f %s",
-					balance.BalanceAmount.Amount,
+					"%s %s",
+					balance.BalanceAmount.Amount.Format(balance.BalanceAmount.Currency),
 					balance.BalanceAmount.Currency,
 				)
 			}
@@ -70,13 +88,18 @@ func printAccounts(
 	}
 
 	for _, account := range accounts {
+		var balance string
+		if account.Balance != nil {
+			balance = account.Balance.Format(account.Currency)
+		}
+
 		log.Info("lunchmoney account",
 			zap.Int("id", account.ID),
 			zap.String("name", account.Name),
 			zap.String("institution_name", account.InstitutionName),
 			zap.String("type", account.TypeName),
 			zap.String("subtype", account.SubtypeName),
-			zap.Float64("balance", float64(*account.Balance)),
+			zap.String("balance", balance),
 			zap.String("currency", account.Currency),
 		)
 	}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen/nordigentest"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestPrintAccounts(t *testing.T) {
+	ctx := context.Background()
+	servers := newTestServers(t)
+
+	servers.nordigen.SetAccount(testAccountID, &nordigentest.Account{
+		Details: &nordigen.Account{Name: "Checking", Product: "Giro", Status: "enabled"},
+		Balances: []*nordigentest.Balance{
+			{Amount: "42.00", Currency: "EUR", Type: "expected"},
+		},
+	})
+	servers.nordigen.SetAccount("account-2", &nordigentest.Account{
+		Details: &nordigen.Account{Name: "Savings"},
+	})
+	servers.nordigen.AddRequisition(&nordigen.Requisition{
+		Status:   nordigen.RequisitionStatusLinked,
+		Accounts: []string{testAccountID, "account-2"},
+	})
+
+	// the details of the second account cannot be fetched
+	servers.nordigen.Fail("/accounts/account-2/", http.StatusInternalServerError, 1)
+
+	core, logs := observer.New(zap.DebugLevel)
+
+	err := printAccounts(ctx, nil, servers.nordigenClient, servers.lunchmoneyClient, zap.New(core))
+	if err != nil {
+		t.Fatalf("failed to print accounts: %v", err)
+	}
+
+	if entries := logs.FilterMessage("nordigen requisition").All(); len(entries) != 1 {
+		t.Errorf("expected 1 requisition, got %d", len(entries))
+	}
+
+	accounts := logs.FilterMessage("nordigen account").All()
+	if len(accounts) != 1 {
+		t.Fatalf("expected 1 Nordigen account, got %d", len(accounts))
+	}
+
+	fields := accounts[0].ContextMap()
+	if fields["id"] != testAccountID || fields["name"] != "Checking" || fields["product"] != "Giro" {
+		t.Errorf("unexpected Nordigen account: %v", fields)
+	}
+
+	if balances, _ := fields["balances"].(map[string]string); balances["expected"] != "42.00 EUR" {
+		t.Errorf("unexpected balances: %v", fields["balances"])
+	}
+
+	if entries := logs.FilterMessage("failed to fetch account details for account ID").All(); len(entries) != 1 {
+		t.Errorf("expected a warning for the second account, got %d", len(entries))
+	}
+
+	lunchmoneyAccounts := logs.FilterMessage("lunchmoney account").All()
+	if len(lunchmoneyAccounts) != 1 || lunchmoneyAccounts[0].ContextMap()["id"] != int64(servers.asset.ID) {
+		t.Fatalf("expected the Lunchmoney asset to be printed, got %v", lunchmoneyAccounts)
+	}
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"time"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/rules"
+	"github.com/kelseyhightower/envconfig"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+// config is the configuration of the sync.
+// It is read from the optional config file first, environment variables take precedence.
+type config struct {
+	Nordigen               *nordigen.Config `envconfig:"NORDIGEN" yaml:"nordigen"`
+	NordigenRequisitionIDs []string         `envconfig:"NORDIGEN_REQUISITION_IDS" yaml:"nordigen_requisition_ids"`
+	NordigenBaseURL        string           `envconfig:"NORDIGEN_BASE_URL" yaml:"nordigen_base_url"`
+	NordigenSpreadRequests bool             `envconfig:"NORDIGEN_SPREAD_REQUESTS" yaml:"nordigen_spread_requests"`
+
+	NordigenCacheDir         string        `envconfig:"NORDIGEN_CACHE_DIR" yaml:"nordigen_cache_dir"`
+	NordigenCacheDetailsTTL  time.Duration `envconfig:"NORDIGEN_CACHE_DETAILS_TTL" yaml:"nordigen_cache_details_ttl"`
+	NordigenCacheBalancesTTL time.Duration `envconfig:"NORDIGEN_CACHE_BALANCES_TTL" yaml:"nordigen_cache_balances_ttl"`
+	NordigenCacheBypass      bool          `envconfig:"NORDIGEN_CACHE_BYPASS" yaml:"nordigen_cache_bypass"`
+
+	LunchmoneyAccessToken string `envconfig:"LUNCHMONEY_ACCESS_TOKEN" yaml:"lunchmoney_access_token"`
+	LunchmoneyBaseURL     string `envconfig:"LUNCHMONEY_BASE_URL" yaml:"lunchmoney_base_url"`
+
+	TransactionsMap map[string]int   `envconfig:"TRANSACTIONS_MAP" yaml:"-"` // map[nordigenAccountID]lunchmoneyAssetID
+	BalancesMap     map[string]int   `envconfig:"BALANCES_MAP" yaml:"-"`     // map[nordigenAccountID]lunchmoneyAssetID
+	Accounts        []*accountConfig `ignored:"true" yaml:"accounts"`
+
+	StateFile string `envconfig:"STATE_FILE" yaml:"state_file"`
+
+	SyncStartDate    string `envconfig:"SYNC_START_DATE" yaml:"sync_start_date"` // YYYY-MM-DD
+	SyncEndDate      string `envconfig:"SYNC_END_DATE" yaml:"sync_end_date"`     // YYYY-MM-DD
+	SyncLookbackDays int    `envconfig:"SYNC_LOOKBACK_DAYS" yaml:"sync_lookback_days"`
+	SyncPending      bool   `envconfig:"SYNC_PENDING" yaml:"sync_pending"`
+	SyncUpdates      bool   `envconfig:"SYNC_UPDATES" yaml:"sync_updates"`
+	SyncRemoved      string `envconfig:"SYNC_REMOVED" yaml:"sync_removed"` // report, tag or delete
+
+	RulesFile           string        `envconfig:"RULES_FILE" yaml:"rules_file"`
+	Rules               []*rules.Rule `ignored:"true" yaml:"rules"`
+	DisableDefaultRules bool          `envconfig:"DISABLE_DEFAULT_RULES" yaml:"disable_default_rules"`
+
+	DetectTransfers   bool   `envconfig:"DETECT_TRANSFERS" yaml:"detect_transfers"`
+	TransfersTag      string `envconfig:"TRANSFERS_TAG" yaml:"transfers_tag"`
+	TransfersCategory string `envconfig:"TRANSFERS_CATEGORY" yaml:"transfers_category"`
+	TransfersGroup    bool   `envconfig:"TRANSFERS_GROUP" yaml:"transfers_group"`
+
+	DryRun       bool   `envconfig:"DRY_RUN" yaml:"dry_run"`
+	DryRunFormat string `envconfig:"DRY_RUN_FORMAT" yaml:"dry_run_format"` // table or json
+
+	ExpiryWarningDays []int  `envconfig:"EXPIRY_WARNING_DAYS" yaml:"expiry_warning_days"`
+	ReauthLinks       bool   `envconfig:"REAUTH_LINKS" yaml:"reauth_links"`
+	ReauthRedirect    string `envconfig:"REAUTH_REDIRECT" yaml:"reauth_redirect"`
+
+	ScheduleInterval time.Duration `envconfig:"SCHEDULE_INTERVAL" yaml:"schedule_interval"`
+	ScheduleCron     string        `envconfig:"SCHEDULE_CRON" yaml:"schedule_cron"`
+	ScheduleJitter   time.Duration `envconfig:"SCHEDULE_JITTER" yaml:"schedule_jitter"`
+
+	Debug bool `envconfig:"DEBUG" yaml:"debug"`
+
+	ruleSet *rules.RuleSet
+}
+
+// accountConfig configures the sync of a single Nordigen account to a Lunchmoney asset.
+type accountConfig struct {
+	Name              string `yaml:"name"`
+	NordigenAccountID string `yaml:"nordigen_account_id"`
+	LunchmoneyAssetID int    `yaml:"lunchmoney_asset_id"`
+
+	Transactions bool `yaml:"transactions"`
+	Balance      bool `yaml:"balance"`
+
+	// optional settings overriding the global settings for this account
+	SyncStartDate    *string `yaml:"sync_start_date"`
+	SyncEndDate      *string `yaml:"sync_end_date"`
+	SyncLookbackDays *int    `yaml:"sync_lookback_days"`
+	SyncPending      *bool   `yaml:"sync_pending"`
+	SyncUpdates      *bool   `yaml:"sync_updates"`
+	SyncRemoved      *string `yaml:"sync_removed"`
+
+	opts *syncOptions
+}
+
+// loadConfig reads the config file set via CONFIG_FILE if any and applies the environment variables.
+func loadConfig() (*config, error) {
+	var cfg config
+
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to read config file")
+		}
+
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+
+		err = decoder.Decode(&cfg)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to decode config file")
+		}
+	}
+
+	err := envconfig.Process("", &cfg)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to process environment variables")
+	}
+
+	if cfg.DryRunFormat == "" {
+		cfg.DryRunFormat = dryRunFormatTable
+	}
+
+	if len(cfg.ExpiryWarningDays) == 0 {
+		cfg.ExpiryWarningDays = defaultExpiryWarningDays
+	}
+
+	if cfg.TransfersTag == "" {
+		cfg.TransfersTag = defaultTransfersTag
+	}
+
+	if cfg.ReauthRedirect == "" {
+		cfg.ReauthRedirect = "http://127.0.0.1"
+	}
+
+	if cfg.ScheduleJitter < 0 {
+		return nil, errors.New("SCHEDULE_JITTER cannot be negative")
+	}
+
+	err = cfg.compileRules()
+	if err != nil {
+		return nil, err
+	}
+
+	err = cfg.resolveAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	return &cfg, nil
+}
+
+// validateNordigenCredentials checks that the Nordigen credentials are set.
+func (c *config) validateNordigenCredentials() error {
+	if c.Nordigen == nil || c.Nordigen.SecretID == "" || c.Nordigen.SecretKey == "" {
+		return errors.New("NORDIGEN_SECRET_ID and NORDIGEN_SECRET_KEY are required")
+	}
+
+	return nil
+}
+
+// validateLunchmoneyCredentials checks that the Lunchmoney credentials are set.
+func (c *config) validateLunchmoneyCredentials() error {
+	if c.LunchmoneyAccessToken == "" {
+		return errors.New("LUNCHMONEY_ACCESS_TOKEN is required")
+	}
+
+	return nil
+}
+
+// compileRules compiles the default rules, the rules from the rules file and the rules from the config file in this order.
+func (c *config) compileRules() error {
+	var allRules []*rules.Rule
+
+	if !c.DisableDefaultRules {
+		defaultRules, err := rules.DefaultRules()
+		if err != nil {
+			return errors.Wrap(err, "failed to load default rules")
+		}
+
+		allRules = append(allRules, defaultRules...)
+	}
+
+	if c.RulesFile != "" {
+		fileRules, err := rules.Load(c.RulesFile)
+		if err != nil {
+			return errors.Wrap(err, "failed to load rules file")
+		}
+
+		allRules = append(allRules, fileRules...)
+	}
+
+	allRules = append(allRules, c.Rules...)
+
+	ruleSet, err := rules.Compile(allRules)
+	if err != nil {
+		return errors.Wrap(err, "failed to compile rules")
+	}
+
+	c.ruleSet = ruleSet
+
+	return nil
+}
+
+// resolveAccounts merges the mappings from the environment variables into the accounts
+// and resolves the sync options of every account.
+func (c *config) resolveAccounts() error {
+	findAccount := func(nordigenAccountID string, lunchmoneyAssetID int) *accountConfig {
+		for _, account := range c.Accounts {
+			if account.NordigenAccountID == nordigenAccountID && account.LunchmoneyAssetID == lunchmoneyAssetID {
+				return account
+			}
+		}
+
+		account := &accountConfig{
+			NordigenAccountID: nordigenAccountID,
+			LunchmoneyAssetID: lunchmoneyAssetID,
+		}
+		c.Accounts = append(c.Accounts, account)
+
+		return account
+	}
+
+	for _, nordigenAccountID := range sortedKeys(c.TransactionsMap) {
+		findAccount(nordigenAccountID, c.TransactionsMap[nordigenAccountID]).Transactions = true
+	}
+
+	for _, nordigenAccountID := range sortedKeys(c.BalancesMap) {
+		findAccount(nordigenAccountID, c.BalancesMap[nordigenAccountID]).Balance = true
+	}
+
+	for _, account := range c.Accounts {
+		if account.NordigenAccountID == "" || account.LunchmoneyAssetID <= 0 {
+			return errors.Errorf("account %q requires a Nordigen account ID and a Lunchmoney asset ID", account.name())
+		}
+
+		opts, err := c.syncOptions(account)
+		if err != nil {
+			return errors.Wrapf(err, "invalid config for account %q", account.name())
+		}
+
+		account.opts = opts
+	}
+
+	return nil
+}
+
+// syncOptions returns the sync options for an account, account settings override the global settings.
+func (c *config) syncOptions(account *accountConfig) (*syncOptions, error) {
+	startDate, endDate := c.SyncStartDate, c.SyncEndDate
+	lookbackDays, pending, updates := c.SyncLookbackDays, c.SyncPending, c.SyncUpdates
+	removed := c.SyncRemoved
+
+	if account.SyncStartDate != nil {
+		startDate = *account.SyncStartDate
+	}
+
+	if account.SyncEndDate != nil {
+		endDate = *account.SyncEndDate
+	}
+
+	if account.SyncLookbackDays != nil {
+		lookbackDays = *account.SyncLookbackDays
+	}
+
+	if account.SyncPending != nil {
+		pending = *account.SyncPending
+	}
+
+	if account.SyncUpdates != nil {
+		updates = *account.SyncUpdates
+	}
+
+	if account.SyncRemoved != nil {
+		removed = *account.SyncRemoved
+	}
+
+	opts := &syncOptions{
+		LookbackDays: lookbackDays,
+		Pending:      pending,
+		Updates:      updates,
+		Removed:      removed,
+		Rules:        c.ruleSet,
+	}
+
+	var err error
+
+	if startDate != "" {
+		opts.StartDate, err = time.Parse("2006-01-02", startDate)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse sync start date")
+		}
+	}
+
+	if endDate != "" {
+		opts.EndDate, err = time.Parse("2006-01-02", endDate)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to parse sync end date")
+		}
+	}
+
+	if !opts.EndDate.IsZero() && opts.EndDate.Before(opts.StartDate) {
+		return nil, errors.New("sync end date cannot be before sync start date")
+	}
+
+	if opts.LookbackDays < 0 {
+		return nil, errors.New("sync lookback days cannot be negative")
+	}
+
+	switch opts.Removed {
+	case "", removedActionReport, removedActionTag, removedActionDelete:
+	default:
+		return nil, errors.Errorf("unknown action %q for removed transactions", opts.Removed)
+	}
+
+	return opts, nil
+}
+
+// name returns a human readable name of the account.
+func (a *accountConfig) name() string {
+	if a.Name != "" {
+		return a.Name
+	}
+
+	return a.NordigenAccountID
+}
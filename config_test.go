@@ -0,0 +1,213 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name    string
+		yaml    string
+		env     map[string]string
+		check   func(t *testing.T, cfg *config)
+		wantErr bool
+	}{
+		{
+			name: "config file",
+			yaml: `
+nordigen:
+  secret_id: id
+  secret_key: key
+lunchmoney_access_token: token
+sync_pending: true
+schedule_interval: 1h
+accounts:
+  - name: Checking
+    nordigen_account_id: account-1
+    lunchmoney_asset_id: 1
+    transactions: true
+    balance: true
+`,
+			check: func(t *testing.T, cfg *config) {
+				if cfg.Nordigen.SecretID != "id" || cfg.Nordigen.SecretKey != "key" || cfg.LunchmoneyAccessToken != "token" {
+					t.Errorf("expected the credentials of the config file, got %+v and %q", cfg.Nordigen, cfg.LunchmoneyAccessToken)
+				}
+
+				if cfg.ScheduleInterval != time.Hour {
+					t.Errorf("expected a schedule interval of an hour, got %s", cfg.ScheduleInterval)
+				}
+
+				if len(cfg.Accounts) != 1 {
+					t.Fatalf("expected a single account, got %d", len(cfg.Accounts))
+				}
+
+				account := cfg.Accounts[0]
+				if account.name() != "Checking" || !account.Transactions || !account.Balance || !account.opts.Pending {
+					t.Errorf("unexpected account %+v with options %+v", account, account.opts)
+				}
+
+				// defaults are applied to unset values
+				if cfg.DryRunFormat != dryRunFormatTable || cfg.TransfersTag != defaultTransfersTag {
+					t.Errorf("expected the defaults to be applied, got %q and %q", cfg.DryRunFormat, cfg.TransfersTag)
+				}
+			},
+		},
+		{
+			name: "environment takes precedence",
+			yaml: `
+lunchmoney_access_token: yaml-token
+sync_lookback_days: 30
+sync_removed: report
+`,
+			env: map[string]string{
+				"LUNCHMONEY_ACCESS_TOKEN": "env-token",
+				"SYNC_REMOVED":            "tag",
+			},
+			check: func(t *testing.T, cfg *config) {
+				if cfg.LunchmoneyAccessToken != "env-token" || cfg.SyncRemoved != removedActionTag {
+					t.Errorf("expected the environment variables to take precedence, got %q and %q", cfg.LunchmoneyAccessToken, cfg.SyncRemoved)
+				}
+
+				if cfg.SyncLookbackDays != 30 {
+					t.Errorf("expected the lookback days of the config file, got %d", cfg.SyncLookbackDays)
+				}
+			},
+		},
+		{
+			name: "mappings merged into accounts",
+			yaml: `
+accounts:
+  - name: Checking
+    nordigen_account_id: account-1
+    lunchmoney_asset_id: 1
+    transactions: true
+`,
+			env: map[string]string{
+				"TRANSACTIONS_MAP": "account-2:2",
+				"BALANCES_MAP":     "account-1:1,account-2:2",
+			},
+			check: func(t *testing.T, cfg *config) {
+				if len(cfg.Accounts) != 2 {
+					t.Fatalf("expected 2 accounts, got %d", len(cfg.Accounts))
+				}
+
+				if account := cfg.Accounts[0]; account.name() != "Checking" || !account.Transactions || !account.Balance {
+					t.Errorf("expected the balance mapping to be merged into the account, got %+v", account)
+				}
+
+				if account := cfg.Accounts[1]; account.NordigenAccountID != "account-2" || account.LunchmoneyAssetID != 2 ||
+					!account.Transactions || !account.Balance {
+					t.Errorf("expected an account for the mappings, got %+v", account)
+				}
+			},
+		},
+		{
+			name: "account overrides",
+			yaml: `
+sync_start_date: "2021-01-01"
+sync_lookback_days: 30
+sync_pending: true
+sync_removed: report
+accounts:
+  - nordigen_account_id: account-1
+    lunchmoney_asset_id: 1
+    transactions: true
+  - nordigen_account_id: account-2
+    lunchmoney_asset_id: 2
+    transactions: true
+    sync_start_date: "2021-06-01"
+    sync_end_date: "2021-06-30"
+    sync_lookback_days: 0
+    sync_pending: false
+    sync_updates: true
+    sync_removed: delete
+`,
+			check: func(t *testing.T, cfg *config) {
+				global, override := cfg.Accounts[0].opts, cfg.Accounts[1].opts
+
+				if !global.StartDate.Equal(time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)) || !global.EndDate.IsZero() ||
+					global.LookbackDays != 30 || !global.Pending || global.Updates || global.Removed != removedActionReport {
+					t.Errorf("expected the global options, got %+v", global)
+				}
+
+				if !override.StartDate.Equal(time.Date(2021, 6, 1, 0, 0, 0, 0, time.UTC)) ||
+					!override.EndDate.Equal(time.Date(2021, 6, 30, 0, 0, 0, 0, time.UTC)) ||
+					override.LookbackDays != 0 || override.Pending || !override.Updates || override.Removed != removedActionDelete {
+					t.Errorf("expected the account options, got %+v", override)
+				}
+			},
+		},
+		{
+			name:    "unknown field",
+			yaml:    "lunchmoney_token: token\n",
+			wantErr: true,
+		},
+		{
+			name: "invalid account override",
+			yaml: `
+accounts:
+  - nordigen_account_id: account-1
+    lunchmoney_asset_id: 1
+    sync_removed: archive
+`,
+			wantErr: true,
+		},
+		{
+			name: "end date before start date",
+			yaml: `
+sync_start_date: "2021-06-01"
+accounts:
+  - nordigen_account_id: account-1
+    lunchmoney_asset_id: 1
+    sync_end_date: "2021-05-31"
+`,
+			wantErr: true,
+		},
+		{
+			name:    "account without asset",
+			yaml:    "accounts:\n  - nordigen_account_id: account-1\n",
+			wantErr: true,
+		},
+		{
+			name:    "negative schedule jitter",
+			yaml:    "schedule_jitter: 5m\n",
+			env:     map[string]string{"SCHEDULE_JITTER": "-5m"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+
+			err := os.WriteFile(path, []byte(tt.yaml), 0o600)
+			if err != nil {
+				t.Fatalf("failed to write config file: %v", err)
+			}
+
+			t.Setenv("CONFIG_FILE", path)
+
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			cfg, err := loadConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed to load config: %v", err)
+			}
+
+			tt.check(t, cfg)
+		})
+	}
+}
@@ -0,0 +1,287 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// connectCallbackPath is the path of the local server the bank redirects to after connecting.
+const connectCallbackPath = "/callback"
+
+// connect guides the user through connecting a bank account to Nordigen
+// and prints the resulting requisition and account IDs.
+func connect(
+	ctx context.Context,
+	args []string,
+	in io.Reader,
+	out io.Writer,
+	nordigenClient *nordigen.Client,
+	log *zap.Logger,
+) error {
+	flags := flag.NewFlagSet("connect", flag.ContinueOnError)
+	flags.SetOutput(out)
+
+	country := flags.String("country", "", "ISO 3166 two-character country code of the institution")
+	institutionID := flags.String("institution", "", "ID of the institution to connect, skips choosing an institution")
+	language := flags.String("language", "EN", "language of the bank authentication pages")
+	listen := flags.String("listen", "127.0.0.1:0", "address of the local server receiving the redirect after authentication")
+	maxHistoricalDays := flags.Int("max-historical-days", 0, "days of transaction history to request, defaults to the maximum supported by the institution")
+	accessValidForDays := flags.Int("access-valid-for-days", 90, "days the access to the accounts is valid for")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse flags")
+	}
+
+	// listen for the redirect first, an agreement would be left behind if the address is in use
+	listener, err := net.Listen("tcp", *listen)
+	if err != nil {
+		return errors.Wrap(err, "failed to listen for the redirect")
+	}
+	defer listener.Close()
+
+	scanner := bufio.NewScanner(in)
+
+	// choose institution
+	var institution *nordigen.Institution
+
+	if *institutionID != "" {
+		institution, err = nordigenClient.GetInstitution(ctx, *institutionID)
+		if err != nil {
+			return errors.Wrap(err, "failed to fetch institution")
+		}
+	} else {
+		if *country == "" {
+			*country, err = prompt(scanner, out, "Country code (e.g. DE): ")
+			if err != nil {
+				return err
+			}
+		}
+
+		institution, err = chooseInstitution(ctx, *country, scanner, out, nordigenClient)
+		if err != nil {
+			return err
+		}
+	}
+
+	// request as much history as the institution allows
+	if *maxHistoricalDays <= 0 {
+		*maxHistoricalDays = institution.TransactionTotalDays
+	}
+
+	agreement, err := nordigenClient.CreateAgreement(ctx, &nordigen.AgreementRequest{
+		InstitutionID:      institution.ID,
+		MaxHistoricalDays:  *maxHistoricalDays,
+		AccessValidForDays: *accessValidForDays,
+		AccessScope: []string{
+			nordigen.AccessScopeBalances,
+			nordigen.AccessScopeDetails,
+			nordigen.AccessScopeTransactions,
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to create agreement")
+	}
+
+	log.Debug("created agreement",
+		zap.String("agreement_id", agreement.ID),
+		zap.Int("max_historical_days", agreement.MaxHistoricalDays),
+		zap.Int("access_valid_for_days", agreement.AccessValidForDays),
+	)
+
+	reference, err := randomReference()
+	if err != nil {
+		return err
+	}
+
+	requisition, err := nordigenClient.CreateRequisition(ctx, &nordigen.RequisitionRequest{
+		Redirect:      fmt.Sprintf("http://%s%s", listener.Addr(), connectCallbackPath),
+		InstitutionID: institution.ID,
+		Reference:     reference,
+		Agreement:     agreement.ID,
+		UserLanguage:  *language,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to create requisition")
+	}
+
+	log.Debug("created requisition", zap.String("requisition_id", requisition.ID))
+
+	callbackErrs := make(chan error, 1)
+	server := &http.Server{
+		Handler: connectCallbackHandler(reference, callbackErrs),
+	}
+
+	go func() {
+		err := server.Serve(listener)
+		if err != nil && err != http.ErrServerClosed {
+			callbackErrs <- errors.Wrap(err, "failed to serve redirect")
+		}
+	}()
+	defer server.Close()
+
+	fmt.Fprintf(out, "\nOpen the following link in your browser and authenticate with your bank:\n%s\n\n", requisition.Link)
+	fmt.Fprintln(out, "Waiting for the authentication to finish…")
+
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case err = <-callbackErrs:
+		if err != nil {
+			return err
+		}
+	}
+
+	return printRequisition(ctx, requisition.ID, out, nordigenClient, log)
+}
+
+// chooseInstitution lists all institutions of a country and lets the user pick one.
+func chooseInstitution(
+	ctx context.Context,
+	country string,
+	scanner *bufio.Scanner,
+	out io.Writer,
+	nordigenClient *nordigen.Client,
+) (*nordigen.Institution, error) {
+	institutions, err := nordigenClient.ListInstitutions(ctx, country)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list institutions")
+	}
+
+	if len(institutions) == 0 {
+		return nil, errors.Errorf("no institutions found for country %q", country)
+	}
+
+	for i, institution := range institutions {
+		fmt.Fprintf(out, "%4d  %s (%s)\n", i+1, institution.Name, institution.ID)
+	}
+
+	for {
+		answer, err := prompt(scanner, out, "Number of the institution to connect: ")
+		if err != nil {
+			return nil, err
+		}
+
+		number, err := strconv.Atoi(answer)
+		if err != nil || number < 1 || number > len(institutions) {
+			fmt.Fprintf(out, "Please enter a number between 1 and %d.\n", len(institutions))
+			continue
+		}
+
+		return institutions[number-1], nil
+	}
+}
+
+// connectCallbackHandler handles the redirect after authenticating with the bank,
+// the result is sent to the errs channel.
+func connectCallbackHandler(reference string, errs chan<- error) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc(connectCallbackPath, func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+
+		if query.Get("ref") != reference {
+			http.Error(w, "unknown reference", http.StatusBadRequest)
+			return
+		}
+
+		var err error
+		if query.Get("error") != "" {
+			err = errors.Errorf("failed to authenticate with bank: %s (%s)", query.Get("error"), query.Get("details"))
+
+			fmt.Fprintln(w, "Connecting your bank account failed, you can close this window.")
+		} else {
+			fmt.Fprintln(w, "Your bank account has been connected, you can close this window.")
+		}
+
+		select {
+		case errs <- err:
+		default:
+		}
+	})
+
+	return mux
+}
+
+// printRequisition prints the accounts of a requisition and the configuration to sync them.
+func printRequisition(
+	ctx context.Context,
+	requisitionID string,
+	out io.Writer,
+	nordigenClient *nordigen.Client,
+	log *zap.Logger,
+) error {
+	requisition, err := nordigenClient.GetRequisition(ctx, requisitionID)
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch requisition")
+	}
+
+	fmt.Fprintf(out, "\nNordigen Requisition ID: %s\n\n", requisition.ID)
+
+	mappings := make([]string, 0, len(requisition.Accounts))
+
+	for _, accountID := range requisition.Accounts {
+		account, err := nordigenClient.GetAccountDetails(ctx, accountID)
+		if err != nil {
+			log.Warn("failed to fetch account details for account ID",
+				zap.Error(err),
+				zap.String("account_id", accountID),
+			)
+
+			account = &nordigen.Account{}
+		}
+
+		fmt.Fprintf(out, "Nordigen Account ID: %s\n", accountID)
+		fmt.Fprintf(out, "  Name:     %s\n", account.Name)
+		fmt.Fprintf(out, "  Product:  %s\n", account.Product)
+		fmt.Fprintf(out, "  IBAN:     %s\n", account.IBAN)
+		fmt.Fprintf(out, "  Currency: %s\n", account.Currency)
+
+		mappings = append(mappings, accountID+":[Lunchmoney Asset ID]")
+	}
+
+	fmt.Fprintf(out, "\nNORDIGEN_REQUISITION_IDS=%s\n", requisition.ID)
+	fmt.Fprintf(out, "TRANSACTIONS_MAP=\"%s\"\n", strings.Join(mappings, ","))
+
+	return nil
+}
+
+// prompt asks the user for a line of input.
+func prompt(scanner *bufio.Scanner, out io.Writer, question string) (string, error) {
+	fmt.Fprint(out, question)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return "", errors.Wrap(err, "failed to read input")
+		}
+
+		return "", io.ErrUnexpectedEOF
+	}
+
+	return strings.TrimSpace(scanner.Text()), nil
+}
+
+// randomReference generates a unique reference for a requisition.
+func randomReference() (string, error) {
+	b := make([]byte, 16)
+
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", errors.Wrap(err, "failed to generate reference")
+	}
+
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,138 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestConnect(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	servers := newTestServers(t)
+
+	servers.nordigen.AddInstitution(&nordigen.Institution{ID: "OTHER_BANK", Name: "Other Bank", Countries: []string{"DE"}})
+	servers.nordigen.AddInstitution(&nordigen.Institution{ID: "BANK", Name: "Bank", Countries: []string{"DE"}, TransactionTotalDays: 540})
+
+	in := strings.NewReader("de\n3\n2\n")
+
+	var out bytes.Buffer
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- connect(ctx, []string{"-listen", "127.0.0.1:0"}, in, &out, servers.nordigenClient, zaptest.NewLogger(t))
+	}()
+
+	// wait for the requisition to be created
+	var requisition *nordigen.Requisition
+
+	for requisition == nil {
+		select {
+		case err := <-done:
+			t.Fatalf("expected connecting to wait for the redirect, got %v", err)
+		case <-ctx.Done():
+			t.Fatal("expected a requisition to be created")
+		case <-time.After(10 * time.Millisecond):
+		}
+
+		if requisitions := servers.nordigen.Requisitions(); len(requisitions) > 0 {
+			requisition = requisitions[0]
+		}
+	}
+
+	if requisition.InstitutionID != "BANK" || requisition.UserLanguage != "EN" {
+		t.Errorf("expected a requisition for the chosen institution, got %+v", requisition)
+	}
+
+	agreement, err := servers.nordigenClient.GetAgreement(ctx, requisition.Agreement)
+	if err != nil {
+		t.Fatalf("failed to fetch agreement: %v", err)
+	}
+
+	if agreement.MaxHistoricalDays != 540 || agreement.AccessValidForDays != 90 {
+		t.Errorf("expected the history supported by the institution, got %+v", agreement)
+	}
+
+	// redirects with an unknown reference are rejected
+	resp, err := http.Get(requisition.Redirect + "?ref=unknown")
+	if err != nil {
+		t.Fatalf("failed to call redirect: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("expected an unknown reference to be rejected, got %s", resp.Status)
+	}
+
+	// finish the authentication with the bank
+	servers.nordigen.LinkRequisition(requisition.ID, testAccountID)
+
+	resp, err = http.Get(requisition.Redirect + "?ref=" + requisition.Reference)
+	if err != nil {
+		t.Fatalf("failed to call redirect: %v", err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		t.Errorf("expected the redirect to succeed, got %s", resp.Status)
+	}
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("failed to connect: %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("expected connecting to finish after the redirect")
+	}
+
+	output := out.String()
+
+	for _, want := range []string{
+		"Please enter a number between 1 and 2.",
+		requisition.Link,
+		"Nordigen Account ID: " + testAccountID,
+		"IBAN:     DE89370400440532013000",
+		"NORDIGEN_REQUISITION_IDS=" + requisition.ID,
+		`TRANSACTIONS_MAP="` + testAccountID + `:[Lunchmoney Asset ID]"`,
+	} {
+		if !strings.Contains(output, want) {
+			t.Errorf("expected the output to contain %q, got:\n%s", want, output)
+		}
+	}
+}
+
+func TestConnectAddressInUse(t *testing.T) {
+	servers := newTestServers(t)
+
+	servers.nordigen.AddInstitution(&nordigen.Institution{ID: "BANK", Name: "Bank", Countries: []string{"DE"}})
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	defer listener.Close()
+
+	var out bytes.Buffer
+
+	err = connect(context.Background(), []string{"-institution", "BANK", "-listen", listener.Addr().String()}, strings.NewReader(""), &out, servers.nordigenClient, zaptest.NewLogger(t))
+	if err == nil {
+		t.Fatal("expected connecting to fail if the address is in use")
+	}
+
+	// nothing is created which would be left behind
+	for _, req := range servers.nordigen.Requests() {
+		if req.Method == http.MethodPost && !strings.HasPrefix(req.Path, "/token/") {
+			t.Errorf("expected nothing to be created, got %s %s", req.Method, req.Path)
+		}
+	}
+}
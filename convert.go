@@ -8,13 +8,16 @@ import (
 	"time"
 
 	"github.com/Seklfreak/nordigen-lunchmoney-sync/lunchmoney"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/money"
 	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/rules"
 )
 
 func createLunchmoneyTrx(
 	trx nordigen.Transaction,
 	account *nordigen.Account,
 	lunchmoneyAssetID int,
+	ruleSet *rules.RuleSet,
 ) (*lunchmoney.Transaction, error) {
 	payee := trx.CreditorName
 	if payee == "" {
@@ -26,62 +29,47 @@ func createLunchmoneyTrx(
 		date = trx.BookingDate
 	}
 
-	// for transfers from/to wallets using the personal account use OwnerName as payee (e.g. PayPal)
-	if (trx.AdditionalInformation == "MONEY_TRANSFER" ||
-		trx.ProprietaryBankTransactionCode == "TOPUP") &&
-		payee == "" && account.OwnerName != "" {
-		payee = account.OwnerName
-	}
+	note := remittanceInformation(trx)
+
+	transactionID := externalID(trx)
 
-	// for exchange or transfer use the transaction code as payee
-	if (trx.ProprietaryBankTransactionCode == "EXCHANGE" ||
-		trx.ProprietaryBankTransactionCode == "TRANSFER") &&
-		payee == "" {
-		payee = strings.Title(strings.ToLower(trx.ProprietaryBankTransactionCode))
+	// rewrite payee, notes etc. with the rules
+	result := &rules.Result{
+		Payee:  payee,
+		Notes:  note,
+		Tags:   []string{"nordigen-lunchmoney-sync"},
+		Status: string(lunchmoney.TransactionStatusUncleared),
 	}
 
-	note := trx.RemittanceInformationUnstructured
-	if note == "" {
-		note = strings.Join(trx.RemittanceInformationUnstructuredArray, "; ")
+	err := ruleSet.Apply(trx, account, result)
+	if err != nil {
+		return nil, fmt.Errorf("converting trx %s: %w", trx.TransactionID, err)
 	}
 
-	transactionID := trx.TransactionID
-	if transactionID == "" {
-		// if API returns no external Transaction ID build new one out of hash of all information
-		transactionID = fmt.Sprintf(
-			"%s|%.2f%s|%s|%s|%s",
-			time.Time(trx.ValueDate),
-			trx.TransactionAmount.Amount,
-			trx.TransactionAmount.Currency,
-			trx.CreditorName,
-			trx.DebtorName,
-			note,
-		)
-
-		hasher := sha256.New()
-		hasher.Write([]byte(transactionID))
-		transactionID = base64.URLEncoding.EncodeToString(hasher.Sum(nil))
+	if result.Skip {
+		return nil, nil // ignore transactions skipped by rules
 	}
 
 	lmTrx := &lunchmoney.Transaction{
 		AssetID: lunchmoneyAssetID,
 
-		Amount:     float64(trx.TransactionAmount.Amount),
+		Amount:     trx.TransactionAmount.Amount.Round(trx.TransactionAmount.Currency),
 		Currency:   strings.ToLower(trx.TransactionAmount.Currency),
 		Date:       lunchmoney.TransactionDate(date),
-		Payee:      payee,
-		Notes:      note,
-		Status:     lunchmoney.TransactionStatusUncleared,
+		Payee:      result.Payee,
+		Notes:      result.Notes,
+		CategoryID: result.CategoryID,
+		Status:     lunchmoney.TransactionStatus(result.Status),
 		ExternalID: transactionID,
 
-		Tags: []string{"nordigen-lunchmoney-sync"},
+		Tags: result.Tags,
 	}
 
 	if lmTrx.AssetID <= 0 {
 		return nil, fmt.Errorf("converting trx %s: lunchmoney transaction asset id cannot be empty", trx.TransactionID)
 	}
 
-	if lmTrx.Amount == 0 {
+	if lmTrx.Amount.IsZero() {
 		// TODO: return custom error type that can be ignored in the caller instead
 		return nil, nil // ignore transactions with 0 amount
 	}
@@ -104,3 +92,48 @@ func createLunchmoneyTrx(
 
 	return lmTrx, nil
 }
+
+// externalID returns the external ID of the Lunchmoney transaction created for a Nordigen transaction.
+func externalID(trx nordigen.Transaction) string {
+	if trx.TransactionID != "" {
+		return trx.TransactionID
+	}
+
+	note := remittanceInformation(trx)
+
+	// if API returns no external Transaction ID build new one out of hash of all information
+	transactionID := fmt.Sprintf(
+		"%s|%s%s|%s|%s|%s",
+		time.Time(trx.ValueDate),
+		externalIDAmount(trx.TransactionAmount.Amount),
+		trx.TransactionAmount.Currency,
+		trx.CreditorName,
+		trx.DebtorName,
+		note,
+	)
+
+	hasher := sha256.New()
+	hasher.Write([]byte(transactionID))
+
+	return base64.URLEncoding.EncodeToString(hasher.Sum(nil))
+}
+
+// remittanceInformation returns the unstructured remittance information of a transaction.
+func remittanceInformation(trx nordigen.Transaction) string {
+	if trx.RemittanceInformationUnstructured != "" {
+		return trx.RemittanceInformationUnstructured
+	}
+
+	return strings.Join(trx.RemittanceInformationUnstructuredArray, "; ")
+}
+
+// externalIDAmount formats the amount for generated external IDs with two decimal places,
+// changing the format would insert all transactions without an ID again.
+// Amounts with more decimal places are not rounded so they cannot collide.
+func externalIDAmount(amount money.Amount) string {
+	if amount.Places() > 2 && !money.MustParse(amount.StringFixed(2)).Equal(amount) {
+		return amount.String()
+	}
+
+	return amount.StringFixed(2)
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/money"
+)
+
+func TestExternalIDAmount(t *testing.T) {
+	tests := []struct {
+		amount string
+		want   string
+	}{
+		// formatted like the float based IDs generated before, otherwise transactions would be synced again
+		{amount: "-12.5", want: "-12.50"},
+		{amount: "-12.50", want: "-12.50"},
+		{amount: "1000", want: "1000.00"},
+		{amount: "1.2300", want: "1.23"},
+		// more precise amounts are not rounded so they do not collide
+		{amount: "1.234", want: "1.234"},
+		{amount: "1.235", want: "1.235"},
+	}
+
+	for _, tt := range tests {
+		if got := externalIDAmount(money.MustParse(tt.amount)); got != tt.want {
+			t.Errorf("externalIDAmount(%s) = %q, expected %q", tt.amount, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/lunchmoney"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/money"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/state"
+	"github.com/pkg/errors"
+)
+
+const (
+	dryRunFormatTable = "table"
+	dryRunFormatJSON  = "json"
+)
+
+// lunchmoneyAPI is the part of the Lunchmoney client used for syncing.
+type lunchmoneyAPI interface {
+	GetAssets(ctx context.Context) ([]*lunchmoney.Asset, error)
+	UpdateAsset(ctx context.Context, assetID int, asset *lunchmoney.Asset) error
+	GetCategories(ctx context.Context) ([]*lunchmoney.Category, error)
+	GetAllTransactions(ctx context.Context, filter *lunchmoney.TransactionFilter) ([]*lunchmoney.StoredTransaction, error)
+	InsertTransactions(ctx context.Context, trx []*lunchmoney.Transaction) ([]int, error)
+	UpdateTransaction(ctx context.Context, transactionID int, trx *lunchmoney.Transaction) error
+	DeleteTransaction(ctx context.Context, transactionID int) error
+	CreateTransactionGroup(ctx context.Context, group *lunchmoney.TransactionGroup) (int, error)
+}
+
+// dryRunTransaction is a transaction change that would have been written to Lunchmoney.
+type dryRunTransaction struct {
+	Action        string       `json:"action"`
+	TransactionID int          `json:"transaction_id,omitempty"`
+	AssetID       int          `json:"asset_id,omitempty"`
+	Date          string       `json:"date,omitempty"`
+	Payee         string       `json:"payee,omitempty"`
+	Amount        money.Amount `json:"amount"`
+	Currency      string       `json:"currency,omitempty"`
+	Notes         string       `json:"notes,omitempty"`
+	ExternalID    string       `json:"external_id,omitempty"`
+}
+
+// dryRunBalance is a balance change that would have been written to Lunchmoney.
+type dryRunBalance struct {
+	AssetID        int          `json:"asset_id"`
+	Name           string       `json:"name"`
+	CurrentBalance money.Amount `json:"current_balance"`
+	NewBalance     money.Amount `json:"new_balance"`
+	Change         money.Amount `json:"change"`
+	Currency       string       `json:"currency"`
+}
+
+// dryRunReport collects all changes that would have been written to Lunchmoney.
+type dryRunReport struct {
+	Transactions []*dryRunTransaction `json:"transactions"`
+	Balances     []*dryRunBalance     `json:"balances"`
+
+	lock sync.Mutex
+}
+
+func (r *dryRunReport) addTransaction(action string, transactionID int, trx *lunchmoney.Transaction) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	item := &dryRunTransaction{
+		Action:        action,
+		TransactionID: transactionID,
+	}
+
+	if trx != nil {
+		item.AssetID = trx.AssetID
+		item.Date = time.Time(trx.Date).Format("2006-01-02")
+		item.Payee = trx.Payee
+		item.Amount = trx.Amount
+		item.Currency = trx.Currency
+		item.Notes = trx.Notes
+		item.ExternalID = trx.ExternalID
+	}
+
+	r.Transactions = append(r.Transactions, item)
+}
+
+func (r *dryRunReport) addBalance(balance *dryRunBalance) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.Balances = append(r.Balances, balance)
+}
+
+// reset removes all collected changes.
+func (r *dryRunReport) reset() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.Transactions = nil
+	r.Balances = nil
+}
+
+// render writes the report in the given format.
+func (r *dryRunReport) render(w io.Writer, format string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	switch format {
+	case dryRunFormatJSON:
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		return errors.Wrap(encoder.Encode(r), "failed to encode report")
+	case dryRunFormatTable, "":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+
+		fmt.Fprintln(tw, "ACTION\tTRANSACTION ID\tASSET ID\tDATE\tPAYEE\tAMOUNT\tCURRENCY\tNOTES\tEXTERNAL ID")
+		for _, trx := range r.Transactions {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+				trx.Action,
+				formatOptionalID(trx.TransactionID),
+				formatOptionalID(trx.AssetID),
+				trx.Date,
+				trx.Payee,
+				trx.Amount.Format(trx.Currency),
+				strings.ToUpper(trx.Currency),
+				trx.Notes,
+				trx.ExternalID,
+			)
+		}
+
+		fmt.Fprintln(tw)
+		fmt.Fprintln(tw, "ASSET ID\tNAME\tCURRENT BALANCE\tNEW BALANCE\tCHANGE\tCURRENCY")
+		for _, balance := range r.Balances {
+			change := balance.Change.Format(balance.Currency)
+			if !balance.Change.IsNegative() {
+				change = "+" + change
+			}
+
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n",
+				balance.AssetID,
+				balance.Name,
+				balance.CurrentBalance.Format(balance.Currency),
+				balance.NewBalance.Format(balance.Currency),
+				change,
+				strings.ToUpper(balance.Currency),
+			)
+		}
+
+		return errors.Wrap(tw.Flush(), "failed to write report")
+	}
+
+	return errors.Errorf("unknown dry run format %q", format)
+}
+
+func formatOptionalID(id int) string {
+	if id == 0 {
+		return "-"
+	}
+
+	return fmt.Sprint(id)
+}
+
+// dryRunClient records all changes in a report instead of writing them to Lunchmoney.
+type dryRunClient struct {
+	*lunchmoney.Client
+
+	report *dryRunReport
+	nextID int
+	lock   sync.Mutex
+}
+
+// InsertTransactions records the transactions and returns placeholder IDs.
+func (c *dryRunClient) InsertTransactions(ctx context.Context, trx []*lunchmoney.Transaction) ([]int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	ids := make([]int, 0, len(trx))
+
+	for _, t := range trx {
+		c.report.addTransaction("insert", 0, t)
+
+		// placeholder IDs are negative so they cannot be confused with real ones
+		c.nextID--
+		ids = append(ids, c.nextID)
+	}
+
+	return ids, nil
+}
+
+// UpdateTransaction records the update.
+func (c *dryRunClient) UpdateTransaction(ctx context.Context, transactionID int, trx *lunchmoney.Transaction) error {
+	c.report.addTransaction("update", transactionID, trx)
+
+	return nil
+}
+
+// DeleteTransaction records the deletion.
+func (c *dryRunClient) DeleteTransaction(ctx context.Context, transactionID int) error {
+	c.report.addTransaction("delete", transactionID, nil)
+
+	return nil
+}
+
+// CreateTransactionGroup records the grouped transactions and returns a placeholder ID.
+func (c *dryRunClient) CreateTransactionGroup(ctx context.Context, group *lunchmoney.TransactionGroup) (int, error) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for _, transactionID := range group.Transactions {
+		c.report.addTransaction("group", transactionID, &lunchmoney.Transaction{
+			Date:  group.Date,
+			Payee: group.Payee,
+		})
+	}
+
+	c.nextID--
+
+	return c.nextID, nil
+}
+
+// UpdateAsset records the balance change of the asset.
+func (c *dryRunClient) UpdateAsset(ctx context.Context, assetID int, asset *lunchmoney.Asset) error {
+	if asset.Balance == nil {
+		return nil
+	}
+
+	assets, err := c.GetAssets(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch assets")
+	}
+
+	balance := &dryRunBalance{
+		AssetID:    assetID,
+		NewBalance: *asset.Balance,
+	}
+
+	for _, a := range assets {
+		if a.ID != assetID {
+			continue
+		}
+
+		balance.Name = a.Name
+		balance.Currency = a.Currency
+
+		if a.Balance != nil {
+			balance.CurrentBalance = *a.Balance
+		}
+	}
+
+	balance.Change = balance.NewBalance.Sub(balance.CurrentBalance)
+
+	c.report.addBalance(balance)
+
+	return nil
+}
+
+// dryRunStore loads the state from the wrapped store but never saves it there.
+// Saved states are kept in memory instead, so later steps of a run see the changes of earlier ones,
+// e.g. linking the transfers inserted by the sync.
+type dryRunStore struct {
+	state.Store
+
+	lock    sync.Mutex
+	overlay map[string][]byte
+}
+
+// Load returns the state saved during the dry run, or the state of the wrapped store if there is none.
+func (s *dryRunStore) Load(ctx context.Context, key string) (*state.Account, error) {
+	s.lock.Lock()
+	data, ok := s.overlay[key]
+	s.lock.Unlock()
+
+	if !ok {
+		return s.Store.Load(ctx, key)
+	}
+
+	account := state.NewAccount()
+
+	err := json.Unmarshal(data, account)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode state")
+	}
+
+	return account, nil
+}
+
+// Save keeps the state in memory.
+func (s *dryRunStore) Save(ctx context.Context, key string, account *state.Account) error {
+	data, err := json.Marshal(account)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode state")
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if s.overlay == nil {
+		s.overlay = make(map[string][]byte)
+	}
+
+	s.overlay[key] = data
+
+	return nil
+}
+
+// reset discards all states saved during the dry run.
+func (s *dryRunStore) reset() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.overlay = nil
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/money"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen/nordigentest"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/state"
+)
+
+func TestDryRun(t *testing.T) {
+	for _, format := range []string{dryRunFormatTable, dryRunFormatJSON} {
+		t.Run(format, func(t *testing.T) {
+			ctx := context.Background()
+			servers := newTestServers(t)
+
+			servers.nordigen.SetAccount(testAccountID, &nordigentest.Account{
+				Details:  &nordigen.Account{Currency: "EUR"},
+				Balances: []*nordigentest.Balance{{Amount: "150", Currency: "EUR", Type: "expected"}},
+				Booked: []*nordigentest.Transaction{{
+					TransactionID: "trx-1",
+					BookingDate:   "2021-10-01",
+					Amount:        "-12.50",
+					Currency:      "EUR",
+					CreditorName:  "Bakery",
+				}},
+			})
+
+			var output bytes.Buffer
+
+			report := &dryRunReport{}
+			store := state.NewMemoryStore()
+
+			s := newTestSyncer(t, servers, &accountConfig{
+				NordigenAccountID: testAccountID,
+				LunchmoneyAssetID: servers.asset.ID,
+				Transactions:      true,
+				Balance:           true,
+			})
+			s.lunchmoneyClient = &dryRunClient{Client: servers.lunchmoneyClient, report: report}
+			s.store = &dryRunStore{Store: store}
+			s.dryRun = report
+			s.dryRunFormat = format
+			s.dryRunOutput = &output
+
+			err := s.run(ctx)
+			if err != nil {
+				t.Fatalf("failed to run dry run: %v", err)
+			}
+
+			for _, req := range servers.lunchmoney.Requests() {
+				if req.Method != http.MethodGet {
+					t.Errorf("expected no changes to Lunchmoney, got %s %s", req.Method, req.Path)
+				}
+			}
+
+			if transactions := servers.lunchmoney.Transactions(); len(transactions) != 0 {
+				t.Errorf("expected no transactions to be inserted, got %+v", transactions)
+			}
+
+			accountState, err := store.Load(ctx, stateKey(testAccountID, servers.asset.ID))
+			if err != nil {
+				t.Fatalf("failed to load state: %v", err)
+			}
+
+			if accountState.Synced("trx-1") {
+				t.Error("expected the state not to be saved")
+			}
+
+			assetID := strconv.Itoa(servers.asset.ID)
+
+			wantTransaction := []string{"insert", "-", assetID, "2021-10-01", "Bakery", "-12.50", "EUR", "trx-1"}
+			wantBalance := []string{assetID, "Checking", "100.00", "150.00", "+50.00", "EUR"}
+
+			switch format {
+			case dryRunFormatTable:
+				lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+				if len(lines) != 5 {
+					t.Fatalf("expected a table with a transaction and a balance, got:\n%s", output.String())
+				}
+
+				if fields := strings.Fields(lines[1]); !reflect.DeepEqual(fields, wantTransaction) {
+					t.Errorf("expected transaction %v, got %v", wantTransaction, fields)
+				}
+
+				if fields := strings.Fields(lines[4]); !reflect.DeepEqual(fields, wantBalance) {
+					t.Errorf("expected balance %v, got %v", wantBalance, fields)
+				}
+			case dryRunFormatJSON:
+				var rendered dryRunReport
+
+				err = json.Unmarshal(output.Bytes(), &rendered)
+				if err != nil {
+					t.Fatalf("failed to decode report: %v", err)
+				}
+
+				if len(rendered.Transactions) != 1 || len(rendered.Balances) != 1 {
+					t.Fatalf("expected a transaction and a balance, got %s", output.String())
+				}
+
+				trx := rendered.Transactions[0]
+				if trx.Action != "insert" || trx.AssetID != servers.asset.ID || trx.Date != "2021-10-01" ||
+					trx.Payee != "Bakery" || !trx.Amount.Equal(money.MustParse("-12.50")) || trx.ExternalID != "trx-1" {
+					t.Errorf("unexpected transaction %+v", trx)
+				}
+
+				balance := rendered.Balances[0]
+				if balance.AssetID != servers.asset.ID || balance.Name != "Checking" ||
+					!balance.CurrentBalance.Equal(money.MustParse("100")) ||
+					!balance.NewBalance.Equal(money.MustParse("150")) ||
+					!balance.Change.Equal(money.MustParse("50")) {
+					t.Errorf("unexpected balance %+v", balance)
+				}
+			}
+		})
+	}
+}
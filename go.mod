@@ -5,7 +5,10 @@ go 1.17
 require (
 	github.com/kelseyhightower/envconfig v1.4.0
 	github.com/pkg/errors v0.9.1
+	github.com/robfig/cron/v3 v3.0.1
+	github.com/shopspring/decimal v1.4.0
 	go.uber.org/zap v1.19.1
+	gopkg.in/yaml.v3 v3.0.1
 )
 
 require (
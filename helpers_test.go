@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/lunchmoney"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/lunchmoney/lunchmoneytest"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/money"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen/nordigentest"
+)
+
+// testAccountID is the Nordigen account set up by newTestServers.
+const testAccountID = "account-1"
+
+// testServers contains fake APIs and clients talking to them.
+type testServers struct {
+	nordigen         *nordigentest.Server
+	lunchmoney       *lunchmoneytest.Server
+	nordigenClient   *nordigen.Client
+	lunchmoneyClient *lunchmoney.Client
+	asset            *lunchmoney.Asset
+}
+
+// newTestServers starts fake APIs with a single Nordigen account and a Lunchmoney asset.
+func newTestServers(t *testing.T) *testServers {
+	t.Helper()
+
+	nordigenServer := nordigentest.NewServer()
+	t.Cleanup(nordigenServer.Close)
+
+	lunchmoneyServer := lunchmoneytest.NewServer()
+	t.Cleanup(lunchmoneyServer.Close)
+
+	nordigenServer.SetAccount(testAccountID, &nordigentest.Account{
+		Details: &nordigen.Account{
+			Name:      "Checking",
+			OwnerName: "Jane Doe",
+			Currency:  "EUR",
+			IBAN:      "DE89370400440532013000",
+		},
+	})
+
+	balance := money.MustParse("100")
+	asset := lunchmoneyServer.AddAsset(&lunchmoney.Asset{
+		Name:     "Checking",
+		TypeName: "cash",
+		Balance:  &balance,
+		Currency: "eur",
+	})
+
+	nordigenClient, err := nordigenServer.Client()
+	if err != nil {
+		t.Fatalf("failed to create Nordigen client: %v", err)
+	}
+
+	return &testServers{
+		nordigen:         nordigenServer,
+		lunchmoney:       lunchmoneyServer,
+		nordigenClient:   nordigenClient,
+		lunchmoneyClient: lunchmoneyServer.Client(),
+		asset:            asset,
+	}
+}
@@ -0,0 +1,32 @@
+package lunchmoney
+
+import (
+	"context"
+	"net/http"
+)
+
+// Category represents a single category.
+type Category struct {
+	ID                int    `json:"id"`
+	Name              string `json:"name"`
+	Description       string `json:"description"`
+	IsIncome          bool   `json:"is_income"`
+	ExcludeFromBudget bool   `json:"exclude_from_budget"`
+	ExcludeFromTotals bool   `json:"exclude_from_totals"`
+	IsGroup           bool   `json:"is_group"`
+	GroupID           int    `json:"group_id"`
+}
+
+// GetCategories retrieves all categories including category groups from the Lunchmoney API.
+func (c *Client) GetCategories(ctx context.Context) ([]*Category, error) {
+	var categoriesContainer struct {
+		Categories []*Category `json:"categories"`
+	}
+
+	err := c.call(ctx, http.MethodGet, "/v1/categories", nil, &categoriesContainer, "fetching categories")
+	if err != nil {
+		return nil, err
+	}
+
+	return categoriesContainer.Categories, nil
+}
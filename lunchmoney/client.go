@@ -3,29 +3,51 @@ package lunchmoney
 import (
 	"bytes"
 	"context"
+	"encoding/json"
+	"io"
 	"net/http"
+	"strings"
 
 	"github.com/pkg/errors"
 )
 
-const baseURL = "https://dev.lunchmoney.app"
+// DefaultBaseURL is the base URL of the Lunchmoney API used if no other base URL is set.
+const DefaultBaseURL = "https://dev.lunchmoney.app"
 
 // Client allows interacting with the Lunchmoney API.
 type Client struct {
 	accessToken string
 	httpClient  *http.Client
+	baseURL     string
+}
+
+// Option configures a client.
+type Option func(*Client)
+
+// WithBaseURL sets the base URL of the API, e.g. to use a mock server.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
 }
 
 // NewClient creates a new client.
-func NewClient(accessToken string, httpClient *http.Client) *Client {
-	return &Client{
+func NewClient(accessToken string, httpClient *http.Client, opts ...Option) *Client {
+	client := &Client{
 		accessToken: accessToken,
 		httpClient:  httpClient,
+		baseURL:     DefaultBaseURL,
 	}
+
+	for _, opt := range opts {
+		opt(client)
+	}
+
+	return client
 }
 
 func (c *Client) createRequest(ctx context.Context, method string, endpoint string, body []byte) (*http.Request, error) {
-	req, err := http.NewRequestWithContext(ctx, method, baseURL+endpoint, bytes.NewReader(body))
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+endpoint, bytes.NewReader(body))
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to create http request")
 	}
@@ -35,3 +57,51 @@ func (c *Client) createRequest(ctx context.Context, method string, endpoint stri
 
 	return req, nil
 }
+
+// call executes a request with an optional JSON body and decodes the JSON response into result.
+// The action describes the request in error messages, for example "fetching assets".
+// An *APIError is returned if the API reported an error, as some endpoints report errors
+// for parts of the request only, the response is decoded into result nonetheless if it was successful.
+func (c *Client) call(ctx context.Context, method string, endpoint string, body interface{}, result interface{}, action string) error {
+	var reqData []byte
+
+	if body != nil {
+		var err error
+
+		reqData, err = json.Marshal(body)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal request")
+		}
+	}
+
+	req, err := c.createRequest(ctx, method, endpoint, reqData)
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to make http request")
+	}
+	defer resp.Body.Close()
+
+	respData, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return errors.Wrap(err, "failed to read response body")
+	}
+
+	apiErr := extractError(resp.StatusCode, respData)
+
+	if result != nil && successful(resp.StatusCode) && len(bytes.TrimSpace(respData)) > 0 {
+		err = json.Unmarshal(respData, result)
+		if err != nil && apiErr == nil {
+			return errors.Wrap(err, "failed to decode response body")
+		}
+	}
+
+	if apiErr != nil {
+		return errors.Wrapf(apiErr, "failed %s", action)
+	}
+
+	return nil
+}
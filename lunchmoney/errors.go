@@ -0,0 +1,178 @@
+package lunchmoney
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// ErrorKind classifies errors returned by the API.
+type ErrorKind int
+
+// Kinds of API errors.
+const (
+	// ErrorKindUnknown is an error that could not be classified.
+	ErrorKindUnknown ErrorKind = iota
+	// ErrorKindUnauthorized is returned if the access token is invalid or has been revoked.
+	ErrorKindUnauthorized
+	// ErrorKindNotFound is returned if a referenced asset, category or transaction does not exist.
+	ErrorKindNotFound
+	// ErrorKindDuplicate is returned if a transaction with the same external ID exists already.
+	ErrorKindDuplicate
+	// ErrorKindInvalid is returned if the request was rejected as invalid.
+	ErrorKindInvalid
+	// ErrorKindRateLimited is returned if too many requests have been made.
+	ErrorKindRateLimited
+	// ErrorKindServer is returned if the API failed to handle the request.
+	ErrorKindServer
+)
+
+// String returns the name of the error kind.
+func (k ErrorKind) String() string {
+	switch k {
+	case ErrorKindUnauthorized:
+		return "unauthorized"
+	case ErrorKindNotFound:
+		return "not found"
+	case ErrorKindDuplicate:
+		return "duplicate"
+	case ErrorKindInvalid:
+		return "invalid"
+	case ErrorKindRateLimited:
+		return "rate limited"
+	case ErrorKindServer:
+		return "server error"
+	}
+
+	return "unknown"
+}
+
+// APIError represents a Lunchmoney API error.
+// The API reports some errors with a successful status code, they are returned as APIError as well.
+type APIError struct {
+	StatusCode int
+	Messages   []string
+	Kind       ErrorKind
+}
+
+// Error returns the error message of a Lunchmoney API error.
+func (e *APIError) Error() string {
+	if len(e.Messages) == 0 {
+		return fmt.Sprintf("received unexpected status code %d (%s)", e.StatusCode, e.Kind)
+	}
+
+	return fmt.Sprintf("received status code %d with %d errors (%s): %q",
+		e.StatusCode,
+		len(e.Messages),
+		e.Kind,
+		strings.Join(e.Messages, "; "),
+	)
+}
+
+// Temporary returns true if the request may succeed when it is made again later.
+func (e *APIError) Temporary() bool {
+	return e.Kind == ErrorKindRateLimited || e.Kind == ErrorKindServer
+}
+
+// IsKind returns true if the error is or wraps an APIError of the given kind.
+func IsKind(err error, kind ErrorKind) bool {
+	var apiErr *APIError
+
+	return errors.As(err, &apiErr) && apiErr.Kind == kind
+}
+
+// extractError returns an APIError if the response is unsuccessful or its body contains errors, nil is returned otherwise.
+// The API uses "error", "errors" and "message" fields containing a single message or a list of messages.
+func extractError(statusCode int, body []byte) error {
+	messages := errorMessages(body)
+
+	if successful(statusCode) && len(messages) == 0 {
+		return nil
+	}
+
+	return &APIError{
+		StatusCode: statusCode,
+		Messages:   messages,
+		Kind:       classifyError(statusCode, messages),
+	}
+}
+
+// successful returns true for 2xx status codes.
+func successful(statusCode int) bool {
+	return statusCode >= http.StatusOK && statusCode < http.StatusMultipleChoices
+}
+
+// errorMessages returns the error messages contained in a response body.
+func errorMessages(body []byte) []string {
+	// successful responses are not necessarily objects, e.g. the ID of a transaction group
+	if !bytes.HasPrefix(bytes.TrimSpace(body), []byte("{")) {
+		return nil
+	}
+
+	var fields map[string]json.RawMessage
+
+	err := json.Unmarshal(body, &fields)
+	if err != nil {
+		return nil
+	}
+
+	var messages []string
+
+	for _, key := range []string{"error", "errors", "message"} {
+		value, ok := fields[key]
+		if !ok {
+			continue
+		}
+
+		var message string
+		if json.Unmarshal(value, &message) == nil {
+			if message != "" {
+				messages = append(messages, message)
+			}
+
+			continue
+		}
+
+		var list []string
+		if json.Unmarshal(value, &list) == nil {
+			messages = append(messages, list...)
+		}
+	}
+
+	return messages
+}
+
+// classifyError returns the kind of an error by its status code and messages.
+func classifyError(statusCode int, messages []string) ErrorKind {
+	switch {
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return ErrorKindUnauthorized
+	case statusCode == http.StatusNotFound:
+		return ErrorKindNotFound
+	case statusCode == http.StatusTooManyRequests:
+		return ErrorKindRateLimited
+	case statusCode >= http.StatusInternalServerError:
+		return ErrorKindServer
+	}
+
+	message := strings.ToLower(strings.Join(messages, "\n"))
+
+	switch {
+	case strings.Contains(message, "access token"):
+		return ErrorKindUnauthorized
+	case strings.Contains(message, "already exists") || strings.Contains(message, "duplicate"):
+		return ErrorKindDuplicate
+	case strings.Contains(message, "not found") || strings.Contains(message, "does not exist"):
+		return ErrorKindNotFound
+	case statusCode == http.StatusBadRequest ||
+		statusCode == http.StatusUnprocessableEntity ||
+		len(messages) > 0:
+		return ErrorKindInvalid
+	}
+
+	return ErrorKindUnknown
+}
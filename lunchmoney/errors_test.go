@@ -0,0 +1,105 @@
+package lunchmoney
+
+import (
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestExtractError(t *testing.T) {
+	tests := []struct {
+		name         string
+		statusCode   int
+		body         string
+		wantMessages []string
+		wantKind     ErrorKind
+		wantNil      bool
+	}{
+		{
+			name:       "success",
+			statusCode: http.StatusOK,
+			body:       `{"ids":[1,2]}`,
+			wantNil:    true,
+		},
+		{
+			name:       "success without object",
+			statusCode: http.StatusOK,
+			body:       `42`,
+			wantNil:    true,
+		},
+		{
+			name:       "no content",
+			statusCode: http.StatusNoContent,
+			wantNil:    true,
+		},
+		{
+			name:         "invalid token",
+			statusCode:   http.StatusUnauthorized,
+			body:         `{"name":"Error","message":"Access token does not exist."}`,
+			wantMessages: []string{"Access token does not exist."},
+			wantKind:     ErrorKindUnauthorized,
+		},
+		{
+			name:         "asset not found",
+			statusCode:   http.StatusNotFound,
+			body:         `{"error":"Asset not found."}`,
+			wantMessages: []string{"Asset not found."},
+			wantKind:     ErrorKindNotFound,
+		},
+		{
+			name:         "duplicate external id",
+			statusCode:   http.StatusOK,
+			body:         `{"error":["Key (user_external_id, asset_id)=(abc, 1) already exists."]}`,
+			wantMessages: []string{"Key (user_external_id, asset_id)=(abc, 1) already exists."},
+			wantKind:     ErrorKindDuplicate,
+		},
+		{
+			name:         "referenced category does not exist",
+			statusCode:   http.StatusOK,
+			body:         `{"errors":["Category ID 123 does not exist."]}`,
+			wantMessages: []string{"Category ID 123 does not exist."},
+			wantKind:     ErrorKindNotFound,
+		},
+		{
+			name:         "invalid input",
+			statusCode:   http.StatusOK,
+			body:         `{"error":["Transaction 0 is missing a date or an amount.","Invalid currency."]}`,
+			wantMessages: []string{"Transaction 0 is missing a date or an amount.", "Invalid currency."},
+			wantKind:     ErrorKindInvalid,
+		},
+		{
+			name:       "rate limited",
+			statusCode: http.StatusTooManyRequests,
+			body:       `Too Many Requests`,
+			wantKind:   ErrorKindRateLimited,
+		},
+		{
+			name:       "server error",
+			statusCode: http.StatusBadGateway,
+			body:       `<html>Bad Gateway</html>`,
+			wantKind:   ErrorKindServer,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := extractError(tt.statusCode, []byte(tt.body))
+			if tt.wantNil {
+				if err != nil {
+					t.Fatalf("expected no error, got %v", err)
+				}
+
+				return
+			}
+
+			if !IsKind(err, tt.wantKind) {
+				t.Fatalf("expected error of kind %s, got %v", tt.wantKind, err)
+			}
+
+			apiErr := err.(*APIError)
+			if apiErr.StatusCode != tt.statusCode || !reflect.DeepEqual(apiErr.Messages, tt.wantMessages) {
+				t.Errorf("expected status code %d and messages %q, got %+v", tt.statusCode, tt.wantMessages, apiErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,4 @@
+/*
+Package lunchmoneytest contains an in-process fake of the Lunchmoney API for tests.
+*/
+package lunchmoneytest
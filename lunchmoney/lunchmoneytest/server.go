@@ -0,0 +1,783 @@
+package lunchmoneytest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/lunchmoney"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/money"
+)
+
+// AccessToken is the access token accepted by a new server.
+const AccessToken = "test-access-token"
+
+// Server is a fake Lunchmoney API. Use its URL as the base URL of the client.
+type Server struct {
+	*httptest.Server
+
+	// RejectDuplicates fails inserts containing an external ID which exists already for the asset,
+	// instead of skipping the duplicates.
+	RejectDuplicates bool
+
+	lock         sync.Mutex
+	lastID       int
+	assets       []*lunchmoney.Asset
+	categories   []*lunchmoney.Category
+	transactions map[int]*Transaction
+	tags         map[string]int
+	failures     []*failure
+	requests     []*Request
+}
+
+// Transaction is a transaction stored by the fake API.
+type Transaction struct {
+	ID          int         `json:"id"`
+	Date        string      `json:"date"`
+	Amount      json.Number `json:"amount"`
+	Currency    string      `json:"currency"`
+	Payee       string      `json:"payee"`
+	AssetID     int         `json:"asset_id"`
+	CategoryID  int         `json:"category_id"`
+	RecurringID int         `json:"recurring_id"`
+	Notes       string      `json:"notes"`
+	Status      string      `json:"status"`
+	ExternalID  string      `json:"external_id"`
+	Tags        []string    `json:"tags"`
+	GroupID     int         `json:"group_id"`
+	IsGroup     bool        `json:"is_group"`
+	ParentID    int         `json:"parent_id"`
+	HasChildren bool        `json:"has_children"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+}
+
+// transactionResponse is a transaction in the format returned by the API.
+type transactionResponse struct {
+	*Transaction
+
+	Tags     []*lunchmoney.Tag      `json:"tags"`
+	Children []*transactionResponse `json:"children,omitempty"`
+}
+
+// DefaultLimit is the number of transactions returned per page if the request does not set a limit.
+const DefaultLimit = 1000
+
+// Request is a request received by the server.
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+}
+
+// failure is an injected error returned for the next requests matching the path prefix.
+type failure struct {
+	pathPrefix string
+	statusCode int
+	remaining  int
+	header     http.Header
+}
+
+// NewServer starts a new fake Lunchmoney API, it has to be closed after use.
+func NewServer() *Server {
+	s := &Server{
+		transactions: make(map[int]*Transaction),
+		tags:         make(map[string]int),
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+
+	return s
+}
+
+// Client creates a client for the server.
+func (s *Server) Client() *lunchmoney.Client {
+	return lunchmoney.NewClient(AccessToken, s.Server.Client(), lunchmoney.WithBaseURL(s.URL))
+}
+
+// AddAsset adds an asset, the ID is generated if it is empty.
+func (s *Server) AddAsset(asset *lunchmoney.Asset) *lunchmoney.Asset {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if asset.ID == 0 {
+		asset.ID = s.nextID()
+	}
+
+	s.assets = append(s.assets, asset)
+
+	return asset
+}
+
+// Asset returns a copy of the asset with the given ID, nil is returned if it does not exist.
+func (s *Server) Asset(assetID int) *lunchmoney.Asset {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, asset := range s.assets {
+		if asset.ID == assetID {
+			a := *asset
+			return &a
+		}
+	}
+
+	return nil
+}
+
+// AddCategory adds a category, the ID is generated if it is empty.
+func (s *Server) AddCategory(category *lunchmoney.Category) *lunchmoney.Category {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if category.ID == 0 {
+		category.ID = s.nextID()
+	}
+
+	s.categories = append(s.categories, category)
+
+	return category
+}
+
+// AddTransaction adds a transaction, the ID is generated if it is empty.
+func (s *Server) AddTransaction(trx *Transaction) *Transaction {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if trx.ID == 0 {
+		trx.ID = s.nextID()
+	}
+
+	s.store(trx)
+
+	return trx
+}
+
+// TagID returns the ID of the tag with the name, the tag is created if it does not exist.
+func (s *Server) TagID(name string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return s.tagID(name)
+}
+
+// Transactions returns copies of all stored transactions ordered by ID.
+func (s *Server) Transactions() []*Transaction {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	transactions := make([]*Transaction, 0, len(s.transactions))
+
+	for _, trx := range s.transactions {
+		t := *trx
+		transactions = append(transactions, &t)
+	}
+
+	sort.Slice(transactions, func(i, j int) bool {
+		return transactions[i].ID < transactions[j].ID
+	})
+
+	return transactions
+}
+
+// Fail makes the next count requests whose path starts with pathPrefix fail with the status code.
+// With http.StatusOK the failure is reported in the response body, as the Lunchmoney API does for invalid input.
+func (s *Server) Fail(pathPrefix string, statusCode int, count int) {
+	s.FailWithHeader(pathPrefix, statusCode, count, nil)
+}
+
+// FailWithHeader is like Fail, the header is added to the failed responses.
+func (s *Server) FailWithHeader(pathPrefix string, statusCode int, count int, header http.Header) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.failures = append(s.failures, &failure{
+		pathPrefix: pathPrefix,
+		statusCode: statusCode,
+		remaining:  count,
+		header:     header,
+	})
+}
+
+// Requests returns all requests received by the server.
+func (s *Server) Requests() []*Request {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]*Request(nil), s.requests...)
+}
+
+// store stores the transaction and sets its timestamps, the lock has to be held.
+func (s *Server) store(trx *Transaction) {
+	now := time.Now().UTC()
+
+	if trx.CreatedAt.IsZero() {
+		trx.CreatedAt = now
+	}
+
+	trx.UpdatedAt = now
+
+	for _, tag := range trx.Tags {
+		s.tagID(tag)
+	}
+
+	s.transactions[trx.ID] = trx
+}
+
+// tagID returns the ID of the tag, creating it if necessary, the lock has to be held.
+func (s *Server) tagID(name string) int {
+	id, ok := s.tags[strings.ToLower(name)]
+	if !ok {
+		id = s.nextID()
+		s.tags[strings.ToLower(name)] = id
+	}
+
+	return id
+}
+
+// nextID generates a new unique ID, the lock has to be held.
+func (s *Server) nextID() int {
+	s.lastID++
+
+	return s.lastID
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.requests = append(s.requests, &Request{
+		Method: r.Method,
+		Path:   r.URL.Path,
+		Query:  r.URL.Query(),
+	})
+
+	for i, f := range s.failures {
+		if !strings.HasPrefix(r.URL.Path, f.pathPrefix) {
+			continue
+		}
+
+		f.remaining--
+		if f.remaining <= 0 {
+			s.failures = append(s.failures[:i], s.failures[i+1:]...)
+		}
+
+		for key, values := range f.header {
+			w.Header()[key] = values
+		}
+
+		writeError(w, f.statusCode, "Injected failure.")
+
+		return
+	}
+
+	if r.Header.Get("Authorization") != "Bearer "+AccessToken {
+		writeError(w, http.StatusUnauthorized, "Access token does not exist.")
+		return
+	}
+
+	segments := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(segments) < 2 || segments[0] != "v1" {
+		writeError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+
+	switch segments[1] {
+	case "assets":
+		s.handleAssets(w, r, segments[2:])
+	case "categories":
+		s.handleCategories(w, r, segments[2:])
+	case "transactions":
+		s.handleTransactions(w, r, segments[2:])
+	default:
+		writeError(w, http.StatusNotFound, "Not found.")
+	}
+}
+
+func (s *Server) handleAssets(w http.ResponseWriter, r *http.Request, segments []string) {
+	switch {
+	case len(segments) == 0 && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"assets": s.assets,
+		})
+	case len(segments) == 1 && r.Method == http.MethodPut:
+		assetID, _ := strconv.Atoi(segments[0])
+
+		for _, asset := range s.assets {
+			if asset.ID != assetID {
+				continue
+			}
+
+			var update lunchmoney.Asset
+
+			err := json.NewDecoder(r.Body).Decode(&update)
+			if err != nil {
+				writeError(w, http.StatusOK, err.Error())
+				return
+			}
+
+			mergeAsset(asset, &update)
+
+			writeJSON(w, http.StatusOK, asset)
+
+			return
+		}
+
+		writeError(w, http.StatusNotFound, "Asset not found.")
+	default:
+		writeError(w, http.StatusNotFound, "Not found.")
+	}
+}
+
+// mergeAsset applies all set fields of the update to the asset.
+func mergeAsset(asset, update *lunchmoney.Asset) {
+	if update.TypeName != "" {
+		asset.TypeName = update.TypeName
+	}
+
+	if update.SubtypeName != "" {
+		asset.SubtypeName = update.SubtypeName
+	}
+
+	if update.Name != "" {
+		asset.Name = update.Name
+	}
+
+	if update.Balance != nil {
+		asset.Balance = update.Balance
+
+		balanceAsOf := time.Now().UTC()
+		if update.BalanceAsOf != nil {
+			balanceAsOf = *update.BalanceAsOf
+		}
+
+		asset.BalanceAsOf = &balanceAsOf
+	}
+
+	if update.Currency != "" {
+		asset.Currency = update.Currency
+	}
+
+	if update.InstitutionName != "" {
+		asset.InstitutionName = update.InstitutionName
+	}
+}
+
+func (s *Server) handleCategories(w http.ResponseWriter, r *http.Request, segments []string) {
+	if len(segments) != 0 || r.Method != http.MethodGet {
+		writeError(w, http.StatusNotFound, "Not found.")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"categories": s.categories,
+	})
+}
+
+func (s *Server) handleTransactions(w http.ResponseWriter, r *http.Request, segments []string) {
+	switch {
+	case len(segments) == 0 && r.Method == http.MethodPost:
+		s.insertTransactions(w, r)
+	case len(segments) == 1 && segments[0] == "group" && r.Method == http.MethodPost:
+		s.createTransactionGroup(w, r)
+	case len(segments) == 0 && r.Method == http.MethodGet:
+		s.listTransactions(w, r)
+	case len(segments) == 1 && segments[0] == "group" && r.Method == http.MethodPost:
+		s.createTransactionGroup(w, r)
+	case len(segments) == 1:
+		transactionID, _ := strconv.Atoi(segments[0])
+
+		trx, ok := s.transactions[transactionID]
+		if !ok {
+			writeError(w, http.StatusNotFound, "Transaction not found.")
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, s.response(trx))
+		case http.MethodPut:
+			s.updateTransaction(w, r, trx)
+		case http.MethodDelete:
+			delete(s.transactions, transactionID)
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			writeError(w, http.StatusNotFound, "Not found.")
+		}
+	default:
+		writeError(w, http.StatusNotFound, "Not found.")
+	}
+}
+
+// listTransactions returns the transactions matching the filters of the query, ordered by date and ID.
+// Transactions which have been split are replaced by their parts, as done by the API.
+func (s *Server) listTransactions(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	startDate, endDate := query.Get("start_date"), query.Get("end_date")
+	if (startDate == "") != (endDate == "") {
+		writeError(w, http.StatusBadRequest, "Both start_date and end_date must be specified.")
+		return
+	}
+
+	if startDate == "" {
+		now := time.Now().UTC()
+		startDate = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).Format("2006-01-02")
+		endDate = time.Date(now.Year(), now.Month()+1, 0, 0, 0, 0, 0, time.UTC).Format("2006-01-02")
+	}
+
+	assetID, _ := strconv.Atoi(query.Get("asset_id"))
+	categoryID, _ := strconv.Atoi(query.Get("category_id"))
+	tagID, _ := strconv.Atoi(query.Get("tag_id"))
+	offset, _ := strconv.Atoi(query.Get("offset"))
+
+	limit, _ := strconv.Atoi(query.Get("limit"))
+	if limit <= 0 {
+		limit = DefaultLimit
+	}
+
+	matches := make([]*Transaction, 0)
+
+	for _, trx := range s.transactions {
+		if trx.HasChildren ||
+			trx.Date < startDate || trx.Date > endDate ||
+			(assetID > 0 && trx.AssetID != assetID) ||
+			(categoryID > 0 && trx.CategoryID != categoryID) ||
+			(query.Get("status") != "" && trx.Status != query.Get("status")) ||
+			(tagID > 0 && !s.hasTag(trx, tagID)) {
+			continue
+		}
+
+		matches = append(matches, trx)
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Date != matches[j].Date {
+			return matches[i].Date < matches[j].Date
+		}
+
+		return matches[i].ID < matches[j].ID
+	})
+
+	transactions := make([]*transactionResponse, 0)
+
+	for i := offset; i < len(matches) && i < offset+limit; i++ {
+		transactions = append(transactions, s.response(matches[i]))
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"transactions": transactions,
+		"has_more":     offset+limit < len(matches),
+	})
+}
+
+// hasTag returns true if the transaction has the tag with the ID.
+func (s *Server) hasTag(trx *Transaction, tagID int) bool {
+	for _, tag := range trx.Tags {
+		if s.tags[strings.ToLower(tag)] == tagID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// response converts a stored transaction to the format returned by the API.
+func (s *Server) response(trx *Transaction) *transactionResponse {
+	response := &transactionResponse{
+		Transaction: trx,
+		Tags:        make([]*lunchmoney.Tag, 0, len(trx.Tags)),
+	}
+
+	for _, tag := range trx.Tags {
+		response.Tags = append(response.Tags, &lunchmoney.Tag{
+			ID:   s.tags[strings.ToLower(tag)],
+			Name: tag,
+		})
+	}
+
+	if trx.IsGroup {
+		for _, child := range s.transactions {
+			if child.GroupID == trx.ID {
+				response.Children = append(response.Children, s.response(child))
+			}
+		}
+
+		sort.Slice(response.Children, func(i, j int) bool {
+			return response.Children[i].ID < response.Children[j].ID
+		})
+	}
+
+	return response
+}
+
+// updateTransaction replaces a transaction or splits it into multiple transactions.
+func (s *Server) updateTransaction(w http.ResponseWriter, r *http.Request, trx *Transaction) {
+	var request struct {
+		Transaction *Transaction `json:"transaction"`
+		Split       []*struct {
+			Date       string      `json:"date"`
+			Payee      string      `json:"payee"`
+			CategoryID int         `json:"category_id"`
+			Notes      string      `json:"notes"`
+			Amount     json.Number `json:"amount"`
+		} `json:"split"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil || (request.Transaction == nil && len(request.Split) == 0) {
+		writeError(w, http.StatusOK, "Invalid transaction.")
+		return
+	}
+
+	if request.Transaction != nil {
+		mergeTransaction(trx, request.Transaction)
+		s.store(trx)
+	}
+
+	if len(request.Split) == 0 {
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"updated": true,
+		})
+
+		return
+	}
+
+	if trx.HasChildren || trx.ParentID != 0 || trx.IsGroup || trx.GroupID != 0 {
+		writeError(w, http.StatusOK, "Transaction cannot be split.")
+		return
+	}
+
+	var sum money.Amount
+
+	for _, part := range request.Split {
+		amount, err := money.Parse(part.Amount.String())
+		if err != nil {
+			writeError(w, http.StatusOK, err.Error())
+			return
+		}
+
+		sum = sum.Add(amount)
+	}
+
+	total, _ := money.Parse(trx.Amount.String())
+	if !sum.Equal(total) {
+		writeError(w, http.StatusOK, "Split amounts must add up to the amount of the transaction.")
+		return
+	}
+
+	ids := make([]int, 0, len(request.Split))
+
+	for _, part := range request.Split {
+		child := *trx
+		child.ID = s.nextID()
+		child.ParentID = trx.ID
+		child.Amount = part.Amount
+		child.ExternalID = ""
+		child.CreatedAt = time.Time{}
+
+		if part.Date != "" {
+			child.Date = part.Date
+		}
+
+		if part.Payee != "" {
+			child.Payee = part.Payee
+		}
+
+		if part.CategoryID != 0 {
+			child.CategoryID = part.CategoryID
+		}
+
+		if part.Notes != "" {
+			child.Notes = part.Notes
+		}
+
+		s.store(&child)
+
+		ids = append(ids, child.ID)
+	}
+
+	trx.HasChildren = true
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"updated": true,
+		"split":   ids,
+	})
+}
+
+// mergeTransaction applies all set fields of the update to the transaction.
+func mergeTransaction(trx, update *Transaction) {
+	if update.Date != "" {
+		trx.Date = update.Date
+	}
+
+	if update.Amount != "" {
+		trx.Amount = update.Amount
+	}
+
+	if update.Currency != "" {
+		trx.Currency = update.Currency
+	}
+
+	if update.Payee != "" {
+		trx.Payee = update.Payee
+	}
+
+	if update.AssetID != 0 {
+		trx.AssetID = update.AssetID
+	}
+
+	if update.CategoryID != 0 {
+		trx.CategoryID = update.CategoryID
+	}
+
+	if update.RecurringID != 0 {
+		trx.RecurringID = update.RecurringID
+	}
+
+	if update.Notes != "" {
+		trx.Notes = update.Notes
+	}
+
+	if update.Status != "" {
+		trx.Status = update.Status
+	}
+
+	if update.ExternalID != "" {
+		trx.ExternalID = update.ExternalID
+	}
+
+	if update.Tags != nil {
+		trx.Tags = update.Tags
+	}
+}
+
+// insertTransactions stores new transactions, transactions with an external ID
+// which already exists for the same asset are skipped unless duplicates are rejected.
+func (s *Server) insertTransactions(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Transactions []*Transaction `json:"transactions"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeError(w, http.StatusOK, err.Error())
+		return
+	}
+
+	for i, trx := range request.Transactions {
+		if trx.Date == "" || trx.Amount == "" {
+			writeError(w, http.StatusOK, fmt.Sprintf("Transaction %d is missing a date or an amount.", i))
+			return
+		}
+	}
+
+	if s.RejectDuplicates {
+		for _, trx := range request.Transactions {
+			if trx.ExternalID != "" && s.hasExternalID(trx.AssetID, trx.ExternalID) {
+				writeError(w, http.StatusOK, fmt.Sprintf(
+					"Key (user_external_id, asset_id)=(%s, %d) already exists.", trx.ExternalID, trx.AssetID,
+				))
+
+				return
+			}
+		}
+	}
+
+	ids := make([]int, 0, len(request.Transactions))
+
+	for _, trx := range request.Transactions {
+		if trx.ExternalID != "" && s.hasExternalID(trx.AssetID, trx.ExternalID) {
+			continue
+		}
+
+		trx.ID = s.nextID()
+		s.store(trx)
+
+		ids = append(ids, trx.ID)
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"ids": ids,
+	})
+}
+
+// hasExternalID returns true if a transaction with the external ID exists for the asset.
+func (s *Server) hasExternalID(assetID int, externalID string) bool {
+	for _, trx := range s.transactions {
+		if trx.AssetID == assetID && trx.ExternalID == externalID {
+			return true
+		}
+	}
+
+	return false
+}
+
+// createTransactionGroup groups existing transactions and returns the ID of the group.
+func (s *Server) createTransactionGroup(w http.ResponseWriter, r *http.Request) {
+	var request struct {
+		Date         string `json:"date"`
+		Payee        string `json:"payee"`
+		CategoryID   int    `json:"category_id"`
+		Notes        string `json:"notes"`
+		Transactions []int  `json:"transactions"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		writeError(w, http.StatusOK, err.Error())
+		return
+	}
+
+	for _, transactionID := range request.Transactions {
+		trx, ok := s.transactions[transactionID]
+		if !ok || trx.GroupID != 0 {
+			writeError(w, http.StatusOK, fmt.Sprintf("Transaction %d cannot be grouped.", transactionID))
+			return
+		}
+	}
+
+	group := &Transaction{
+		ID:         s.nextID(),
+		Date:       request.Date,
+		Payee:      request.Payee,
+		CategoryID: request.CategoryID,
+		Notes:      request.Notes,
+		IsGroup:    true,
+	}
+
+	var sum money.Amount
+
+	for _, transactionID := range request.Transactions {
+		trx := s.transactions[transactionID]
+		trx.GroupID = group.ID
+
+		amount, _ := money.Parse(trx.Amount.String())
+		sum = sum.Add(amount)
+	}
+
+	group.Amount = json.Number(sum.StringFixed(4))
+	s.store(group)
+
+	writeJSON(w, http.StatusOK, group.ID)
+}
+
+// writeError writes an error in the format of the Lunchmoney API.
+func writeError(w http.ResponseWriter, statusCode int, message string) {
+	writeJSON(w, statusCode, map[string]interface{}{
+		"error": []string{message},
+	})
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	_ = json.NewEncoder(w).Encode(body)
+}
@@ -5,9 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/money"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/retry"
 	"github.com/pkg/errors"
 )
 
@@ -15,7 +19,7 @@ import (
 type Transaction struct {
 	// required parameters
 	Date   TransactionDate `json:"date"`
-	Amount float64         `json:"amount"`
+	Amount money.Amount    `json:"amount"`
 
 	// optional parameters
 	CategoryID  int               `json:"category_id,omitempty"`
@@ -38,6 +42,25 @@ func (td *TransactionDate) MarshalJSON() ([]byte, error) {
 	return res, errors.Wrap(err, "could not marshal transaction date")
 }
 
+// UnmarshalJSON provides custom unmarshalling for TransactionDate.
+func (td *TransactionDate) UnmarshalJSON(b []byte) error {
+	var value string
+
+	err := json.Unmarshal(b, &value)
+	if err != nil {
+		return errors.Wrap(err, "could not unmarshal transaction date")
+	}
+
+	date, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return errors.Wrap(err, "could not parse transaction date")
+	}
+
+	*td = TransactionDate(date)
+
+	return nil
+}
+
 // TransactionStatus represents a transaction status.
 type TransactionStatus string
 
@@ -49,7 +72,9 @@ const (
 )
 
 // InsertTransactions inserts transactions to the Lunchmoney API.
-func (c *Client) InsertTransactions(ctx context.Context, trx []*Transaction) (int, error) {
+// It returns the IDs of the inserted transactions, duplicates are not inserted.
+// An *APIError of kind ErrorKindDuplicate is returned if a transaction with the same external ID exists already.
+func (c *Client) InsertTransactions(ctx context.Context, trx []*Transaction) ([]int, error) {
 	request := struct {
 		Transactions      []*Transaction `json:"transactions"`
 		ApplyRules        bool           `json:"apply_rules"`
@@ -66,39 +91,320 @@ func (c *Client) InsertTransactions(ctx context.Context, trx []*Transaction) (in
 		SkipBalanceUpdate: false,
 	}
 
-	reqData, err := json.Marshal(request)
-	if err != nil {
-		return 0, errors.Wrap(err, "failed to marshal request")
+	// transactions are deduplicated by their external ID, inserting them again does not create duplicates
+	if hasExternalIDs(trx) {
+		ctx = retry.Idempotent(ctx)
 	}
 
-	req, err := c.createRequest(ctx, http.MethodPost, "/v1/transactions", reqData)
-	if err != nil {
-		return 0, errors.Wrap(err, "failed to create request")
+	var result struct {
+		IDs []int `json:"ids"`
+	}
+
+	err := c.call(ctx, http.MethodPost, "/v1/transactions", &request, &result, "inserting transactions")
+
+	return result.IDs, err
+}
+
+// hasExternalIDs returns true if all transactions have an external ID.
+func hasExternalIDs(trx []*Transaction) bool {
+	for _, t := range trx {
+		if t.ExternalID == "" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// UpdateTransaction updates an existing transaction in the Lunchmoney API.
+func (c *Client) UpdateTransaction(ctx context.Context, transactionID int, trx *Transaction) error {
+	request := struct {
+		Transaction       *Transaction `json:"transaction"`
+		DebitAsNegative   bool         `json:"debit_as_negative"`
+		SkipBalanceUpdate bool         `json:"skip_balance_update"`
+	}{
+		Transaction:       trx,
+		DebitAsNegative:   true,
+		SkipBalanceUpdate: false,
 	}
 
-	resp, err := c.httpClient.Do(req)
+	return c.call(ctx, http.MethodPut, fmt.Sprintf("/v1/transactions/%d", transactionID), &request, nil, "updating transaction")
+}
+
+// DeleteTransaction deletes a transaction in the Lunchmoney API.
+func (c *Client) DeleteTransaction(ctx context.Context, transactionID int) error {
+	return c.call(ctx, http.MethodDelete, fmt.Sprintf("/v1/transactions/%d", transactionID), nil, nil, "deleting transaction")
+}
+
+// TransactionGroup represents a transaction group combining multiple transactions into a single one.
+type TransactionGroup struct {
+	Date         TransactionDate `json:"date"`
+	Payee        string          `json:"payee"`
+	CategoryID   int             `json:"category_id,omitempty"`
+	Notes        string          `json:"notes,omitempty"`
+	Transactions []int           `json:"transactions"`
+}
+
+// CreateTransactionGroup groups existing transactions in the Lunchmoney API.
+// It returns the ID of the transaction group.
+func (c *Client) CreateTransactionGroup(ctx context.Context, group *TransactionGroup) (int, error) {
+	// the ID of the group is returned as a plain number, errors are returned as an object
+	var groupID int
+
+	err := c.call(ctx, http.MethodPost, "/v1/transactions/group", group, &groupID, "creating transaction group")
 	if err != nil {
-		return 0, errors.Wrap(err, "failed to make http request")
+		return 0, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		return 0, errors.Errorf("received unexpected status code when inserting transasction: %s", resp.Status)
+	return groupID, nil
+}
+
+// Tag represents a tag of a transaction.
+type Tag struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// StoredTransaction represents a transaction stored in Lunchmoney as returned by the API.
+type StoredTransaction struct {
+	ID           int               `json:"id"`
+	Date         TransactionDate   `json:"date"`
+	Payee        string            `json:"payee"`
+	OriginalName string            `json:"original_name"`
+	Amount       money.Amount      `json:"amount"`
+	Currency     string            `json:"currency"`
+	ToBase       money.Amount      `json:"to_base"`
+	Notes        string            `json:"notes"`
+	Status       TransactionStatus `json:"status"`
+	IsPending    bool              `json:"is_pending"`
+	ExternalID   string            `json:"external_id"`
+	Tags         []*Tag            `json:"tags"`
+	CreatedAt    time.Time         `json:"created_at"`
+	UpdatedAt    time.Time         `json:"updated_at"`
+
+	CategoryID        int    `json:"category_id"`
+	CategoryName      string `json:"category_name"`
+	CategoryGroupID   int    `json:"category_group_id"`
+	CategoryGroupName string `json:"category_group_name"`
+	IsIncome          bool   `json:"is_income"`
+	ExcludeFromBudget bool   `json:"exclude_from_budget"`
+	ExcludeFromTotals bool   `json:"exclude_from_totals"`
+
+	AssetID        int    `json:"asset_id"`
+	AssetName      string `json:"asset_name"`
+	PlaidAccountID int    `json:"plaid_account_id"`
+	RecurringID    int    `json:"recurring_id"`
+
+	// ParentID is the ID of the transaction this transaction has been split from.
+	ParentID int `json:"parent_id"`
+	// HasChildren is set if the transaction has been split.
+	HasChildren bool `json:"has_children"`
+	// GroupID is the ID of the transaction group containing this transaction.
+	GroupID int  `json:"group_id"`
+	IsGroup bool `json:"is_group"`
+	// Children are the transactions of a transaction group.
+	Children []*StoredTransaction `json:"children"`
+}
+
+// HasTag returns true if the transaction is tagged with the name, ignoring the case.
+func (t *StoredTransaction) HasTag(name string) bool {
+	for _, tag := range t.Tags {
+		if strings.EqualFold(tag.Name, name) {
+			return true
+		}
 	}
 
+	return false
+}
+
+// TransactionFilter limits the transactions returned by GetTransactions, zero values are not sent to the API.
+type TransactionFilter struct {
+	AssetID    int
+	CategoryID int
+	TagID      int
+	Status     TransactionStatus
+
+	// StartDate and EndDate limit the date range, the API returns the transactions of the current month
+	// if both are zero. If only one of them is set, the other one is open ended.
+	StartDate time.Time
+	EndDate   time.Time
+
+	// ExternalID is filtered by the client as the API does not support it, combine it with
+	// the asset and the date range to avoid fetching all transactions.
+	ExternalID string
+
+	// Offset and Limit paginate the transactions, a limit of zero uses the default of the API.
+	Offset int
+	Limit  int
+}
+
+func (f *TransactionFilter) query() string {
+	query := url.Values{}
+	query.Set("debit_as_negative", "true")
+
+	if f == nil {
+		return "?" + query.Encode()
+	}
+
+	if f.AssetID > 0 {
+		query.Set("asset_id", strconv.Itoa(f.AssetID))
+	}
+
+	if f.CategoryID > 0 {
+		query.Set("category_id", strconv.Itoa(f.CategoryID))
+	}
+
+	if f.TagID > 0 {
+		query.Set("tag_id", strconv.Itoa(f.TagID))
+	}
+
+	if f.Status != "" {
+		query.Set("status", string(f.Status))
+	}
+
+	// the API requires both dates if one of them is set
+	if !f.StartDate.IsZero() || !f.EndDate.IsZero() {
+		startDate, endDate := f.StartDate, f.EndDate
+
+		if startDate.IsZero() {
+			startDate = time.Date(1970, 1, 1, 0, 0, 0, 0, time.UTC)
+		}
+
+		if endDate.IsZero() {
+			endDate = time.Date(9999, 12, 31, 0, 0, 0, 0, time.UTC)
+		}
+
+		query.Set("start_date", startDate.Format("2006-01-02"))
+		query.Set("end_date", endDate.Format("2006-01-02"))
+	}
+
+	if f.Offset > 0 {
+		query.Set("offset", strconv.Itoa(f.Offset))
+	}
+
+	if f.Limit > 0 {
+		query.Set("limit", strconv.Itoa(f.Limit))
+	}
+
+	return "?" + query.Encode()
+}
+
+// TransactionPage is a page of transactions.
+type TransactionPage struct {
+	Transactions []*StoredTransaction
+	// Fetched is the number of transactions fetched from the API before filtering by the client,
+	// the offset of the next page is the offset of this page plus Fetched.
+	Fetched int
+	HasMore bool
+}
+
+// GetTransactions fetches a page of transactions matching the filter from the Lunchmoney API.
+func (c *Client) GetTransactions(ctx context.Context, filter *TransactionFilter) (*TransactionPage, error) {
 	var result struct {
-		Error []string `json:"error"`
-		IDs   []int    `json:"ids"`
+		Transactions []*StoredTransaction `json:"transactions"`
+		HasMore      bool                 `json:"has_more"`
+	}
+
+	err := c.call(ctx, http.MethodGet, "/v1/transactions"+filter.query(), nil, &result, "fetching transactions")
+	if err != nil {
+		return nil, err
+	}
+
+	page := &TransactionPage{
+		Transactions: result.Transactions,
+		Fetched:      len(result.Transactions),
+		HasMore:      result.HasMore,
+	}
+
+	if filter != nil && filter.ExternalID != "" {
+		page.Transactions = make([]*StoredTransaction, 0, 1)
+
+		for _, trx := range result.Transactions {
+			if trx.ExternalID == filter.ExternalID {
+				page.Transactions = append(page.Transactions, trx)
+			}
+		}
+	}
+
+	return page, nil
+}
+
+// GetAllTransactions fetches all transactions matching the filter by fetching all pages,
+// the offset of the filter is the offset of the first page.
+func (c *Client) GetAllTransactions(ctx context.Context, filter *TransactionFilter) ([]*StoredTransaction, error) {
+	pageFilter := TransactionFilter{}
+	if filter != nil {
+		pageFilter = *filter
+	}
+
+	var transactions []*StoredTransaction
+
+	for {
+		page, err := c.GetTransactions(ctx, &pageFilter)
+		if err != nil {
+			return nil, err
+		}
+
+		transactions = append(transactions, page.Transactions...)
+
+		if !page.HasMore || page.Fetched == 0 {
+			return transactions, nil
+		}
+
+		pageFilter.Offset += page.Fetched
 	}
+}
+
+// GetTransaction fetches a single transaction from the Lunchmoney API.
+func (c *Client) GetTransaction(ctx context.Context, transactionID int) (*StoredTransaction, error) {
+	var trx StoredTransaction
 
-	err = json.NewDecoder(resp.Body).Decode(&result)
+	err := c.call(ctx, http.MethodGet, fmt.Sprintf("/v1/transactions/%d?debit_as_negative=true", transactionID), nil, &trx, "fetching transaction")
 	if err != nil {
-		return 0, errors.Wrap(err, "failed to decode response body")
+		return nil, err
 	}
 
-	if len(result.Error) > 0 {
-		return len(result.IDs), fmt.Errorf("received %d errors: %q", len(result.Error), strings.Join(result.Error, "; "))
+	return &trx, nil
+}
+
+// Split is a part of a transaction which is split into multiple transactions.
+// The amounts of all parts have to add up to the amount of the split transaction.
+type Split struct {
+	Amount money.Amount `json:"amount"`
+
+	// optional parameters, the values of the split transaction are used if they are empty
+	Date       *TransactionDate `json:"date,omitempty"`
+	Payee      string           `json:"payee,omitempty"`
+	CategoryID int              `json:"category_id,omitempty"`
+	Notes      string           `json:"notes,omitempty"`
+}
+
+// SplitTransaction splits an existing transaction in the Lunchmoney API into the parts.
+// It returns the IDs of the transactions created for the parts.
+func (c *Client) SplitTransaction(ctx context.Context, transactionID int, split []*Split) ([]int, error) {
+	if len(split) < 2 {
+		return nil, errors.New("a transaction has to be split into at least two parts")
+	}
+
+	request := struct {
+		Split           []*Split `json:"split"`
+		DebitAsNegative bool     `json:"debit_as_negative"`
+	}{
+		Split:           split,
+		DebitAsNegative: true,
+	}
+
+	var result struct {
+		Split []int `json:"split"`
+	}
+
+	// splitting a transaction twice fails, a lost response must not be retried
+	ctx = retry.NotIdempotent(ctx)
+
+	err := c.call(ctx, http.MethodPut, fmt.Sprintf("/v1/transactions/%d", transactionID), &request, &result, "splitting transaction")
+	if err != nil {
+		return nil, err
 	}
 
-	return len(result.IDs), nil
+	return result.Split, nil
 }
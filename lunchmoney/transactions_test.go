@@ -0,0 +1,203 @@
+package lunchmoney_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/lunchmoney"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/lunchmoney/lunchmoneytest"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/money"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/retry"
+)
+
+func TestGetTransactions(t *testing.T) {
+	ctx := context.Background()
+
+	server := lunchmoneytest.NewServer()
+	t.Cleanup(server.Close)
+
+	client := server.Client()
+
+	server.AddTransaction(&lunchmoneytest.Transaction{
+		Date: "2021-10-01", Amount: "-12.50", Currency: "eur", Payee: "Bakery",
+		AssetID: 1, Status: "cleared", ExternalID: "trx-1", Tags: []string{"Food"},
+	})
+	server.AddTransaction(&lunchmoneytest.Transaction{
+		Date: "2021-10-02", Amount: "-20", Currency: "eur", Payee: "Bookshop",
+		AssetID: 1, Status: "uncleared", ExternalID: "trx-2",
+	})
+	server.AddTransaction(&lunchmoneytest.Transaction{
+		Date: "2021-10-03", Amount: "1000", Currency: "eur", Payee: "Employer",
+		AssetID: 2, Status: "uncleared", ExternalID: "trx-3",
+	})
+	server.AddTransaction(&lunchmoneytest.Transaction{
+		Date: "2021-11-01", Amount: "-5", Currency: "eur", Payee: "Kiosk",
+		AssetID: 1, Status: "uncleared", ExternalID: "trx-4",
+	})
+
+	october := func(filter lunchmoney.TransactionFilter) *lunchmoney.TransactionFilter {
+		filter.StartDate = time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+		filter.EndDate = time.Date(2021, 10, 31, 0, 0, 0, 0, time.UTC)
+
+		return &filter
+	}
+
+	tests := []struct {
+		name    string
+		filter  *lunchmoney.TransactionFilter
+		want    []string
+		hasMore bool
+	}{
+		{"date range", october(lunchmoney.TransactionFilter{}), []string{"trx-1", "trx-2", "trx-3"}, false},
+		{"open end", &lunchmoney.TransactionFilter{StartDate: time.Date(2021, 10, 2, 0, 0, 0, 0, time.UTC)}, []string{"trx-2", "trx-3", "trx-4"}, false},
+		{"asset", october(lunchmoney.TransactionFilter{AssetID: 1}), []string{"trx-1", "trx-2"}, false},
+		{"status", october(lunchmoney.TransactionFilter{Status: lunchmoney.TransactionStatusCleared}), []string{"trx-1"}, false},
+		{"tag", october(lunchmoney.TransactionFilter{TagID: server.TagID("food")}), []string{"trx-1"}, false},
+		{"external ID", october(lunchmoney.TransactionFilter{ExternalID: "trx-2"}), []string{"trx-2"}, false},
+		{"pagination", october(lunchmoney.TransactionFilter{Offset: 1, Limit: 1}), []string{"trx-2"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := client.GetTransactions(ctx, tt.filter)
+			if err != nil {
+				t.Fatalf("failed to get transactions: %v", err)
+			}
+
+			if got := externalIDs(page.Transactions); !equalStrings(got, tt.want) || page.HasMore != tt.hasMore {
+				t.Errorf("got %v (has more %t), want %v (has more %t)", got, page.HasMore, tt.want, tt.hasMore)
+			}
+		})
+	}
+
+	all, err := client.GetAllTransactions(ctx, october(lunchmoney.TransactionFilter{Limit: 2}))
+	if err != nil {
+		t.Fatalf("failed to get all transactions: %v", err)
+	}
+
+	if got := externalIDs(all); !equalStrings(got, []string{"trx-1", "trx-2", "trx-3"}) {
+		t.Errorf("unexpected transactions of all pages: %v", got)
+	}
+
+	trx := all[0]
+	if trx.Amount.String() != "-12.50" || time.Time(trx.Date).Format("2006-01-02") != "2021-10-01" ||
+		!trx.HasTag("food") || trx.Status != lunchmoney.TransactionStatusCleared {
+		t.Errorf("unexpected transaction: %+v", trx)
+	}
+}
+
+func TestSplitTransaction(t *testing.T) {
+	ctx := context.Background()
+
+	server := lunchmoneytest.NewServer()
+	t.Cleanup(server.Close)
+
+	client := server.Client()
+
+	parent := server.AddTransaction(&lunchmoneytest.Transaction{
+		Date: "2021-10-01", Amount: "-30", Currency: "eur", Payee: "Supermarket", AssetID: 1,
+	})
+
+	_, err := client.SplitTransaction(ctx, parent.ID, []*lunchmoney.Split{
+		{Amount: money.MustParse("-10")},
+		{Amount: money.MustParse("-10")},
+	})
+	if err == nil {
+		t.Fatal("expected an error if the amounts do not add up")
+	}
+
+	ids, err := client.SplitTransaction(ctx, parent.ID, []*lunchmoney.Split{
+		{Amount: money.MustParse("-10"), Notes: "Household"},
+		{Amount: money.MustParse("-20")},
+	})
+	if err != nil {
+		t.Fatalf("failed to split transaction: %v", err)
+	}
+
+	if len(ids) != 2 {
+		t.Fatalf("expected 2 transactions, got %v", ids)
+	}
+
+	stored, err := client.GetTransaction(ctx, parent.ID)
+	if err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+
+	if !stored.HasChildren {
+		t.Errorf("expected the transaction to be split: %+v", stored)
+	}
+
+	child, err := client.GetTransaction(ctx, ids[0])
+	if err != nil {
+		t.Fatalf("failed to get transaction: %v", err)
+	}
+
+	if child.ParentID != parent.ID || child.Amount.String() != "-10" || child.Notes != "Household" || child.Payee != "Supermarket" {
+		t.Errorf("unexpected part: %+v", child)
+	}
+
+	_, err = client.GetTransaction(ctx, 12345)
+	if !lunchmoney.IsKind(err, lunchmoney.ErrorKindNotFound) {
+		t.Errorf("expected a not found error, got %v", err)
+	}
+}
+
+func TestSplitTransactionNotRetried(t *testing.T) {
+	ctx := context.Background()
+
+	server := lunchmoneytest.NewServer()
+	t.Cleanup(server.Close)
+
+	httpClient := server.Server.Client()
+	httpClient.Transport = &retry.Transport{
+		Base:       httpClient.Transport,
+		MaxRetries: 3,
+	}
+
+	client := lunchmoney.NewClient(lunchmoneytest.AccessToken, httpClient, lunchmoney.WithBaseURL(server.URL))
+
+	parent := server.AddTransaction(&lunchmoneytest.Transaction{
+		Date: "2021-10-01", Amount: "-30", Currency: "eur", Payee: "Supermarket", AssetID: 1,
+	})
+
+	// the split may have been applied although the response is lost
+	server.Fail("/v1/transactions/", http.StatusBadGateway, 1)
+
+	_, err := client.SplitTransaction(ctx, parent.ID, []*lunchmoney.Split{
+		{Amount: money.MustParse("-10")},
+		{Amount: money.MustParse("-20")},
+	})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+
+	if requests := server.Requests(); len(requests) != 1 {
+		t.Errorf("expected the split not to be retried, got %d requests", len(requests))
+	}
+}
+
+func externalIDs(transactions []*lunchmoney.StoredTransaction) []string {
+	ids := make([]string, 0, len(transactions))
+
+	for _, trx := range transactions {
+		ids = append(ids, trx.ExternalID)
+	}
+
+	return ids
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -3,11 +3,16 @@ package main
 import (
 	"context"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/Seklfreak/nordigen-lunchmoney-sync/lunchmoney"
 	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
-	"github.com/kelseyhightower/envconfig"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen/nordigencache"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/retry"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/state"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -15,20 +20,27 @@ import (
 
 func main() {
 	// parse config
-	var config struct {
-		Nordigen               *nordigen.Config `envconfig:"NORDIGEN" required:"true"`
-		NordigenRequisitionIDs []string         `envconfig:"NORDIGEN_REQUISITION_IDS"`
-
-		LunchmoneyAccessToken string `envconfig:"LUNCHMONEY_ACCESS_TOKEN" required:"true"`
-
-		TransactionsMap map[string]int `envconfig:"TRANSACTIONS_MAP"` // map[nordigenAccountID]lunchmoneyAssetID
-		BalancesMap     map[string]int `envconfig:"BALANCES_MAP"`     // map[nordigenAccountID]lunchmoneyAssetID
+	config, err := loadConfig()
+	if err != nil {
+		panic(errors.Wrap(err, "failed to load config"))
+	}
 
-		Debug bool `envconfig:"DEBUG"`
+	command := ""
+	if len(os.Args) > 1 {
+		command = os.Args[1]
 	}
-	err := envconfig.Process("", &config)
+
+	err = config.validateNordigenCredentials()
 	if err != nil {
-		panic(errors.Wrap(err, "failed to process config"))
+		panic(errors.Wrap(err, "invalid config"))
+	}
+
+	// connecting bank accounts and checking their status does not require Lunchmoney
+	if command != "connect" && command != "status" {
+		err = config.validateLunchmoneyCredentials()
+		if err != nil {
+			panic(errors.Wrap(err, "invalid config"))
+		}
 	}
 
 	// init logger
@@ -45,31 +57,98 @@ func main() {
 	zap.ReplaceGlobals(log)
 
 	// create Nordigen client
+	var nordigenOpts []nordigen.Option
+	if config.NordigenBaseURL != "" {
+		nordigenOpts = append(nordigenOpts, nordigen.WithBaseURL(config.NordigenBaseURL))
+	}
+
 	nordigenClient, err := nordigen.NewClient(
 		config.Nordigen,
-		&http.Client{
-			Timeout: 60 * time.Second,
-		},
+		newHTTPClient("nordigen", log),
+		nordigenOpts...,
 	)
 	if err != nil {
 		log.Fatal("failed to create nordigen client", zap.Error(err))
 	}
 
 	// create Lunchmoney client
+	var lunchmoneyOpts []lunchmoney.Option
+	if config.LunchmoneyBaseURL != "" {
+		lunchmoneyOpts = append(lunchmoneyOpts, lunchmoney.WithBaseURL(config.LunchmoneyBaseURL))
+	}
+
 	lunchmoneyClient := lunchmoney.NewClient(
 		config.LunchmoneyAccessToken,
-		&http.Client{
-			Timeout: 60 * time.Second,
-		},
+		newHTTPClient("lunchmoney", log),
+		lunchmoneyOpts...,
 	)
 
-	ctx := context.Background()
+	// create state store, without a state file every run is a full sync
+	var store state.Store = state.NewMemoryStore()
+	if config.StateFile != "" {
+		store, err = state.NewFileStore(config.StateFile)
+		if err != nil {
+			log.Fatal("failed to create state store", zap.Error(err))
+		}
+	}
+
+	// cancel running syncs on SIGINT and SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if command == "connect" {
+		err = connect(ctx, os.Args[2:], os.Stdin, os.Stdout, nordigenClient, log)
+		if err != nil {
+			log.Fatal("failed to connect bank account", zap.Error(err))
+		}
+
+		return
+	}
+
+	checker := &expiryChecker{
+		nordigenClient: nordigenClient,
+		store:          store,
+		warningDays:    config.ExpiryWarningDays,
+		redirect:       config.ReauthRedirect,
+		dryRun:         config.DryRun,
+		log:            log,
+	}
+
+	if command == "status" {
+		err = printStatus(ctx, os.Args[2:], os.Stdout, config.NordigenRequisitionIDs, checker)
+		if err != nil {
+			log.Fatal("failed to print status", zap.Error(err))
+		}
+
+		return
+	}
+
+	// cache account details and balances to save requests of the rate limits
+	var cachedNordigenClient nordigenAPI = nordigenClient
+	if config.NordigenCacheDir != "" {
+		cacheOpts := []nordigencache.Option{
+			nordigencache.WithBypass(config.NordigenCacheBypass),
+		}
+
+		if config.NordigenCacheDetailsTTL != 0 {
+			cacheOpts = append(cacheOpts, nordigencache.WithDetailsTTL(config.NordigenCacheDetailsTTL))
+		}
+
+		if config.NordigenCacheBalancesTTL != 0 {
+			cacheOpts = append(cacheOpts, nordigencache.WithBalancesTTL(config.NordigenCacheBalancesTTL))
+		}
+
+		cachedNordigenClient, err = nordigencache.New(nordigenClient, config.NordigenCacheDir, cacheOpts...)
+		if err != nil {
+			log.Fatal("failed to create nordigen cache", zap.Error(err))
+		}
+	}
 
 	// print accounts if there is no mapping
-	if len(config.TransactionsMap) == 0 && len(config.BalancesMap) == 0 {
+	if len(config.Accounts) == 0 {
 		log.Info("no mapping found, printing accounts")
 
-		err = printAccounts(ctx, config.NordigenRequisitionIDs, nordigenClient, lunchmoneyClient, log)
+		err = printAccounts(ctx, config.NordigenRequisitionIDs, cachedNordigenClient, lunchmoneyClient, log)
 		if err != nil {
 			log.Fatal("failed to print accounts", zap.Error(err))
 		}
@@ -77,39 +156,100 @@ func main() {
 		return
 	}
 
-	for nordigenAccountID, lunchmoneyAssetID := range config.TransactionsMap {
-		err = syncAccount(
-			ctx,
-			nordigenAccountID,
-			lunchmoneyAssetID,
-			nordigenClient,
-			lunchmoneyClient,
-			log,
-		)
+	s := &syncer{
+		accounts:         config.Accounts,
+		nordigenClient:   cachedNordigenClient,
+		lunchmoneyClient: lunchmoneyClient,
+		store:            store,
+		log:              log,
+		ruleSet:          config.ruleSet,
+		quota: &quotaGuard{
+			spread: config.NordigenSpreadRequests,
+		},
+
+		detectTransfers:   config.DetectTransfers,
+		transfersTag:      config.TransfersTag,
+		transfersCategory: config.TransfersCategory,
+		transfersGroup:    config.TransfersGroup,
+
+		expiryChecker: checker,
+		reauthLinks:   config.ReauthLinks,
+	}
+
+	// collect changes instead of writing them to Lunchmoney and the state store
+	if config.DryRun {
+		if config.DryRunFormat != dryRunFormatTable && config.DryRunFormat != dryRunFormatJSON {
+			log.Fatal("unknown dry run format", zap.String("format", config.DryRunFormat))
+		}
+
+		s.dryRun = &dryRunReport{}
+		s.dryRunFormat = config.DryRunFormat
+		s.dryRunOutput = os.Stdout
+		s.lunchmoneyClient = &dryRunClient{
+			Client: lunchmoneyClient,
+			report: s.dryRun,
+		}
+		s.store = &dryRunStore{
+			Store: store,
+		}
+	}
+
+	switch command {
+	case "":
+		err = s.run(ctx)
 		if err != nil {
-			log.Fatal("failure syncing transactions",
-				zap.String("nordigen_account_id", nordigenAccountID),
-				zap.Int("lunchmoney_asset_id", lunchmoneyAssetID),
-				zap.Error(err),
-			)
-		}
-	}
-
-	for nordigenAccountID, lunchmoneyAssetID := range config.BalancesMap {
-		err = syncBalance(
-			ctx,
-			nordigenAccountID,
-			lunchmoneyAssetID,
-			nordigenClient,
-			lunchmoneyClient,
-			log,
-		)
+			log.Error("failure syncing", zap.Error(err))
+			log.Sync()
+			os.Exit(exitCode(err))
+		}
+	case "serve":
+		sched, err := parseSchedule(config.ScheduleCron, config.ScheduleInterval)
 		if err != nil {
-			log.Fatal("failure syncing balance",
-				zap.String("nordigen_account_id", nordigenAccountID),
-				zap.Int("lunchmoney_asset_id", lunchmoneyAssetID),
-				zap.Error(err),
-			)
+			log.Fatal("failed to parse schedule", zap.Error(err))
+		}
+
+		err = serve(ctx, sched, config.ScheduleJitter, s.run, log)
+		if err != nil {
+			log.Fatal("failure serving", zap.Error(err))
+		}
+
+		log.Info("shutting down")
+	case "reconcile":
+		// fixes must not be based on cached balances, the dry run client only records them
+		err = reconcile(ctx, os.Args[2:], os.Stdout, config.Accounts, nordigenClient, s.lunchmoneyClient, log)
+
+		if s.dryRun != nil {
+			renderErr := s.dryRun.render(s.dryRunOutput, s.dryRunFormat)
+			if renderErr != nil {
+				log.Error("failed to render dry run report", zap.Error(renderErr))
+			}
 		}
+
+		if err != nil {
+			log.Error("failed to reconcile balances", zap.Error(err))
+			log.Sync()
+			os.Exit(exitCode(err))
+		}
+	default:
+		log.Fatal("unknown command", zap.String("command", command))
+	}
+}
+
+// newHTTPClient creates an HTTP client retrying requests which failed with transient errors.
+func newHTTPClient(service string, log *zap.Logger) *http.Client {
+	return &http.Client{
+		Transport: &retry.Transport{
+			Timeout: 60 * time.Second,
+			OnRetry: func(req *http.Request, attempt int, wait time.Duration, reason error) {
+				log.Warn("request failed, retrying",
+					zap.String("service", service),
+					zap.String("method", req.Method),
+					zap.String("path", req.URL.Path),
+					zap.Int("attempt", attempt),
+					zap.Duration("wait", wait),
+					zap.Error(reason),
+				)
+			},
+		},
 	}
 }
@@ -0,0 +1,145 @@
+package money
+
+import (
+	"bytes"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/shopspring/decimal"
+)
+
+// Amount is an exact decimal amount of money, the zero value is zero.
+// The precision of parsed amounts is kept, e.g. "12.50" is formatted as "12.50".
+type Amount struct {
+	d decimal.Decimal
+}
+
+// Parse parses an amount like "-12.50".
+func Parse(value string) (Amount, error) {
+	d, err := decimal.NewFromString(strings.TrimSpace(value))
+	if err != nil {
+		return Amount{}, errors.Wrapf(err, "could not parse amount %q", value)
+	}
+
+	return Amount{d: d}, nil
+}
+
+// MustParse is like Parse but panics if the amount is invalid.
+func MustParse(value string) Amount {
+	amount, err := Parse(value)
+	if err != nil {
+		panic(err)
+	}
+
+	return amount
+}
+
+// New returns the amount value * 10^exp, e.g. New(-1250, -2) is -12.50.
+func New(value int64, exp int32) Amount {
+	return Amount{d: decimal.New(value, exp)}
+}
+
+// Add returns a + b.
+func (a Amount) Add(b Amount) Amount {
+	return Amount{d: a.d.Add(b.d)}
+}
+
+// Sub returns a - b.
+func (a Amount) Sub(b Amount) Amount {
+	return Amount{d: a.d.Sub(b.d)}
+}
+
+// Neg returns -a.
+func (a Amount) Neg() Amount {
+	return Amount{d: a.d.Neg()}
+}
+
+// Abs returns the absolute amount.
+func (a Amount) Abs() Amount {
+	return Amount{d: a.d.Abs()}
+}
+
+// Cmp returns -1 if a < b, 0 if a == b and +1 if a > b.
+func (a Amount) Cmp(b Amount) int {
+	return a.d.Cmp(b.d)
+}
+
+// Equal returns true if both amounts have the same value regardless of their precision.
+func (a Amount) Equal(b Amount) bool {
+	return a.d.Equal(b.d)
+}
+
+// IsZero returns true if the amount is zero.
+func (a Amount) IsZero() bool {
+	return a.d.IsZero()
+}
+
+// IsNegative returns true if the amount is less than zero.
+func (a Amount) IsNegative() bool {
+	return a.d.IsNegative()
+}
+
+// IsPositive returns true if the amount is greater than zero.
+func (a Amount) IsPositive() bool {
+	return a.d.IsPositive()
+}
+
+// Round rounds the amount half away from zero to the minor unit of the currency.
+func (a Amount) Round(currency string) Amount {
+	return Amount{d: a.d.Round(Decimals(currency))}
+}
+
+// Format formats the amount with the number of decimal places of the currency.
+func (a Amount) Format(currency string) string {
+	return a.d.StringFixed(Decimals(currency))
+}
+
+// StringFixed formats the amount with a fixed number of decimal places, rounding it if necessary.
+func (a Amount) StringFixed(places int32) string {
+	return a.d.StringFixed(places)
+}
+
+// Places returns the number of decimal places of the amount.
+func (a Amount) Places() int32 {
+	if exp := a.d.Exponent(); exp < 0 {
+		return -exp
+	}
+
+	return 0
+}
+
+// String formats the amount with its own precision.
+func (a Amount) String() string {
+	return a.d.StringFixed(a.Places())
+}
+
+// MarshalText encodes the amount as a decimal string.
+func (a Amount) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// UnmarshalText parses a decimal string.
+func (a *Amount) UnmarshalText(text []byte) error {
+	amount, err := Parse(string(text))
+	if err != nil {
+		return err
+	}
+
+	*a = amount
+
+	return nil
+}
+
+// MarshalJSON encodes the amount as a JSON string to keep its precision.
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + a.String() + `"`), nil
+}
+
+// UnmarshalJSON decodes an amount from a JSON string or number.
+func (a *Amount) UnmarshalJSON(b []byte) error {
+	if bytes.Equal(b, []byte("null")) {
+		return nil
+	}
+
+	return a.UnmarshalText(bytes.Trim(b, `"`))
+}
@@ -0,0 +1,99 @@
+package money
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestAmount(t *testing.T) {
+	tests := []struct {
+		value      string
+		currency   string
+		wantString string
+		wantFormat string
+	}{
+		{value: "-12.50", currency: "EUR", wantString: "-12.50", wantFormat: "-12.50"},
+		{value: "-12.5", currency: "EUR", wantString: "-12.5", wantFormat: "-12.50"},
+		{value: "0.1", currency: "EUR", wantString: "0.1", wantFormat: "0.10"},
+		{value: "1000", currency: "JPY", wantString: "1000", wantFormat: "1000"},
+		{value: "1000.00", currency: "jpy", wantString: "1000.00", wantFormat: "1000"},
+		{value: "1.2345", currency: "KWD", wantString: "1.2345", wantFormat: "1.235"},
+		{value: "-1.2345", currency: "KWD", wantString: "-1.2345", wantFormat: "-1.235"},
+		{value: "12345678901234567.89", currency: "EUR", wantString: "12345678901234567.89", wantFormat: "12345678901234567.89"},
+	}
+
+	for _, tt := range tests {
+		amount, err := Parse(tt.value)
+		if err != nil {
+			t.Fatalf("failed to parse %q: %v", tt.value, err)
+		}
+
+		if got := amount.String(); got != tt.wantString {
+			t.Errorf("expected %q to be formatted as %q, got %q", tt.value, tt.wantString, got)
+		}
+
+		if got := amount.Format(tt.currency); got != tt.wantFormat {
+			t.Errorf("expected %q to be formatted as %q in %s, got %q", tt.value, tt.wantFormat, tt.currency, got)
+		}
+
+		if got := amount.Round(tt.currency).String(); got != tt.wantFormat {
+			t.Errorf("expected %q to be rounded to %q in %s, got %q", tt.value, tt.wantFormat, tt.currency, got)
+		}
+	}
+
+	_, err := Parse("12,50")
+	if err == nil {
+		t.Error("expected an error for an invalid amount")
+	}
+}
+
+func TestAmountArithmetic(t *testing.T) {
+	// 0.1 + 0.2 is not 0.3 with floating point numbers
+	sum := MustParse("0.1").Add(MustParse("0.2"))
+	if !sum.Equal(MustParse("0.30")) {
+		t.Errorf("expected 0.1 + 0.2 to equal 0.30, got %s", sum)
+	}
+
+	if !MustParse("-42.10").Add(MustParse("42.1")).IsZero() {
+		t.Error("expected opposite amounts to add up to zero")
+	}
+
+	if got := MustParse("100").Sub(MustParse("99.99")).String(); got != "0.01" {
+		t.Errorf("expected 100 - 99.99 to be 0.01, got %s", got)
+	}
+
+	if MustParse("-1").Cmp(MustParse("1")) >= 0 || !MustParse("-1").IsNegative() || !MustParse("-1").Neg().IsPositive() {
+		t.Error("unexpected comparison of negative amounts")
+	}
+}
+
+func TestAmountJSON(t *testing.T) {
+	var values struct {
+		String Amount  `json:"string"`
+		Number Amount  `json:"number"`
+		Null   *Amount `json:"null"`
+	}
+
+	err := json.Unmarshal([]byte(`{"string":"-12.50","number":1234.5600,"null":null}`), &values)
+	if err != nil {
+		t.Fatalf("failed to unmarshal amounts: %v", err)
+	}
+
+	if values.String.String() != "-12.50" || values.Number.String() != "1234.5600" || values.Null != nil {
+		t.Errorf("unexpected amounts: %+v", values)
+	}
+
+	data, err := json.Marshal(values)
+	if err != nil {
+		t.Fatalf("failed to marshal amounts: %v", err)
+	}
+
+	if want := `{"string":"-12.50","number":"1234.5600","null":null}`; string(data) != want {
+		t.Errorf("expected %s, got %s", want, data)
+	}
+
+	err = json.Unmarshal([]byte(`{"string":"abc"}`), &values)
+	if err == nil {
+		t.Error("expected an error for an invalid amount")
+	}
+}
@@ -0,0 +1,49 @@
+package money
+
+import (
+	"strings"
+)
+
+// defaultDecimals is the number of decimal places of currencies not listed in currencyDecimals.
+const defaultDecimals = 2
+
+// currencyDecimals are the ISO 4217 currencies whose minor unit is not a hundredth.
+var currencyDecimals = map[string]int32{
+	"BIF": 0,
+	"CLP": 0,
+	"DJF": 0,
+	"GNF": 0,
+	"ISK": 0,
+	"JPY": 0,
+	"KMF": 0,
+	"KRW": 0,
+	"PYG": 0,
+	"RWF": 0,
+	"UGX": 0,
+	"UYI": 0,
+	"VND": 0,
+	"VUV": 0,
+	"XAF": 0,
+	"XOF": 0,
+	"XPF": 0,
+
+	"BHD": 3,
+	"IQD": 3,
+	"JOD": 3,
+	"KWD": 3,
+	"LYD": 3,
+	"OMR": 3,
+	"TND": 3,
+
+	"CLF": 4,
+	"UYW": 4,
+}
+
+// Decimals returns the number of decimal places of a currency code, two are used for unknown currencies.
+func Decimals(currency string) int32 {
+	if decimals, ok := currencyDecimals[strings.ToUpper(strings.TrimSpace(currency))]; ok {
+		return decimals
+	}
+
+	return defaultDecimals
+}
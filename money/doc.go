@@ -0,0 +1,4 @@
+/*
+Package money represents monetary amounts as exact decimals instead of floating point numbers.
+*/
+package money
@@ -2,12 +2,9 @@ package nordigen
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
-
-	"github.com/pkg/errors"
 )
 
 // Account represents an account.
@@ -26,40 +23,13 @@ type Account struct {
 
 // GetAccountDetails fetches details for an account.
 func (c *Client) GetAccountDetails(ctx context.Context, accountID string) (*Account, error) {
-	req, err := http.NewRequestWithContext(
-		ctx,
-		http.MethodGet,
-		fmt.Sprintf("%s/accounts/%s/details/", baseURL, accountID),
-		nil,
-	)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to create http request")
-	}
-
-	req.Header.Add("Content-Type", "application/json; charset=utf-8")
-	req.Header.Add("Authorization", "Bearer "+c.accessKey)
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to make http request")
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		if err := extractError(resp); err != nil {
-			return nil, errors.Wrap(err, "failed to fetch account details")
-		}
-
-		return nil, errors.Errorf("received unexpected status code when fetching account details: %s", resp.Status)
-	}
-
 	var account struct {
 		Account *Account `json:"account"`
 	}
 
-	err = json.NewDecoder(resp.Body).Decode(&account)
+	err := c.call(ctx, http.MethodGet, fmt.Sprintf("/accounts/%s/details/", accountID), nil, &account, "fetching account details")
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to decode response body")
+		return nil, err
 	}
 
 	return account.Account, nil
@@ -75,40 +45,13 @@ type Balance struct {
 
 // GetAccountBalances fetches the balances for an account.
 func (c *Client) GetAccountBalances(ctx context.Context, accountID string) ([]*Balance, error) {
-	req, err := http.NewRequestWithContext(
-		ctx,
-		http.MethodGet,
-		fmt.Sprintf("%s/accounts/%s/balances/", baseURL, accountID),
-		nil,
-	)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to create http request")
-	}
-
-	req.Header.Add("Content-Type", "application/json; charset=utf-8")
-	req.Header.Add("Authorization", "Bearer "+c.accessKey)
-
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to make http request")
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		if err := extractError(resp); err != nil {
-			return nil, errors.Wrap(err, "failed to fetch account balances")
-		}
-
-		return nil, errors.Errorf("received unexpected status code when fetching account balances: %s", resp.Status)
-	}
-
 	var balances struct {
 		Balances []*Balance `json:"balances"`
 	}
 
-	err = json.NewDecoder(resp.Body).Decode(&balances)
+	err := c.call(ctx, http.MethodGet, fmt.Sprintf("/accounts/%s/balances/", accountID), nil, &balances, "fetching account balances")
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to decode response body")
+		return nil, err
 	}
 
 	return balances.Balances, nil
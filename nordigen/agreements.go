@@ -0,0 +1,116 @@
+package nordigen
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Access scopes of an end user agreement.
+const (
+	AccessScopeBalances     = "balances"
+	AccessScopeDetails      = "details"
+	AccessScopeTransactions = "transactions"
+)
+
+// Agreement represents an end user agreement, it defines the access to the accounts of a requisition.
+type Agreement struct {
+	ID                 string     `json:"id"`
+	Created            time.Time  `json:"created"`
+	InstitutionID      string     `json:"institution_id"`
+	MaxHistoricalDays  int        `json:"max_historical_days"`
+	AccessValidForDays int        `json:"access_valid_for_days"`
+	AccessScope        []string   `json:"access_scope"`
+	Accepted           *time.Time `json:"accepted"`
+}
+
+// ExpiresAt returns the time the access granted by the agreement expires.
+// The access is valid from the time the agreement was accepted, or created if it has not been accepted yet.
+func (a *Agreement) ExpiresAt() time.Time {
+	start := a.Created
+	if a.Accepted != nil && !a.Accepted.IsZero() {
+		start = *a.Accepted
+	}
+
+	return start.AddDate(0, 0, a.AccessValidForDays)
+}
+
+// AgreementRequest contains the parameters to create an end user agreement.
+// Zero values use the defaults of the API (90 days of history, valid for 90 days, all scopes).
+type AgreementRequest struct {
+	InstitutionID      string   `json:"institution_id"`
+	MaxHistoricalDays  int      `json:"max_historical_days,omitempty"`
+	AccessValidForDays int      `json:"access_valid_for_days,omitempty"`
+	AccessScope        []string `json:"access_scope,omitempty"`
+}
+
+// CreateAgreement creates an end user agreement which can be passed when creating a requisition.
+func (c *Client) CreateAgreement(ctx context.Context, agreementRequest *AgreementRequest) (*Agreement, error) {
+	var agreement Agreement
+
+	err := c.call(ctx, http.MethodPost, "/agreements/enduser/", agreementRequest, &agreement, "creating agreement")
+	if err != nil {
+		return nil, err
+	}
+
+	return &agreement, nil
+}
+
+// GetAgreement fetches an end user agreement.
+func (c *Client) GetAgreement(ctx context.Context, agreementID string) (*Agreement, error) {
+	var agreement Agreement
+
+	err := c.call(ctx, http.MethodGet, fmt.Sprintf("/agreements/enduser/%s/", agreementID), nil, &agreement, "fetching agreement")
+	if err != nil {
+		return nil, err
+	}
+
+	return &agreement, nil
+}
+
+// AgreementPage represents a page of end user agreements.
+type AgreementPage struct {
+	Count    int          `json:"count"`
+	Next     string       `json:"next"`
+	Previous string       `json:"previous"`
+	Results  []*Agreement `json:"results"`
+}
+
+// ListAgreements fetches a page of end user agreements, a limit of zero uses the default page size.
+func (c *Client) ListAgreements(ctx context.Context, limit, offset int) (*AgreementPage, error) {
+	var page AgreementPage
+
+	err := c.call(ctx, http.MethodGet, "/agreements/enduser/"+listQuery(limit, offset), nil, &page, "fetching agreements")
+	if err != nil {
+		return nil, err
+	}
+
+	return &page, nil
+}
+
+// DeleteAgreement deletes an end user agreement.
+func (c *Client) DeleteAgreement(ctx context.Context, agreementID string) error {
+	return c.call(ctx, http.MethodDelete, fmt.Sprintf("/agreements/enduser/%s/", agreementID), nil, nil, "deleting agreement")
+}
+
+// AcceptAgreement accepts an end user agreement on behalf of the end user.
+// This is only required if the end user does not accept the agreement on the bank authentication pages.
+func (c *Client) AcceptAgreement(ctx context.Context, agreementID, userAgent, ipAddress string) (*Agreement, error) {
+	reqBody := struct {
+		UserAgent string `json:"user_agent"`
+		IPAddress string `json:"ip_address"`
+	}{
+		UserAgent: userAgent,
+		IPAddress: ipAddress,
+	}
+
+	var agreement Agreement
+
+	err := c.call(ctx, http.MethodPut, fmt.Sprintf("/agreements/enduser/%s/accept/", agreementID), reqBody, &agreement, "accepting agreement")
+	if err != nil {
+		return nil, err
+	}
+
+	return &agreement, nil
+}
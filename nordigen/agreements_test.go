@@ -0,0 +1,93 @@
+package nordigen_test
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"github.com/pkg/errors"
+)
+
+func TestAgreements(t *testing.T) {
+	ctx := context.Background()
+	_, client := newTestClient(t)
+
+	agreement, err := client.CreateAgreement(ctx, &nordigen.AgreementRequest{
+		InstitutionID:      "BANK",
+		MaxHistoricalDays:  540,
+		AccessValidForDays: 30,
+		AccessScope:        []string{nordigen.AccessScopeBalances},
+	})
+	if err != nil {
+		t.Fatalf("failed to create agreement: %v", err)
+	}
+
+	if agreement.ID == "" || agreement.InstitutionID != "BANK" || agreement.MaxHistoricalDays != 540 ||
+		agreement.AccessValidForDays != 30 || !reflect.DeepEqual(agreement.AccessScope, []string{nordigen.AccessScopeBalances}) ||
+		agreement.Accepted != nil {
+		t.Errorf("unexpected agreement %+v", agreement)
+	}
+
+	if want := agreement.Created.AddDate(0, 0, 30); !agreement.ExpiresAt().Equal(want) {
+		t.Errorf("expected an unaccepted agreement to expire at %s, got %s", want, agreement.ExpiresAt())
+	}
+
+	accepted, err := client.AcceptAgreement(ctx, agreement.ID, "Mozilla/5.0", "127.0.0.1")
+	if err != nil {
+		t.Fatalf("failed to accept agreement: %v", err)
+	}
+
+	if accepted.Accepted == nil {
+		t.Fatalf("expected the agreement to be accepted, got %+v", accepted)
+	}
+
+	if want := accepted.Accepted.AddDate(0, 0, 30); !accepted.ExpiresAt().Equal(want) {
+		t.Errorf("expected an accepted agreement to expire at %s, got %s", want, accepted.ExpiresAt())
+	}
+
+	fetched, err := client.GetAgreement(ctx, agreement.ID)
+	if err != nil {
+		t.Fatalf("failed to fetch agreement: %v", err)
+	}
+
+	if fetched.ID != agreement.ID || fetched.Accepted == nil {
+		t.Errorf("expected the accepted agreement, got %+v", fetched)
+	}
+
+	page, err := client.ListAgreements(ctx, 0, 0)
+	if err != nil {
+		t.Fatalf("failed to list agreements: %v", err)
+	}
+
+	if page.Count != 1 || len(page.Results) != 1 || page.Results[0].ID != agreement.ID {
+		t.Errorf("expected the agreement to be listed, got %+v", page)
+	}
+
+	err = client.DeleteAgreement(ctx, agreement.ID)
+	if err != nil {
+		t.Fatalf("failed to delete agreement: %v", err)
+	}
+
+	_, err = client.GetAgreement(ctx, agreement.ID)
+
+	var apiErr *nordigen.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected the deleted agreement not to be found, got %v", err)
+	}
+}
+
+func TestCreateAgreementDefaults(t *testing.T) {
+	_, client := newTestClient(t)
+
+	// zero values are omitted so the API applies its defaults
+	agreement, err := client.CreateAgreement(context.Background(), &nordigen.AgreementRequest{InstitutionID: "BANK"})
+	if err != nil {
+		t.Fatalf("failed to create agreement: %v", err)
+	}
+
+	if agreement.MaxHistoricalDays != 90 || agreement.AccessValidForDays != 90 || len(agreement.AccessScope) != 3 {
+		t.Errorf("expected the defaults of the API, got %+v", agreement)
+	}
+}
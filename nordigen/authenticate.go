@@ -1,17 +1,73 @@
 package nordigen
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
+	"time"
 
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/retry"
 	"github.com/pkg/errors"
 )
 
-// authenticate fetches the access key using the Secret ID and Secret Key.
-func (c *Client) authenticate(ctx context.Context) (string, error) {
+// tokenExpiryMargin is the time before the expiry of a token at which it is renewed.
+const tokenExpiryMargin = time.Minute
+
+// accessToken returns a valid access token, renewing it if it is about to expire.
+func (c *Client) accessToken(ctx context.Context) (string, error) {
+	c.tokenLock.Lock()
+	accessKey, accessExpiresAt := c.accessKey, c.accessExpiresAt
+	c.tokenLock.Unlock()
+
+	if accessKey != "" && time.Now().Add(tokenExpiryMargin).Before(accessExpiresAt) {
+		return accessKey, nil
+	}
+
+	err := c.renewToken(ctx, accessKey)
+	if err != nil {
+		return "", err
+	}
+
+	c.tokenLock.Lock()
+	defer c.tokenLock.Unlock()
+
+	return c.accessKey, nil
+}
+
+// renewToken renews the given access token using the refresh token,
+// or by authenticating again if the refresh token has expired as well.
+// Nothing is done if the access token has already been renewed concurrently.
+func (c *Client) renewToken(ctx context.Context, staleAccessKey string) error {
+	c.renewLock.Lock()
+	defer c.renewLock.Unlock()
+
+	c.tokenLock.Lock()
+	renewed := c.accessKey != staleAccessKey
+	refreshValid := c.refreshKey != "" && time.Now().Add(tokenExpiryMargin).Before(c.refreshExpiresAt)
+	c.tokenLock.Unlock()
+
+	if renewed {
+		return nil
+	}
+
+	if refreshValid {
+		err := c.refresh(ctx)
+		if err == nil {
+			return nil
+		}
+
+		// the refresh token may have been revoked, try to authenticate again
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+			return errors.Wrap(err, "failed to refresh access token")
+		}
+	}
+
+	return c.authenticate(ctx)
+}
+
+// authenticate fetches a new access and refresh token using the Secret ID and Secret Key.
+func (c *Client) authenticate(ctx context.Context) error {
 	reqBody := struct {
 		SecretID  string `json:"secret_id"`
 		SecretKey string `json:"secret_key"`
@@ -20,45 +76,91 @@ func (c *Client) authenticate(ctx context.Context) (string, error) {
 		SecretKey: c.config.SecretKey,
 	}
 
-	reqBodyBytes, err := json.Marshal(reqBody)
+	var creds struct {
+		Access         string `json:"access"`
+		AccessExpires  int    `json:"access_expires"`
+		Refresh        string `json:"refresh"`
+		RefreshExpires int    `json:"refresh_expires"`
+	}
+
+	err := c.requestToken(ctx, "/token/new/", reqBody, &creds)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to marshal request body")
+		return errors.Wrap(err, "failed to authenticate")
 	}
 
-	req, err := http.NewRequestWithContext(
-		ctx,
-		http.MethodPost,
-		fmt.Sprintf("%s/token/new/", baseURL),
-		bytes.NewReader(reqBodyBytes),
-	)
+	now := time.Now()
+
+	c.tokenLock.Lock()
+	defer c.tokenLock.Unlock()
+
+	c.accessKey = creds.Access
+	c.accessExpiresAt = now.Add(time.Duration(creds.AccessExpires) * time.Second)
+	c.refreshKey = creds.Refresh
+	c.refreshExpiresAt = now.Add(time.Duration(creds.RefreshExpires) * time.Second)
+
+	return nil
+}
+
+// refresh fetches a new access token using the refresh token.
+func (c *Client) refresh(ctx context.Context) error {
+	c.tokenLock.Lock()
+	reqBody := struct {
+		Refresh string `json:"refresh"`
+	}{
+		Refresh: c.refreshKey,
+	}
+	c.tokenLock.Unlock()
+
+	var creds struct {
+		Access        string `json:"access"`
+		AccessExpires int    `json:"access_expires"`
+	}
+
+	err := c.requestToken(ctx, "/token/refresh/", reqBody, &creds)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to create http request")
+		return errors.Wrap(err, "failed to refresh token")
 	}
 
-	req.Header.Add("Content-Type", "application/json; charset=utf-8")
+	c.tokenLock.Lock()
+	defer c.tokenLock.Unlock()
+
+	c.accessKey = creds.Access
+	c.accessExpiresAt = time.Now().Add(time.Duration(creds.AccessExpires) * time.Second)
+
+	return nil
+}
+
+// requestToken posts the request body to a token endpoint and decodes the response into creds.
+func (c *Client) requestToken(ctx context.Context, endpoint string, reqBody interface{}, creds interface{}) error {
+	reqBodyBytes, err := json.Marshal(reqBody)
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal request body")
+	}
+
+	// requesting a token has no side effects
+	req, err := c.createRequest(retry.Idempotent(ctx), http.MethodPost, endpoint, reqBodyBytes)
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to make http request")
+		return errors.Wrap(err, "failed to make http request")
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		if err := extractError(resp); err != nil {
-			return "", errors.Wrap(err, "failed to authenticate")
+			return err
 		}
 
-		return "", errors.Errorf("received unexpected status code when authenticating: %s", resp.Status)
-	}
-
-	var creds struct {
-		Access string `json:"access"`
+		return errors.Errorf("received unexpected status code when requesting token: %s", resp.Status)
 	}
 
-	err = json.NewDecoder(resp.Body).Decode(&creds)
+	err = json.NewDecoder(resp.Body).Decode(creds)
 	if err != nil {
-		return "", errors.Wrap(err, "failed to decode response body")
+		return errors.Wrap(err, "failed to decode response body")
 	}
 
-	return creds.Access, nil
+	return nil
 }
@@ -0,0 +1,202 @@
+package nordigen_test
+
+import (
+	"context"
+	"net/http"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen/nordigentest"
+	"github.com/pkg/errors"
+)
+
+// requestPaths returns the paths of all requests received by the server in order.
+func requestPaths(server *nordigentest.Server) []string {
+	paths := make([]string, 0)
+
+	for _, req := range server.Requests() {
+		paths = append(paths, req.Path)
+	}
+
+	return paths
+}
+
+// countRequests returns the number of requests received by the server for the path.
+func countRequests(server *nordigentest.Server, path string) int {
+	var count int
+
+	for _, req := range server.Requests() {
+		if req.Path == path {
+			count++
+		}
+	}
+
+	return count
+}
+
+func TestNewClientInvalidCredentials(t *testing.T) {
+	server := nordigentest.NewServer()
+	t.Cleanup(server.Close)
+
+	_, err := nordigen.NewClient(&nordigen.Config{SecretID: "unknown", SecretKey: "unknown"}, server.Server.Client(), nordigen.WithBaseURL(server.URL))
+	if err == nil {
+		t.Fatal("expected authenticating with invalid credentials to fail")
+	}
+
+	var apiErr *nordigen.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("expected an unauthorized API error, got %v", err)
+	}
+}
+
+func TestAccessTokenRenewal(t *testing.T) {
+	tests := []struct {
+		name           string
+		accessExpires  time.Duration
+		refreshExpires time.Duration
+		prepare        func(server *nordigentest.Server)
+		want           []string
+	}{
+		{
+			name: "valid access token",
+			want: []string{"/token/new/", "/requisitions/"},
+		},
+		{
+			// tokens expiring within a minute are renewed before they are used
+			name:          "refresh ahead of expiry",
+			accessExpires: 30 * time.Second,
+			want:          []string{"/token/new/", "/token/refresh/", "/requisitions/"},
+		},
+		{
+			name:           "refresh token about to expire",
+			accessExpires:  30 * time.Second,
+			refreshExpires: 30 * time.Second,
+			want:           []string{"/token/new/", "/token/new/", "/requisitions/"},
+		},
+		{
+			name:          "refresh token revoked",
+			accessExpires: 30 * time.Second,
+			prepare:       func(server *nordigentest.Server) { server.ExpireRefreshTokens() },
+			want:          []string{"/token/new/", "/token/refresh/", "/token/new/", "/requisitions/"},
+		},
+		{
+			name:    "access token revoked",
+			prepare: func(server *nordigentest.Server) { server.ExpireAccessTokens() },
+			want:    []string{"/token/new/", "/requisitions/", "/token/refresh/", "/requisitions/"},
+		},
+		{
+			name: "access and refresh token revoked",
+			prepare: func(server *nordigentest.Server) {
+				server.ExpireAccessTokens()
+				server.ExpireRefreshTokens()
+			},
+			want: []string{"/token/new/", "/requisitions/", "/token/refresh/", "/token/new/", "/requisitions/"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := nordigentest.NewServer()
+			t.Cleanup(server.Close)
+
+			if tt.accessExpires > 0 {
+				server.AccessExpires = tt.accessExpires
+			}
+
+			if tt.refreshExpires > 0 {
+				server.RefreshExpires = tt.refreshExpires
+			}
+
+			client, err := server.Client()
+			if err != nil {
+				t.Fatalf("failed to create client: %v", err)
+			}
+
+			if tt.prepare != nil {
+				tt.prepare(server)
+			}
+
+			_, err = client.ListRequisitions(context.Background(), 0, 0)
+			if err != nil {
+				t.Fatalf("failed to list requisitions: %v", err)
+			}
+
+			if paths := requestPaths(server); !reflect.DeepEqual(paths, tt.want) {
+				t.Errorf("expected requests %v, got %v", tt.want, paths)
+			}
+		})
+	}
+}
+
+func TestAccessTokenRejectedTwice(t *testing.T) {
+	server := nordigentest.NewServer()
+	t.Cleanup(server.Close)
+
+	client, err := server.Client()
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	server.Fail("/requisitions/", http.StatusUnauthorized, 3)
+
+	_, err = client.ListRequisitions(context.Background(), 0, 0)
+
+	var apiErr *nordigen.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Fatalf("expected an unauthorized API error, got %v", err)
+	}
+
+	// the request is only retried once with the renewed token
+	want := []string{"/token/new/", "/requisitions/", "/token/refresh/", "/requisitions/"}
+	if paths := requestPaths(server); !reflect.DeepEqual(paths, want) {
+		t.Errorf("expected requests %v, got %v", want, paths)
+	}
+}
+
+func TestAccessTokenConcurrentRenewal(t *testing.T) {
+	const callers = 10
+
+	server := nordigentest.NewServer()
+	t.Cleanup(server.Close)
+
+	client, err := server.Client()
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	server.ExpireAccessTokens()
+
+	var wg sync.WaitGroup
+	errs := make(chan error, callers)
+
+	for i := 0; i < callers; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := client.ListRequisitions(context.Background(), 0, 0)
+			errs <- err
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		if err != nil {
+			t.Errorf("failed to list requisitions: %v", err)
+		}
+	}
+
+	if count := countRequests(server, "/token/refresh/"); count != 1 {
+		t.Errorf("expected the callers to share a single refresh, got %d", count)
+	}
+
+	if count := countRequests(server, "/token/new/"); count != 1 {
+		t.Errorf("expected no authentication after creating the client, got %d", count)
+	}
+}
@@ -1,30 +1,58 @@
 package nordigen
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/pkg/errors"
 )
 
-const baseURL = "https://ob.nordigen.com/api/v2"
+// DefaultBaseURL is the base URL of the Nordigen API used if no other base URL is set.
+const DefaultBaseURL = "https://ob.nordigen.com/api/v2"
 
 // Config is the configuration for the Nordigen client.
 type Config struct {
-	SecretID  string `envconfig:"SECRET_ID"`
-	SecretKey string `envconfig:"SECRET_KEY"`
+	SecretID  string `envconfig:"SECRET_ID" yaml:"secret_id"`
+	SecretKey string `envconfig:"SECRET_KEY" yaml:"secret_key"`
 }
 
 // Client represents a Nordigen API client.
 type Client struct {
 	config     *Config
 	httpClient *http.Client
+	baseURL    string
 
-	accessKey string
+	// renewLock serializes renewing the tokens, so concurrent requests share a single renewal
+	renewLock        sync.Mutex
+	tokenLock        sync.Mutex
+	accessKey        string
+	accessExpiresAt  time.Time
+	refreshKey       string
+	refreshExpiresAt time.Time
+
+	rateLimitLock sync.Mutex
+	rateLimits    map[string]*RateLimit
+}
+
+// Option configures a Nordigen API client.
+type Option func(*Client)
+
+// WithBaseURL sets the base URL of the API, e.g. to use a mock server or a different host.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) {
+		c.baseURL = strings.TrimSuffix(baseURL, "/")
+	}
 }
 
 // NewClient creates a new Nordigen API client.
-func NewClient(config *Config, httpClient *http.Client) (*Client, error) {
+func NewClient(config *Config, httpClient *http.Client, opts ...Option) (*Client, error) {
 	if config == nil || config.SecretID == "" || config.SecretKey == "" {
 		return nil, errors.New("invalid config")
 	}
@@ -33,14 +61,158 @@ func NewClient(config *Config, httpClient *http.Client) (*Client, error) {
 	client := &Client{
 		config:     config,
 		httpClient: httpClient,
+		baseURL:    DefaultBaseURL,
+	}
+
+	for _, opt := range opts {
+		opt(client)
 	}
 
 	// authenticate client
-	accessKey, err := client.authenticate(context.Background())
+	err := client.authenticate(context.Background())
 	if err != nil {
 		return nil, errors.Wrap(err, "failed to authenticate")
 	}
-	client.accessKey = accessKey
 
 	return client, nil
 }
+
+func (c *Client) createRequest(ctx context.Context, method string, endpoint string, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create http request")
+	}
+
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	return req, nil
+}
+
+// do executes an authenticated request.
+// If the access token is rejected it is renewed and the request is retried once.
+// A *RateLimitError is returned if a rate limit has been exceeded.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	resp, err := c.doAuthenticated(req)
+	if err != nil {
+		return nil, err
+	}
+
+	c.trackRateLimit(req, resp)
+
+	err = checkRateLimit(resp)
+	if err != nil {
+		resp.Body.Close()
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// doAuthenticated executes a request with the access token, renewing it once if it is rejected.
+func (c *Client) doAuthenticated(req *http.Request) (*http.Response, error) {
+	accessKey, err := c.accessToken(req.Context())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get access token")
+	}
+
+	req.Header.Set("Authorization", "Bearer "+accessKey)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusUnauthorized {
+		return resp, nil
+	}
+	resp.Body.Close()
+
+	// the access token may have been revoked or expired early
+	err = c.renewToken(req.Context(), accessKey)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to renew access token")
+	}
+
+	retryReq := req.Clone(req.Context())
+	if req.GetBody != nil {
+		retryReq.Body, err = req.GetBody()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to rewind request body")
+		}
+	}
+
+	accessKey, err = c.accessToken(req.Context())
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get access token")
+	}
+
+	retryReq.Header.Set("Authorization", "Bearer "+accessKey)
+
+	return c.httpClient.Do(retryReq)
+}
+
+// call executes an authenticated request with an optional JSON body and decodes the JSON response into result.
+// The action describes the request in error messages, for example "fetching requisitions".
+func (c *Client) call(ctx context.Context, method string, endpoint string, body interface{}, result interface{}, action string) error {
+	var reqData []byte
+
+	if body != nil {
+		var err error
+
+		reqData, err = json.Marshal(body)
+		if err != nil {
+			return errors.Wrap(err, "failed to marshal request")
+		}
+	}
+
+	req, err := c.createRequest(ctx, method, endpoint, reqData)
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to make http request")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK &&
+		resp.StatusCode != http.StatusCreated &&
+		resp.StatusCode != http.StatusNoContent {
+		if err := extractError(resp); err != nil {
+			return errors.Wrapf(err, "failed %s", action)
+		}
+
+		return errors.Errorf("received unexpected status code when %s: %s", action, resp.Status)
+	}
+
+	if result == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+
+	err = json.NewDecoder(resp.Body).Decode(result)
+	if err != nil {
+		return errors.Wrap(err, "failed to decode response body")
+	}
+
+	return nil
+}
+
+// listQuery returns the query for paginated endpoints, a limit of zero uses the default of the API.
+func listQuery(limit, offset int) string {
+	query := url.Values{}
+
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+
+	if offset > 0 {
+		query.Set("offset", strconv.Itoa(offset))
+	}
+
+	if len(query) == 0 {
+		return ""
+	}
+
+	return "?" + query.Encode()
+}
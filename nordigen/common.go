@@ -4,13 +4,14 @@ import (
 	"strings"
 	"time"
 
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/money"
 	"github.com/pkg/errors"
 )
 
 // Amount represents a currency amount.
 type Amount struct {
-	Amount   TransactionAmountValue `json:"amount"`
-	Currency string                 `json:"currency"`
+	Amount   money.Amount `json:"amount"`
+	Currency string       `json:"currency"`
 }
 
 // Date represents a date without a time.
@@ -27,3 +28,8 @@ func (td *Date) UnmarshalJSON(b []byte) (err error) {
 
 	return nil
 }
+
+// MarshalJSON provides custom marshalling for Date, it is encoded like the API does.
+func (td Date) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + time.Time(td).Format("2006-01-02") + `"`), nil
+}
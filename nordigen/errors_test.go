@@ -0,0 +1,57 @@
+package nordigen
+
+import (
+	"io"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExtractError(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want *APIError
+	}{
+		{
+			name: "API error",
+			body: `{"summary":"Not found.","detail":"Account ID 1 not found","status_code":404}`,
+			want: &APIError{Summary: "Not found.", Detail: "Account ID 1 not found", StatusCode: http.StatusNotFound},
+		},
+		{
+			name: "missing detail",
+			body: `{"summary":"Not found.","status_code":404}`,
+		},
+		{
+			name: "missing status code",
+			body: `{"summary":"Not found.","detail":"Account ID 1 not found"}`,
+		},
+		{
+			name: "validation error",
+			body: `{"institution_id":{"summary":"Unknown Institution ID","detail":"Get Institution IDs from /institutions/?country={$COUNTRY_CODE}"}}`,
+		},
+		{
+			name: "no JSON",
+			body: `<html>Bad Gateway</html>`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := extractError(&http.Response{Body: io.NopCloser(strings.NewReader(tt.body))})
+
+			if tt.want == nil {
+				if err != nil {
+					t.Errorf("expected no API error, got %v", err)
+				}
+
+				return
+			}
+
+			if !reflect.DeepEqual(err, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package nordigen
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+)
+
+// Institution represents a bank or other financial institution.
+type Institution struct {
+	ID                   string   `json:"id"`
+	Name                 string   `json:"name"`
+	BIC                  string   `json:"bic"`
+	TransactionTotalDays int      `json:"transaction_total_days,string"`
+	Countries            []string `json:"countries"`
+	Logo                 string   `json:"logo"`
+}
+
+// ListInstitutions fetches all institutions available in the given country (ISO 3166 two-character code).
+func (c *Client) ListInstitutions(ctx context.Context, country string) ([]*Institution, error) {
+	var institutions []*Institution
+
+	err := c.call(ctx, http.MethodGet, fmt.Sprintf("/institutions/?country=%s", url.QueryEscape(country)), nil, &institutions, "fetching institutions")
+	if err != nil {
+		return nil, err
+	}
+
+	return institutions, nil
+}
+
+// GetInstitution fetches a single institution.
+func (c *Client) GetInstitution(ctx context.Context, institutionID string) (*Institution, error) {
+	var institution Institution
+
+	err := c.call(ctx, http.MethodGet, fmt.Sprintf("/institutions/%s/", institutionID), nil, &institution, "fetching institution")
+	if err != nil {
+		return nil, err
+	}
+
+	return &institution, nil
+}
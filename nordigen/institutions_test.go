@@ -0,0 +1,44 @@
+package nordigen_test
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"github.com/pkg/errors"
+)
+
+func TestInstitutions(t *testing.T) {
+	ctx := context.Background()
+	server, client := newTestClient(t)
+
+	server.AddInstitution(&nordigen.Institution{ID: "BANK_DE", Name: "Bank", Countries: []string{"DE", "AT"}, TransactionTotalDays: 540})
+	server.AddInstitution(&nordigen.Institution{ID: "BANK_GB", Name: "Bank", Countries: []string{"GB"}, TransactionTotalDays: 730})
+
+	institutions, err := client.ListInstitutions(ctx, "at")
+	if err != nil {
+		t.Fatalf("failed to list institutions: %v", err)
+	}
+
+	if len(institutions) != 1 || institutions[0].ID != "BANK_DE" {
+		t.Errorf("expected the institutions of the country, got %+v", institutions)
+	}
+
+	// the number of days is encoded as a string by the API
+	institution, err := client.GetInstitution(ctx, "BANK_GB")
+	if err != nil {
+		t.Fatalf("failed to fetch institution: %v", err)
+	}
+
+	if institution.ID != "BANK_GB" || institution.TransactionTotalDays != 730 {
+		t.Errorf("unexpected institution %+v", institution)
+	}
+
+	_, err = client.GetInstitution(ctx, "UNKNOWN")
+
+	var apiErr *nordigen.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected an unknown institution not to be found, got %v", err)
+	}
+}
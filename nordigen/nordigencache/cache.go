@@ -0,0 +1,200 @@
+package nordigencache
+
+import (
+	"context"
+	"encoding/json"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"github.com/pkg/errors"
+)
+
+// Default time to live of cached responses.
+const (
+	DefaultDetailsTTL  = 7 * 24 * time.Hour
+	DefaultBalancesTTL = time.Hour
+)
+
+// Client wraps a Nordigen client and caches the account details and balances,
+// all other requests are passed through.
+type Client struct {
+	*nordigen.Client
+
+	dir         string
+	detailsTTL  time.Duration
+	balancesTTL time.Duration
+	bypass      bool
+}
+
+// Option configures a cache.
+type Option func(*Client)
+
+// WithDetailsTTL sets how long account details are cached.
+func WithDetailsTTL(ttl time.Duration) Option {
+	return func(c *Client) {
+		c.detailsTTL = ttl
+	}
+}
+
+// WithBalancesTTL sets how long account balances are cached.
+func WithBalancesTTL(ttl time.Duration) Option {
+	return func(c *Client) {
+		c.balancesTTL = ttl
+	}
+}
+
+// WithBypass ignores cached responses if set, fetched responses are still cached.
+func WithBypass(bypass bool) Option {
+	return func(c *Client) {
+		c.bypass = bypass
+	}
+}
+
+// entry is a cached response.
+type entry struct {
+	FetchedAt time.Time       `json:"fetched_at"`
+	Response  json.RawMessage `json:"response"`
+}
+
+// New creates a cache storing the responses in the directory, it is created if it does not exist.
+func New(client *nordigen.Client, dir string, opts ...Option) (*Client, error) {
+	if dir == "" {
+		return nil, errors.New("directory cannot be empty")
+	}
+
+	err := os.MkdirAll(dir, 0o700)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create cache directory")
+	}
+
+	c := &Client{
+		Client:      client,
+		dir:         dir,
+		detailsTTL:  DefaultDetailsTTL,
+		balancesTTL: DefaultBalancesTTL,
+	}
+
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return c, nil
+}
+
+// GetAccountDetails returns the cached details of an account, they are fetched if they are missing or expired.
+func (c *Client) GetAccountDetails(ctx context.Context, accountID string) (*nordigen.Account, error) {
+	var account *nordigen.Account
+
+	if c.load(accountID, nordigen.EndpointDetails, c.detailsTTL, &account) {
+		return account, nil
+	}
+
+	account, err := c.Client.GetAccountDetails(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.store(accountID, nordigen.EndpointDetails, account)
+
+	return account, nil
+}
+
+// GetAccountBalances returns the cached balances of an account, they are fetched if they are missing or expired.
+func (c *Client) GetAccountBalances(ctx context.Context, accountID string) ([]*nordigen.Balance, error) {
+	var balances []*nordigen.Balance
+
+	if c.load(accountID, nordigen.EndpointBalances, c.balancesTTL, &balances) {
+		return balances, nil
+	}
+
+	balances, err := c.Client.GetAccountBalances(ctx, accountID)
+	if err != nil {
+		return nil, err
+	}
+
+	c.store(accountID, nordigen.EndpointBalances, balances)
+
+	return balances, nil
+}
+
+// Cached returns true if a valid response of the account endpoint is cached,
+// requesting it is answered from the cache and does not reach Nordigen.
+func (c *Client) Cached(accountID, endpoint string) bool {
+	var ttl time.Duration
+
+	switch endpoint {
+	case nordigen.EndpointDetails:
+		ttl = c.detailsTTL
+	case nordigen.EndpointBalances:
+		ttl = c.balancesTTL
+	default:
+		return false
+	}
+
+	var response json.RawMessage
+
+	return c.load(accountID, endpoint, ttl, &response)
+}
+
+// path returns the file of the cached response of an account endpoint.
+func (c *Client) path(accountID, endpoint string) string {
+	return filepath.Join(c.dir, url.PathEscape(accountID)+"_"+endpoint+".json")
+}
+
+// load decodes the cached response into result, false is returned if there is no valid response.
+// Unreadable entries are treated as missing, they are replaced by the next response.
+func (c *Client) load(accountID, endpoint string, ttl time.Duration, result interface{}) bool {
+	if c.bypass || ttl <= 0 {
+		return false
+	}
+
+	data, err := os.ReadFile(c.path(accountID, endpoint))
+	if err != nil {
+		return false
+	}
+
+	var cached entry
+
+	err = json.Unmarshal(data, &cached)
+	if err != nil || time.Since(cached.FetchedAt) > ttl {
+		return false
+	}
+
+	return json.Unmarshal(cached.Response, result) == nil
+}
+
+// store caches a response.
+// Failing to write the cache is not an error, the response is fetched again next time.
+func (c *Client) store(accountID, endpoint string, response interface{}) {
+	responseData, err := json.Marshal(response)
+	if err != nil {
+		return
+	}
+
+	data, err := json.Marshal(&entry{
+		FetchedAt: time.Now(),
+		Response:  responseData,
+	})
+	if err != nil {
+		return
+	}
+
+	path := c.path(accountID, endpoint)
+
+	// write to a temporary file first so an interrupted write does not leave a corrupt entry behind
+	tmpFile, err := os.CreateTemp(c.dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.Write(data)
+	if closeErr := tmpFile.Close(); err != nil || closeErr != nil {
+		return
+	}
+
+	os.Rename(tmpFile.Name(), path)
+}
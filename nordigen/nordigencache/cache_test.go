@@ -0,0 +1,180 @@
+package nordigencache
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/money"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen/nordigentest"
+)
+
+const testAccountID = "account-1"
+
+func newTestCache(t *testing.T, dir string, opts ...Option) (*Client, *nordigentest.Server) {
+	t.Helper()
+
+	server := nordigentest.NewServer()
+	t.Cleanup(server.Close)
+
+	server.SetAccount(testAccountID, &nordigentest.Account{
+		Details: &nordigen.Account{Currency: "EUR", OwnerName: "Jane Doe", IBAN: "DE89370400440532013000"},
+		Balances: []*nordigentest.Balance{
+			{Amount: "1234.56", Currency: "EUR", Type: "expected", ReferenceDate: "2022-01-31"},
+		},
+	})
+
+	client, err := server.Client()
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	cache, err := New(client, dir, opts...)
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+
+	return cache, server
+}
+
+// countRequests returns the number of requests to an endpoint of the test account.
+func countRequests(server *nordigentest.Server, endpoint string) int {
+	var count int
+
+	for _, request := range server.Requests() {
+		if strings.HasSuffix(request.Path, "/accounts/"+testAccountID+"/"+endpoint+"/") {
+			count++
+		}
+	}
+
+	return count
+}
+
+func TestClient(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	cache, server := newTestCache(t, dir)
+
+	if cache.Cached(testAccountID, nordigen.EndpointDetails) || cache.Cached(testAccountID, nordigen.EndpointBalances) {
+		t.Error("expected nothing to be cached")
+	}
+
+	for i := 0; i < 2; i++ {
+		account, err := cache.GetAccountDetails(ctx, testAccountID)
+		if err != nil {
+			t.Fatalf("failed to get account details: %v", err)
+		}
+
+		if account.OwnerName != "Jane Doe" || account.IBAN != "DE89370400440532013000" {
+			t.Errorf("unexpected account details: %+v", account)
+		}
+
+		balances, err := cache.GetAccountBalances(ctx, testAccountID)
+		if err != nil {
+			t.Fatalf("failed to get account balances: %v", err)
+		}
+
+		want := &nordigen.Balance{
+			BalanceAmount: nordigen.Amount{Amount: money.MustParse("1234.56"), Currency: "EUR"},
+			BalanceType:   "expected",
+			ReferenceDate: nordigen.Date(time.Date(2022, 1, 31, 0, 0, 0, 0, time.UTC)),
+		}
+
+		if len(balances) != 1 || !reflect.DeepEqual(balances[0], want) {
+			t.Errorf("expected balances %+v, got %+v", want, balances)
+		}
+	}
+
+	if count := countRequests(server, nordigen.EndpointDetails); count != 1 {
+		t.Errorf("expected 1 details request, got %d", count)
+	}
+
+	if count := countRequests(server, nordigen.EndpointBalances); count != 1 {
+		t.Errorf("expected 1 balances request, got %d", count)
+	}
+
+	if !cache.Cached(testAccountID, nordigen.EndpointDetails) || !cache.Cached(testAccountID, nordigen.EndpointBalances) {
+		t.Error("expected the details and balances to be cached")
+	}
+
+	if cache.Cached(testAccountID, nordigen.EndpointTransactions) {
+		t.Error("expected transactions never to be cached")
+	}
+
+	// the cache is shared between runs
+	cache, server = newTestCache(t, dir)
+
+	_, err := cache.GetAccountDetails(ctx, testAccountID)
+	if err != nil {
+		t.Fatalf("failed to get account details: %v", err)
+	}
+
+	if count := countRequests(server, nordigen.EndpointDetails); count != 0 {
+		t.Errorf("expected cached details to be used, got %d requests", count)
+	}
+}
+
+func TestClientExpiry(t *testing.T) {
+	ctx := context.Background()
+
+	tests := []struct {
+		name string
+		opts []Option
+	}{
+		{name: "expired", opts: []Option{WithDetailsTTL(time.Nanosecond)}},
+		{name: "disabled", opts: []Option{WithDetailsTTL(-1)}},
+		{name: "bypassed", opts: []Option{WithBypass(true)}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cache, server := newTestCache(t, t.TempDir(), tt.opts...)
+
+			for i := 0; i < 2; i++ {
+				_, err := cache.GetAccountDetails(ctx, testAccountID)
+				if err != nil {
+					t.Fatalf("failed to get account details: %v", err)
+				}
+			}
+
+			if count := countRequests(server, nordigen.EndpointDetails); count != 2 {
+				t.Errorf("expected 2 details requests, got %d", count)
+			}
+
+			if cache.Cached(testAccountID, nordigen.EndpointDetails) {
+				t.Error("expected the details not to be cached")
+			}
+		})
+	}
+}
+
+func TestClientCorruptEntry(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	cache, server := newTestCache(t, dir)
+
+	err := os.WriteFile(filepath.Join(dir, testAccountID+"_"+nordigen.EndpointDetails+".json"), []byte("{"), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write cache entry: %v", err)
+	}
+
+	account, err := cache.GetAccountDetails(ctx, testAccountID)
+	if err != nil {
+		t.Fatalf("failed to get account details: %v", err)
+	}
+
+	if account.OwnerName != "Jane Doe" {
+		t.Errorf("unexpected account details: %+v", account)
+	}
+
+	if count := countRequests(server, nordigen.EndpointDetails); count != 1 {
+		t.Errorf("expected 1 details request, got %d", count)
+	}
+}
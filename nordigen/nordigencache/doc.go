@@ -0,0 +1,4 @@
+/*
+Package nordigencache caches responses of the Nordigen API on disk to save requests of the per-account rate limits.
+*/
+package nordigencache
@@ -0,0 +1,4 @@
+/*
+Package nordigentest contains an in-process fake of the Nordigen API for tests.
+*/
+package nordigentest
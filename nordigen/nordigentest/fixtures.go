@@ -0,0 +1,141 @@
+package nordigentest
+
+import (
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+)
+
+// Account is an account served by the fake API.
+type Account struct {
+	Details  *nordigen.Account
+	Balances []*Balance
+	Booked   []*Transaction
+	Pending  []*Transaction
+}
+
+// Balance is a balance of an account.
+type Balance struct {
+	Amount        string
+	Currency      string
+	Type          string
+	ReferenceDate string // YYYY-MM-DD
+}
+
+func (b *Balance) json() map[string]interface{} {
+	balance := map[string]interface{}{
+		"balanceAmount": map[string]string{
+			"amount":   b.Amount,
+			"currency": b.Currency,
+		},
+		"balanceType": b.Type,
+	}
+
+	if b.ReferenceDate != "" {
+		balance["referenceDate"] = b.ReferenceDate
+	}
+
+	return balance
+}
+
+// Transaction is a booked or pending transaction of an account, empty fields are omitted from the response.
+type Transaction struct {
+	TransactionID string
+	BookingDate   string // YYYY-MM-DD
+	ValueDate     string // YYYY-MM-DD
+	Amount        string
+	Currency      string
+
+	CreditorName string
+	CreditorIBAN string
+	DebtorName   string
+	DebtorIBAN   string
+
+	RemittanceInformation          string
+	RemittanceInformationArray     []string
+	AdditionalInformation          string
+	BankTransactionCode            string
+	ProprietaryBankTransactionCode string
+	MerchantCategoryCode           string
+
+	CurrencyExchange []*nordigen.CurrencyExchange
+	// CurrencyExchangeObject returns the first currency exchange as an object instead of an array, like some banks do.
+	CurrencyExchangeObject bool
+}
+
+func (t *Transaction) json() map[string]interface{} {
+	trx := map[string]interface{}{
+		"transactionAmount": map[string]string{
+			"amount":   t.Amount,
+			"currency": t.Currency,
+		},
+	}
+
+	fields := map[string]string{
+		"transactionId":                     t.TransactionID,
+		"bookingDate":                       t.BookingDate,
+		"valueDate":                         t.ValueDate,
+		"creditorName":                      t.CreditorName,
+		"debtorName":                        t.DebtorName,
+		"remittanceInformationUnstructured": t.RemittanceInformation,
+		"additionalInformation":             t.AdditionalInformation,
+		"bankTransactionCode":               t.BankTransactionCode,
+		"proprietaryBankTransactionCode":    t.ProprietaryBankTransactionCode,
+		"merchantCategoryCode":              t.MerchantCategoryCode,
+	}
+
+	for key, value := range fields {
+		if value != "" {
+			trx[key] = value
+		}
+	}
+
+	if t.CreditorIBAN != "" {
+		trx["creditorAccount"] = map[string]string{"iban": t.CreditorIBAN}
+	}
+
+	if t.DebtorIBAN != "" {
+		trx["debtorAccount"] = map[string]string{"iban": t.DebtorIBAN}
+	}
+
+	if len(t.RemittanceInformationArray) > 0 {
+		trx["remittanceInformationUnstructuredArray"] = t.RemittanceInformationArray
+	}
+
+	if len(t.CurrencyExchange) > 0 {
+		if t.CurrencyExchangeObject {
+			trx["currencyExchange"] = t.CurrencyExchange[0]
+		} else {
+			trx["currencyExchange"] = t.CurrencyExchange
+		}
+	}
+
+	return trx
+}
+
+// date returns the booking date of the transaction, falling back to the value date.
+func (t *Transaction) date() string {
+	if t.BookingDate != "" {
+		return t.BookingDate
+	}
+
+	return t.ValueDate
+}
+
+// filterTransactions returns the transactions booked in the date range, empty dates are ignored.
+// Dates in the format YYYY-MM-DD can be compared as strings.
+func filterTransactions(transactions []*Transaction, dateFrom, dateTo string) []interface{} {
+	filtered := make([]interface{}, 0, len(transactions))
+
+	for _, trx := range transactions {
+		if dateFrom != "" && trx.date() < dateFrom {
+			continue
+		}
+
+		if dateTo != "" && trx.date() > dateTo {
+			continue
+		}
+
+		filtered = append(filtered, trx.json())
+	}
+
+	return filtered
+}
@@ -0,0 +1,687 @@
+package nordigentest
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+)
+
+// Credentials accepted by a new server.
+const (
+	SecretID  = "test-secret-id"
+	SecretKey = "test-secret-key"
+)
+
+// defaultPageSize is the page size of paginated endpoints if no limit is given.
+const defaultPageSize = 100
+
+// Server is a fake Nordigen API. Use its URL as the base URL of the client.
+type Server struct {
+	*httptest.Server
+
+	// AccessExpires and RefreshExpires are the lifetimes of issued tokens.
+	AccessExpires  time.Duration
+	RefreshExpires time.Duration
+
+	lock          sync.Mutex
+	lastID        int
+	accessTokens  map[string]time.Time
+	refreshTokens map[string]time.Time
+	accounts      map[string]*Account
+	requisitions  []*nordigen.Requisition
+	agreements    []*nordigen.Agreement
+	institutions  []*nordigen.Institution
+	failures      []*failure
+	quotas        map[string]*quota
+	requests      []*Request
+}
+
+// quota is the daily limit of successful requests to an endpoint of an account.
+type quota struct {
+	limit     int
+	remaining int
+	resetAt   time.Time
+}
+
+// Request is a request received by the server.
+type Request struct {
+	Method string
+	Path   string
+	Query  url.Values
+}
+
+// failure is an injected error returned for the next requests matching the path prefix.
+type failure struct {
+	pathPrefix string
+	statusCode int
+	remaining  int
+	header     http.Header
+}
+
+// NewServer starts a new fake Nordigen API, it has to be closed after use.
+func NewServer() *Server {
+	s := &Server{
+		AccessExpires:  24 * time.Hour,
+		RefreshExpires: 30 * 24 * time.Hour,
+		accessTokens:   make(map[string]time.Time),
+		refreshTokens:  make(map[string]time.Time),
+		accounts:       make(map[string]*Account),
+		quotas:         make(map[string]*quota),
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(s.handle))
+
+	return s
+}
+
+// Config returns a client config with the credentials accepted by the server.
+func (s *Server) Config() *nordigen.Config {
+	return &nordigen.Config{
+		SecretID:  SecretID,
+		SecretKey: SecretKey,
+	}
+}
+
+// Client creates a client authenticated against the server.
+func (s *Server) Client() (*nordigen.Client, error) {
+	return nordigen.NewClient(s.Config(), s.Server.Client(), nordigen.WithBaseURL(s.URL))
+}
+
+// SetAccount adds or replaces an account.
+func (s *Server) SetAccount(accountID string, account *Account) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if account.Details != nil && account.Details.ResourceID == "" {
+		account.Details.ResourceID = accountID
+	}
+
+	s.accounts[accountID] = account
+}
+
+// AddBookedTransactions adds booked transactions to an existing account.
+func (s *Server) AddBookedTransactions(accountID string, transactions ...*Transaction) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.accounts[accountID].Booked = append(s.accounts[accountID].Booked, transactions...)
+}
+
+// SetBookedTransactions replaces the booked transactions of an existing account.
+func (s *Server) SetBookedTransactions(accountID string, transactions ...*Transaction) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.accounts[accountID].Booked = transactions
+}
+
+// SetPendingTransactions replaces the pending transactions of an existing account.
+func (s *Server) SetPendingTransactions(accountID string, transactions ...*Transaction) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.accounts[accountID].Pending = transactions
+}
+
+// AddRequisition adds a requisition, the ID is generated if it is empty.
+func (s *Server) AddRequisition(requisition *nordigen.Requisition) *nordigen.Requisition {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if requisition.ID == "" {
+		requisition.ID = s.nextID("requisition")
+	}
+
+	s.requisitions = append(s.requisitions, requisition)
+
+	return requisition
+}
+
+// LinkRequisition links the accounts to a requisition, like finishing the authentication with the bank does.
+func (s *Server) LinkRequisition(requisitionID string, accountIDs ...string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	for _, requisition := range s.requisitions {
+		if requisition.ID == requisitionID {
+			requisition.Status = nordigen.RequisitionStatusLinked
+			requisition.Accounts = accountIDs
+		}
+	}
+}
+
+// AddAgreement adds an end user agreement, the ID is generated if it is empty.
+func (s *Server) AddAgreement(agreement *nordigen.Agreement) *nordigen.Agreement {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if agreement.ID == "" {
+		agreement.ID = s.nextID("agreement")
+	}
+
+	s.agreements = append(s.agreements, agreement)
+
+	return agreement
+}
+
+// AddInstitution adds an institution.
+func (s *Server) AddInstitution(institution *nordigen.Institution) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.institutions = append(s.institutions, institution)
+}
+
+// Requisitions returns all requisitions including the ones created by clients.
+func (s *Server) Requisitions() []*nordigen.Requisition {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]*nordigen.Requisition(nil), s.requisitions...)
+}
+
+// Fail makes the next count requests whose path starts with pathPrefix fail with the status code.
+// The path is relative to the base URL, e.g. "/accounts/".
+func (s *Server) Fail(pathPrefix string, statusCode int, count int) {
+	s.FailWithHeader(pathPrefix, statusCode, count, nil)
+}
+
+// FailWithHeader is like Fail, the header is added to the failed responses.
+func (s *Server) FailWithHeader(pathPrefix string, statusCode int, count int, header http.Header) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.failures = append(s.failures, &failure{
+		pathPrefix: pathPrefix,
+		statusCode: statusCode,
+		remaining:  count,
+		header:     header,
+	})
+}
+
+// SetQuota limits the successful requests to an endpoint of an account, e.g. nordigen.EndpointTransactions.
+// The remaining requests are reported in the rate limit headers, exceeding them is rejected with 429.
+func (s *Server) SetQuota(accountID, endpoint string, limit int, reset time.Duration) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.quotas[accountID+"/"+endpoint] = &quota{
+		limit:     limit,
+		remaining: limit,
+		resetAt:   time.Now().Add(reset),
+	}
+}
+
+// ExpireAccessTokens invalidates all issued access tokens, requests using them are rejected.
+func (s *Server) ExpireAccessTokens() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.accessTokens = make(map[string]time.Time)
+}
+
+// ExpireRefreshTokens invalidates all issued refresh tokens, refreshing the access token is rejected.
+func (s *Server) ExpireRefreshTokens() {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.refreshTokens = make(map[string]time.Time)
+}
+
+// Requests returns all requests received by the server.
+func (s *Server) Requests() []*Request {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]*Request(nil), s.requests...)
+}
+
+// nextID generates a new unique ID, the lock has to be held.
+func (s *Server) nextID(prefix string) string {
+	s.lastID++
+
+	return fmt.Sprintf("%s-%d", prefix, s.lastID)
+}
+
+func (s *Server) handle(w http.ResponseWriter, r *http.Request) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	path := r.URL.Path
+
+	s.requests = append(s.requests, &Request{
+		Method: r.Method,
+		Path:   path,
+		Query:  r.URL.Query(),
+	})
+
+	for i, f := range s.failures {
+		if !strings.HasPrefix(path, f.pathPrefix) {
+			continue
+		}
+
+		f.remaining--
+		if f.remaining <= 0 {
+			s.failures = append(s.failures[:i], s.failures[i+1:]...)
+		}
+
+		for key, values := range f.header {
+			w.Header()[key] = values
+		}
+
+		writeError(w, f.statusCode, http.StatusText(f.statusCode), "Injected failure.")
+
+		return
+	}
+
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	if segments[0] == "token" {
+		s.handleToken(w, r, segments)
+		return
+	}
+
+	if !s.authorized(r) {
+		writeError(w, http.StatusUnauthorized, "Invalid token", "Token is invalid or expired")
+		return
+	}
+
+	switch segments[0] {
+	case "accounts":
+		s.handleAccounts(w, r, segments)
+	case "requisitions":
+		s.handleRequisitions(w, r, segments)
+	case "agreements":
+		s.handleAgreements(w, r, segments)
+	case "institutions":
+		s.handleInstitutions(w, r, segments)
+	default:
+		writeNotFound(w)
+	}
+}
+
+// authorized returns true if the request has a valid access token.
+func (s *Server) authorized(r *http.Request) bool {
+	expiresAt, ok := s.accessTokens[strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")]
+
+	return ok && time.Now().Before(expiresAt)
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request, segments []string) {
+	if r.Method != http.MethodPost || len(segments) != 2 {
+		writeNotFound(w)
+		return
+	}
+
+	var body struct {
+		SecretID  string `json:"secret_id"`
+		SecretKey string `json:"secret_key"`
+		Refresh   string `json:"refresh"`
+	}
+
+	err := json.NewDecoder(r.Body).Decode(&body)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "Invalid request", err.Error())
+		return
+	}
+
+	now := time.Now()
+
+	switch segments[1] {
+	case "new":
+		if body.SecretID != SecretID || body.SecretKey != SecretKey {
+			writeError(w, http.StatusUnauthorized, "Authentication failed", "No active account found with the given credentials")
+			return
+		}
+
+		access, refresh := s.nextID("access"), s.nextID("refresh")
+		s.accessTokens[access] = now.Add(s.AccessExpires)
+		s.refreshTokens[refresh] = now.Add(s.RefreshExpires)
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"access":          access,
+			"access_expires":  int(s.AccessExpires.Seconds()),
+			"refresh":         refresh,
+			"refresh_expires": int(s.RefreshExpires.Seconds()),
+		})
+	case "refresh":
+		expiresAt, ok := s.refreshTokens[body.Refresh]
+		if !ok || now.After(expiresAt) {
+			writeError(w, http.StatusUnauthorized, "Invalid token", "Token is invalid or expired")
+			return
+		}
+
+		access := s.nextID("access")
+		s.accessTokens[access] = now.Add(s.AccessExpires)
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"access":         access,
+			"access_expires": int(s.AccessExpires.Seconds()),
+		})
+	default:
+		writeNotFound(w)
+	}
+}
+
+func (s *Server) handleAccounts(w http.ResponseWriter, r *http.Request, segments []string) {
+	if r.Method != http.MethodGet || len(segments) != 3 {
+		writeNotFound(w)
+		return
+	}
+
+	account, ok := s.accounts[segments[1]]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Not found.", fmt.Sprintf("Account ID %s not found", segments[1]))
+		return
+	}
+
+	if q, ok := s.quotas[segments[1]+"/"+segments[2]]; ok {
+		if time.Now().After(q.resetAt) {
+			q.remaining = q.limit
+		}
+
+		resetSeconds := strconv.Itoa(int(time.Until(q.resetAt).Seconds()))
+
+		if q.remaining <= 0 {
+			w.Header().Set("HTTP_X_RATELIMIT_ACCOUNT_SUCCESS_LIMIT", strconv.Itoa(q.limit))
+			w.Header().Set("HTTP_X_RATELIMIT_ACCOUNT_SUCCESS_REMAINING", "0")
+			w.Header().Set("HTTP_X_RATELIMIT_ACCOUNT_SUCCESS_RESET", resetSeconds)
+
+			writeError(w, http.StatusTooManyRequests, "Rate limit exceeded",
+				fmt.Sprintf("The rate limit for this resource is %d/day. Please try again in %s seconds", q.limit, resetSeconds),
+			)
+
+			return
+		}
+
+		q.remaining--
+
+		w.Header().Set("HTTP_X_RATELIMIT_ACCOUNT_SUCCESS_LIMIT", strconv.Itoa(q.limit))
+		w.Header().Set("HTTP_X_RATELIMIT_ACCOUNT_SUCCESS_REMAINING", strconv.Itoa(q.remaining))
+		w.Header().Set("HTTP_X_RATELIMIT_ACCOUNT_SUCCESS_RESET", resetSeconds)
+	}
+
+	switch segments[2] {
+	case "details":
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"account": account.Details,
+		})
+	case "balances":
+		balances := make([]interface{}, 0, len(account.Balances))
+		for _, balance := range account.Balances {
+			balances = append(balances, balance.json())
+		}
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"balances": balances,
+		})
+	case "transactions":
+		dateFrom, dateTo := r.URL.Query().Get("date_from"), r.URL.Query().Get("date_to")
+
+		writeJSON(w, http.StatusOK, map[string]interface{}{
+			"transactions": map[string]interface{}{
+				"booked":  filterTransactions(account.Booked, dateFrom, dateTo),
+				"pending": filterTransactions(account.Pending, dateFrom, dateTo),
+			},
+		})
+	default:
+		writeNotFound(w)
+	}
+}
+
+func (s *Server) handleRequisitions(w http.ResponseWriter, r *http.Request, segments []string) {
+	switch {
+	case len(segments) == 1 && r.Method == http.MethodGet:
+		results := make([]interface{}, 0, len(s.requisitions))
+		for _, requisition := range s.requisitions {
+			results = append(results, requisition)
+		}
+
+		writePage(w, r, results)
+	case len(segments) == 1 && r.Method == http.MethodPost:
+		var request nordigen.RequisitionRequest
+
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid request", err.Error())
+			return
+		}
+
+		id := s.nextID("requisition")
+		requisition := &nordigen.Requisition{
+			ID:               id,
+			Created:          time.Now().UTC(),
+			Redirect:         request.Redirect,
+			Status:           nordigen.RequisitionStatusCreated,
+			InstitutionID:    request.InstitutionID,
+			Agreement:        request.Agreement,
+			Reference:        request.Reference,
+			Accounts:         []string{},
+			UserLanguage:     request.UserLanguage,
+			Link:             s.URL + "/link/" + id,
+			AccountSelection: request.AccountSelection,
+		}
+
+		s.requisitions = append(s.requisitions, requisition)
+
+		writeJSON(w, http.StatusCreated, requisition)
+	case len(segments) == 2:
+		for i, requisition := range s.requisitions {
+			if requisition.ID != segments[1] {
+				continue
+			}
+
+			switch r.Method {
+			case http.MethodGet:
+				writeJSON(w, http.StatusOK, requisition)
+			case http.MethodDelete:
+				s.requisitions = append(s.requisitions[:i], s.requisitions[i+1:]...)
+
+				writeJSON(w, http.StatusOK, map[string]string{
+					"summary": "Requisition deleted",
+					"detail":  fmt.Sprintf("Requisition %s deleted with all its End User Agreements", requisition.ID),
+				})
+			default:
+				writeNotFound(w)
+			}
+
+			return
+		}
+
+		writeError(w, http.StatusNotFound, "Not found.", fmt.Sprintf("Requisition %s not found", segments[1]))
+	default:
+		writeNotFound(w)
+	}
+}
+
+func (s *Server) handleAgreements(w http.ResponseWriter, r *http.Request, segments []string) {
+	if len(segments) < 2 || segments[1] != "enduser" {
+		writeNotFound(w)
+		return
+	}
+
+	switch {
+	case len(segments) == 2 && r.Method == http.MethodGet:
+		results := make([]interface{}, 0, len(s.agreements))
+		for _, agreement := range s.agreements {
+			results = append(results, agreement)
+		}
+
+		writePage(w, r, results)
+	case len(segments) == 2 && r.Method == http.MethodPost:
+		var request nordigen.AgreementRequest
+
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "Invalid request", err.Error())
+			return
+		}
+
+		agreement := &nordigen.Agreement{
+			ID:                 s.nextID("agreement"),
+			Created:            time.Now().UTC(),
+			InstitutionID:      request.InstitutionID,
+			MaxHistoricalDays:  request.MaxHistoricalDays,
+			AccessValidForDays: request.AccessValidForDays,
+			AccessScope:        request.AccessScope,
+		}
+
+		if agreement.MaxHistoricalDays == 0 {
+			agreement.MaxHistoricalDays = 90
+		}
+
+		if agreement.AccessValidForDays == 0 {
+			agreement.AccessValidForDays = 90
+		}
+
+		if len(agreement.AccessScope) == 0 {
+			agreement.AccessScope = []string{
+				nordigen.AccessScopeBalances,
+				nordigen.AccessScopeDetails,
+				nordigen.AccessScopeTransactions,
+			}
+		}
+
+		s.agreements = append(s.agreements, agreement)
+
+		writeJSON(w, http.StatusCreated, agreement)
+	case len(segments) >= 3:
+		for i, agreement := range s.agreements {
+			if agreement.ID != segments[2] {
+				continue
+			}
+
+			switch {
+			case len(segments) == 3 && r.Method == http.MethodGet:
+				writeJSON(w, http.StatusOK, agreement)
+			case len(segments) == 3 && r.Method == http.MethodDelete:
+				s.agreements = append(s.agreements[:i], s.agreements[i+1:]...)
+
+				writeJSON(w, http.StatusOK, map[string]string{
+					"summary": "End User Agreement deleted",
+					"detail":  fmt.Sprintf("End User Agreement %s deleted", agreement.ID),
+				})
+			case len(segments) == 4 && segments[3] == "accept" && r.Method == http.MethodPut:
+				accepted := time.Now().UTC()
+				agreement.Accepted = &accepted
+
+				writeJSON(w, http.StatusOK, agreement)
+			default:
+				writeNotFound(w)
+			}
+
+			return
+		}
+
+		writeError(w, http.StatusNotFound, "Not found.", fmt.Sprintf("End User Agreement %s not found", segments[2]))
+	default:
+		writeNotFound(w)
+	}
+}
+
+func (s *Server) handleInstitutions(w http.ResponseWriter, r *http.Request, segments []string) {
+	if r.Method != http.MethodGet {
+		writeNotFound(w)
+		return
+	}
+
+	switch len(segments) {
+	case 1:
+		country := r.URL.Query().Get("country")
+
+		institutions := make([]*nordigen.Institution, 0, len(s.institutions))
+
+		for _, institution := range s.institutions {
+			for _, c := range institution.Countries {
+				if strings.EqualFold(c, country) {
+					institutions = append(institutions, institution)
+					break
+				}
+			}
+		}
+
+		writeJSON(w, http.StatusOK, institutions)
+	case 2:
+		for _, institution := range s.institutions {
+			if institution.ID == segments[1] {
+				writeJSON(w, http.StatusOK, institution)
+				return
+			}
+		}
+
+		writeError(w, http.StatusNotFound, "Not found.", fmt.Sprintf("Institution %s not found", segments[1]))
+	default:
+		writeNotFound(w)
+	}
+}
+
+// writePage writes a page of results selected with the limit and offset query parameters.
+func writePage(w http.ResponseWriter, r *http.Request, results []interface{}) {
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = defaultPageSize
+	}
+
+	offset, err := strconv.Atoi(r.URL.Query().Get("offset"))
+	if err != nil || offset < 0 {
+		offset = 0
+	}
+
+	count := len(results)
+
+	start, end := offset, offset+limit
+	if start > count {
+		start = count
+	}
+
+	if end > count {
+		end = count
+	}
+
+	var next interface{}
+
+	if end < count {
+		nextURL := *r.URL
+		query := nextURL.Query()
+		query.Set("limit", strconv.Itoa(limit))
+		query.Set("offset", strconv.Itoa(end))
+		nextURL.RawQuery = query.Encode()
+
+		next = nextURL.String()
+	}
+
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"count":    count,
+		"next":     next,
+		"previous": nil,
+		"results":  results[start:end],
+	})
+}
+
+// writeError writes an error in the format of the Nordigen API.
+func writeError(w http.ResponseWriter, statusCode int, summary, detail string) {
+	writeJSON(w, statusCode, &nordigen.APIError{
+		Summary:    summary,
+		Detail:     detail,
+		StatusCode: statusCode,
+	})
+}
+
+func writeNotFound(w http.ResponseWriter) {
+	writeError(w, http.StatusNotFound, "Not found.", "Not found.")
+}
+
+func writeJSON(w http.ResponseWriter, statusCode int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(statusCode)
+
+	_ = json.NewEncoder(w).Encode(body)
+}
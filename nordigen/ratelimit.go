@@ -0,0 +1,185 @@
+package nordigen
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rate limit headers returned by the API.
+// The account success limits are the daily limits of the bank for a single account and endpoint.
+const (
+	headerRateLimitLimit                   = "HTTP_X_RATELIMIT_LIMIT"
+	headerRateLimitRemaining               = "HTTP_X_RATELIMIT_REMAINING"
+	headerRateLimitReset                   = "HTTP_X_RATELIMIT_RESET"
+	headerRateLimitAccountSuccessLimit     = "HTTP_X_RATELIMIT_ACCOUNT_SUCCESS_LIMIT"
+	headerRateLimitAccountSuccessRemaining = "HTTP_X_RATELIMIT_ACCOUNT_SUCCESS_REMAINING"
+	headerRateLimitAccountSuccessReset     = "HTTP_X_RATELIMIT_ACCOUNT_SUCCESS_RESET"
+)
+
+// Endpoints of an account with separate rate limits.
+const (
+	EndpointDetails      = "details"
+	EndpointBalances     = "balances"
+	EndpointTransactions = "transactions"
+)
+
+// RateLimit describes the rate limits reported with a response.
+// Values of limits which were not reported are negative, times are zero.
+type RateLimit struct {
+	Limit     int
+	Remaining int
+	Reset     time.Time
+
+	AccountSuccessLimit     int
+	AccountSuccessRemaining int
+	AccountSuccessReset     time.Time
+}
+
+// Quota returns the remaining requests and the time they reset of the stricter limit,
+// false is returned if no limit was reported.
+func (r *RateLimit) Quota() (int, time.Time, bool) {
+	if r == nil {
+		return 0, time.Time{}, false
+	}
+
+	switch {
+	case r.AccountSuccessRemaining >= 0 && (r.Remaining < 0 || r.AccountSuccessRemaining <= r.Remaining):
+		return r.AccountSuccessRemaining, r.AccountSuccessReset, true
+	case r.Remaining >= 0:
+		return r.Remaining, r.Reset, true
+	}
+
+	return 0, time.Time{}, false
+}
+
+// RateLimitError is returned if the API rejected a request because a rate limit was exceeded.
+type RateLimitError struct {
+	RateLimit *RateLimit
+	Detail    string
+}
+
+// Error returns the error message of a rate limit error.
+func (e *RateLimitError) Error() string {
+	msg := "rate limit exceeded"
+
+	if _, reset, ok := e.RateLimit.Quota(); ok && !reset.IsZero() {
+		msg += fmt.Sprintf(", resets at %s", reset.Format(time.RFC3339))
+	}
+
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+
+	return msg
+}
+
+// ResetAt returns the time the exceeded rate limit resets, the zero time is returned if it is unknown.
+func (e *RateLimitError) ResetAt() time.Time {
+	_, reset, _ := e.RateLimit.Quota()
+
+	return reset
+}
+
+// parseRateLimit parses the rate limit headers of a response, nil is returned if there are none.
+func parseRateLimit(header http.Header, now time.Time) *RateLimit {
+	rateLimit := &RateLimit{
+		Limit:                   headerInt(header, headerRateLimitLimit),
+		Remaining:               headerInt(header, headerRateLimitRemaining),
+		Reset:                   headerReset(header, headerRateLimitReset, now),
+		AccountSuccessLimit:     headerInt(header, headerRateLimitAccountSuccessLimit),
+		AccountSuccessRemaining: headerInt(header, headerRateLimitAccountSuccessRemaining),
+		AccountSuccessReset:     headerReset(header, headerRateLimitAccountSuccessReset, now),
+	}
+
+	if rateLimit.Limit < 0 && rateLimit.Remaining < 0 &&
+		rateLimit.AccountSuccessLimit < 0 && rateLimit.AccountSuccessRemaining < 0 {
+		return nil
+	}
+
+	return rateLimit
+}
+
+// headerInt returns the integer value of a header, -1 is returned if it is missing or invalid.
+func headerInt(header http.Header, key string) int {
+	value, err := strconv.Atoi(strings.TrimSpace(header.Get(key)))
+	if err != nil {
+		return -1
+	}
+
+	return value
+}
+
+// headerReset returns the time a limit resets, the header contains the seconds until the reset.
+func headerReset(header http.Header, key string, now time.Time) time.Time {
+	seconds := headerInt(header, key)
+	if seconds < 0 {
+		return time.Time{}
+	}
+
+	return now.Add(time.Duration(seconds) * time.Second)
+}
+
+// rateLimitKey returns the key of the rate limit of an account endpoint, false is returned for other paths.
+func rateLimitKey(path string) (string, bool) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+
+	for i := 0; i+2 < len(segments); i++ {
+		if segments[i] == "accounts" {
+			return segments[i+1] + "/" + segments[i+2], true
+		}
+	}
+
+	return "", false
+}
+
+// trackRateLimit remembers the rate limit reported for an account endpoint.
+func (c *Client) trackRateLimit(req *http.Request, resp *http.Response) {
+	key, ok := rateLimitKey(req.URL.Path)
+	if !ok {
+		return
+	}
+
+	rateLimit := parseRateLimit(resp.Header, time.Now())
+	if rateLimit == nil {
+		return
+	}
+
+	c.rateLimitLock.Lock()
+	defer c.rateLimitLock.Unlock()
+
+	if c.rateLimits == nil {
+		c.rateLimits = make(map[string]*RateLimit)
+	}
+
+	c.rateLimits[key] = rateLimit
+}
+
+// RateLimit returns the rate limit last reported for an endpoint of an account, e.g. EndpointTransactions.
+// Nil is returned if the endpoint has not been called yet or no rate limit was reported.
+func (c *Client) RateLimit(accountID, endpoint string) *RateLimit {
+	c.rateLimitLock.Lock()
+	defer c.rateLimitLock.Unlock()
+
+	return c.rateLimits[accountID+"/"+endpoint]
+}
+
+// checkRateLimit returns a RateLimitError if the response reports an exceeded rate limit.
+// The body of the response is consumed in this case.
+func checkRateLimit(resp *http.Response) error {
+	if resp.StatusCode != http.StatusTooManyRequests {
+		return nil
+	}
+
+	rateLimitErr := &RateLimitError{
+		RateLimit: parseRateLimit(resp.Header, time.Now()),
+	}
+
+	if apiErr, ok := extractError(resp).(*APIError); ok {
+		rateLimitErr.Detail = apiErr.Detail
+	}
+
+	return rateLimitErr
+}
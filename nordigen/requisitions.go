@@ -2,16 +2,26 @@ package nordigen
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
+)
 
-	"github.com/pkg/errors"
+// Requisition statuses, see https://nordigen.com/en/docs/account-information/overview/integration-statuses/.
+const (
+	RequisitionStatusCreated           = "CR"
+	RequisitionStatusGivingConsent     = "GC"
+	RequisitionStatusUndergoingAuth    = "UA"
+	RequisitionStatusRejected          = "RJ"
+	RequisitionStatusSelectingAccounts = "SA"
+	RequisitionStatusGrantingAccess    = "GA"
+	RequisitionStatusLinked            = "LN"
+	RequisitionStatusSuspended         = "SU"
+	RequisitionStatusExpired           = "EX"
 )
 
-// AccountList represents a list of accounts.
-type AccountList struct {
+// Requisition represents a requisition, a connection to the accounts of a bank user.
+type Requisition struct {
 	ID               string    `json:"id"`
 	Created          time.Time `json:"created"`
 	Redirect         string    `json:"redirect"`
@@ -25,41 +35,91 @@ type AccountList struct {
 	AccountSelection bool      `json:"account_selection"`
 }
 
+// AccountList represents a list of accounts.
+//
+// Deprecated: use Requisition instead.
+type AccountList = Requisition
+
 // ListAccounts fetches Nordigen accounts.
-func (c *Client) ListAccounts(ctx context.Context, requisitionID string) (*AccountList, error) {
-	req, err := http.NewRequestWithContext(
-		ctx,
-		http.MethodGet,
-		fmt.Sprintf("%s/requisitions/%s/", baseURL, requisitionID),
-		nil,
-	)
+//
+// Deprecated: use GetRequisition instead.
+func (c *Client) ListAccounts(ctx context.Context, requisitionID string) (*Requisition, error) {
+	return c.GetRequisition(ctx, requisitionID)
+}
+
+// GetRequisition fetches a requisition including the IDs of its accounts.
+func (c *Client) GetRequisition(ctx context.Context, requisitionID string) (*Requisition, error) {
+	var requisition Requisition
+
+	err := c.call(ctx, http.MethodGet, fmt.Sprintf("/requisitions/%s/", requisitionID), nil, &requisition, "fetching requisition")
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to create http request")
+		return nil, err
 	}
 
-	req.Header.Add("Content-Type", "application/json; charset=utf-8")
-	req.Header.Add("Authorization", "Bearer "+c.accessKey)
+	return &requisition, nil
+}
+
+// RequisitionPage represents a page of requisitions.
+type RequisitionPage struct {
+	Count    int            `json:"count"`
+	Next     string         `json:"next"`
+	Previous string         `json:"previous"`
+	Results  []*Requisition `json:"results"`
+}
+
+// ListRequisitions fetches a page of requisitions, a limit of zero uses the default page size.
+func (c *Client) ListRequisitions(ctx context.Context, limit, offset int) (*RequisitionPage, error) {
+	var page RequisitionPage
 
-	resp, err := c.httpClient.Do(req)
+	err := c.call(ctx, http.MethodGet, "/requisitions/"+listQuery(limit, offset), nil, &page, "fetching requisitions")
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to make http request")
+		return nil, err
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		if err := extractError(resp); err != nil {
-			return nil, errors.Wrap(err, "failed to fetch accounts")
+	return &page, nil
+}
+
+// ListAllRequisitions fetches all requisitions by following the pagination.
+func (c *Client) ListAllRequisitions(ctx context.Context) ([]*Requisition, error) {
+	var requisitions []*Requisition
+
+	for {
+		page, err := c.ListRequisitions(ctx, 0, len(requisitions))
+		if err != nil {
+			return nil, err
 		}
 
-		return nil, errors.Errorf("received unexpected status code when fetching accounts: %s", resp.Status)
+		requisitions = append(requisitions, page.Results...)
+
+		if page.Next == "" || len(page.Results) == 0 || len(requisitions) >= page.Count {
+			return requisitions, nil
+		}
 	}
+}
+
+// RequisitionRequest contains the parameters to create a requisition.
+type RequisitionRequest struct {
+	Redirect         string `json:"redirect"`
+	InstitutionID    string `json:"institution_id"`
+	Reference        string `json:"reference,omitempty"`
+	Agreement        string `json:"agreement,omitempty"`
+	UserLanguage     string `json:"user_language,omitempty"`
+	AccountSelection bool   `json:"account_selection,omitempty"`
+}
 
-	var accountList AccountList
+// CreateRequisition creates a requisition, the user has to visit the returned link to connect their bank account.
+func (c *Client) CreateRequisition(ctx context.Context, requisitionRequest *RequisitionRequest) (*Requisition, error) {
+	var requisition Requisition
 
-	err = json.NewDecoder(resp.Body).Decode(&accountList)
+	err := c.call(ctx, http.MethodPost, "/requisitions/", requisitionRequest, &requisition, "creating requisition")
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to decode response body")
+		return nil, err
 	}
 
-	return &accountList, nil
+	return &requisition, nil
+}
+
+// DeleteRequisition deletes a requisition and its end user agreement.
+func (c *Client) DeleteRequisition(ctx context.Context, requisitionID string) error {
+	return c.call(ctx, http.MethodDelete, fmt.Sprintf("/requisitions/%s/", requisitionID), nil, nil, "deleting requisition")
 }
@@ -0,0 +1,153 @@
+package nordigen_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen/nordigentest"
+	"github.com/pkg/errors"
+)
+
+// newTestClient starts a fake API and creates a client authenticated against it.
+func newTestClient(t *testing.T) (*nordigentest.Server, *nordigen.Client) {
+	t.Helper()
+
+	server := nordigentest.NewServer()
+	t.Cleanup(server.Close)
+
+	client, err := server.Client()
+	if err != nil {
+		t.Fatalf("failed to create client: %v", err)
+	}
+
+	return server, client
+}
+
+func TestListRequisitions(t *testing.T) {
+	ctx := context.Background()
+	server, client := newTestClient(t)
+
+	for i := 0; i < 5; i++ {
+		server.AddRequisition(&nordigen.Requisition{ID: fmt.Sprintf("requisition-%d", i)})
+	}
+
+	page, err := client.ListRequisitions(ctx, 2, 1)
+	if err != nil {
+		t.Fatalf("failed to list requisitions: %v", err)
+	}
+
+	if page.Count != 5 || page.Next == "" || len(page.Results) != 2 ||
+		page.Results[0].ID != "requisition-1" || page.Results[1].ID != "requisition-2" {
+		t.Errorf("expected the second and third requisition, got %+v", page)
+	}
+
+	page, err = client.ListRequisitions(ctx, 2, 4)
+	if err != nil {
+		t.Fatalf("failed to list requisitions: %v", err)
+	}
+
+	if page.Next != "" || len(page.Results) != 1 {
+		t.Errorf("expected the last page, got %+v", page)
+	}
+}
+
+func TestListAllRequisitions(t *testing.T) {
+	const total = 250
+
+	server, client := newTestClient(t)
+
+	for i := 0; i < total; i++ {
+		server.AddRequisition(&nordigen.Requisition{ID: fmt.Sprintf("requisition-%d", i)})
+	}
+
+	requisitions, err := client.ListAllRequisitions(context.Background())
+	if err != nil {
+		t.Fatalf("failed to list requisitions: %v", err)
+	}
+
+	if len(requisitions) != total {
+		t.Fatalf("expected %d requisitions, got %d", total, len(requisitions))
+	}
+
+	for i, requisition := range requisitions {
+		if want := fmt.Sprintf("requisition-%d", i); requisition.ID != want {
+			t.Fatalf("expected requisition %s at %d, got %s", want, i, requisition.ID)
+		}
+	}
+
+	// the pages of the default size are followed
+	var offsets []string
+
+	for _, req := range server.Requests() {
+		if req.Path == "/requisitions/" {
+			offsets = append(offsets, req.Query.Get("offset"))
+		}
+	}
+
+	if fmt.Sprint(offsets) != "[ 100 200]" {
+		t.Errorf("expected the offsets of three pages, got %q", offsets)
+	}
+}
+
+func TestListAllRequisitionsEmpty(t *testing.T) {
+	_, client := newTestClient(t)
+
+	requisitions, err := client.ListAllRequisitions(context.Background())
+	if err != nil {
+		t.Fatalf("failed to list requisitions: %v", err)
+	}
+
+	if len(requisitions) != 0 {
+		t.Errorf("expected no requisitions, got %+v", requisitions)
+	}
+}
+
+func TestCreateAndDeleteRequisition(t *testing.T) {
+	ctx := context.Background()
+	server, client := newTestClient(t)
+
+	requisition, err := client.CreateRequisition(ctx, &nordigen.RequisitionRequest{
+		Redirect:      "http://127.0.0.1/callback",
+		InstitutionID: "BANK",
+		Reference:     "reference",
+		Agreement:     "agreement-1",
+		UserLanguage:  "DE",
+	})
+	if err != nil {
+		t.Fatalf("failed to create requisition: %v", err)
+	}
+
+	if requisition.ID == "" || requisition.Link == "" || requisition.Status != nordigen.RequisitionStatusCreated ||
+		requisition.Redirect != "http://127.0.0.1/callback" || requisition.InstitutionID != "BANK" ||
+		requisition.Reference != "reference" || requisition.Agreement != "agreement-1" || requisition.UserLanguage != "DE" {
+		t.Errorf("unexpected requisition %+v", requisition)
+	}
+
+	fetched, err := client.GetRequisition(ctx, requisition.ID)
+	if err != nil {
+		t.Fatalf("failed to fetch requisition: %v", err)
+	}
+
+	if fetched.ID != requisition.ID || fetched.Link != requisition.Link {
+		t.Errorf("expected the created requisition, got %+v", fetched)
+	}
+
+	err = client.DeleteRequisition(ctx, requisition.ID)
+	if err != nil {
+		t.Fatalf("failed to delete requisition: %v", err)
+	}
+
+	if requisitions := server.Requisitions(); len(requisitions) != 0 {
+		t.Errorf("expected the requisition to be deleted, got %+v", requisitions)
+	}
+
+	err = client.DeleteRequisition(ctx, requisition.ID)
+
+	var apiErr *nordigen.APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("expected deleting an unknown requisition to fail as not found, got %v", err)
+	}
+}
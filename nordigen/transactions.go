@@ -5,8 +5,8 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
-	"strconv"
-	"strings"
+	"net/url"
+	"time"
 
 	"github.com/pkg/errors"
 )
@@ -34,6 +34,7 @@ type Transaction struct {
 	UltimateCreditor                       string   `json:"ultimateCreditor"`
 	MandateID                              string   `json:"mandateId"`
 	EndToEndID                             string   `json:"endToEndId"`
+	MerchantCategoryCode                   string   `json:"merchantCategoryCode"`
 
 	DebtorName    string       `json:"debtorName"`
 	DebtorAccount *IBANAccount `json:"debtorAccount"`
@@ -84,57 +85,45 @@ type CurrencyExchange struct {
 	InstructedAmount Amount `json:"instructedAmount"`
 }
 
-// TransactionAmountValue is a value for a transaction amount.
-type TransactionAmountValue float64
-
-// UnmarshalJSON provides custom JSON unmarshalling for TransactionAmountValue.
-func (tav *TransactionAmountValue) UnmarshalJSON(b []byte) error {
-	amount, err := strconv.ParseFloat(strings.Trim(string(b), "\""), 64)
-	if err != nil {
-		return errors.Wrapf(err, "could not parse transaction amount value %q", strings.Trim(string(b), "\""))
-	}
-
-	*tav = TransactionAmountValue(amount)
-
-	return nil
+// TransactionsOptions limits the transactions returned to a date range.
+// Zero dates are not sent to the API.
+type TransactionsOptions struct {
+	DateFrom time.Time
+	DateTo   time.Time
 }
 
-// Transactions returns a list of all transactions for the given account.
-func (c *Client) Transactions(ctx context.Context, accountID string) (*Transactions, error) {
-	req, err := http.NewRequestWithContext(
-		ctx,
-		http.MethodGet,
-		fmt.Sprintf("%s/accounts/%s/transactions/", baseURL, accountID),
-		nil,
-	)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to create http request")
+func (o *TransactionsOptions) query() string {
+	if o == nil {
+		return ""
 	}
 
-	req.Header.Add("Content-Type", "application/json; charset=utf-8")
-	req.Header.Add("Authorization", "Bearer "+c.accessKey)
+	query := url.Values{}
 
-	resp, err := c.httpClient.Do(req)
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to make http request")
+	if !o.DateFrom.IsZero() {
+		query.Set("date_from", o.DateFrom.Format("2006-01-02"))
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != http.StatusOK {
-		if err := extractError(resp); err != nil {
-			return nil, errors.Wrap(err, "failed to fetch transactions")
-		}
+	if !o.DateTo.IsZero() {
+		query.Set("date_to", o.DateTo.Format("2006-01-02"))
+	}
 
-		return nil, errors.Errorf("received unexpected status code when fetching transactions: %s", resp.Status)
+	if len(query) == 0 {
+		return ""
 	}
 
+	return "?" + query.Encode()
+}
+
+// Transactions returns a list of transactions for the given account.
+// If opts is nil all available transactions are returned.
+func (c *Client) Transactions(ctx context.Context, accountID string, opts *TransactionsOptions) (*Transactions, error) {
 	var transactions struct {
 		Transactions *Transactions `json:"transactions"`
 	}
 
-	err = json.NewDecoder(resp.Body).Decode(&transactions)
+	err := c.call(ctx, http.MethodGet, fmt.Sprintf("/accounts/%s/transactions/%s", accountID, opts.query()), nil, &transactions, "fetching transactions")
 	if err != nil {
-		return nil, errors.Wrap(err, "failed to decode response body")
+		return nil, err
 	}
 
 	return transactions.Transactions, nil
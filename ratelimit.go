@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/state"
+	"github.com/pkg/errors"
+)
+
+// quotaGuard skips requests to Nordigen endpoints of an account which have no requests left until their limit resets.
+// If spread is set the remaining requests are spread evenly until the reset.
+type quotaGuard struct {
+	spread bool
+}
+
+// quotaError is returned if a request is skipped to stay within the rate limit of an endpoint.
+type quotaError struct {
+	Endpoint  string
+	Remaining int
+	RetryAt   time.Time
+}
+
+// Error returns the error message of a quota error.
+func (e *quotaError) Error() string {
+	return fmt.Sprintf("skipped requesting %s to stay within the rate limit, %d requests remaining, next request at %s",
+		e.Endpoint,
+		e.Remaining,
+		e.RetryAt.Format(time.RFC3339),
+	)
+}
+
+// responseCache is implemented by Nordigen clients answering requests from a cache.
+type responseCache interface {
+	Cached(accountID, endpoint string) bool
+}
+
+// cachedResponse returns true if the client answers requests to the endpoint of the account from its cache,
+// they do not reach Nordigen and do not count against the rate limit.
+func cachedResponse(client nordigenAPI, accountID, endpoint string) bool {
+	cache, ok := client.(responseCache)
+
+	return ok && cache.Cached(accountID, endpoint)
+}
+
+// check returns a *quotaError if the endpoint should not be requested now.
+func (g *quotaGuard) check(accountState *state.Account, endpoint string, now time.Time) error {
+	if g == nil {
+		return nil
+	}
+
+	rateLimit := accountState.RateLimits[endpoint]
+	if rateLimit == nil || !now.Before(rateLimit.Reset) {
+		return nil
+	}
+
+	if rateLimit.Remaining <= 0 {
+		return &quotaError{
+			Endpoint: endpoint,
+			RetryAt:  rateLimit.Reset,
+		}
+	}
+
+	if g.spread && !rateLimit.LastRequest.IsZero() {
+		// leave the same time between all remaining requests and the reset
+		interval := rateLimit.Reset.Sub(rateLimit.LastRequest) / time.Duration(rateLimit.Remaining+1)
+
+		if next := rateLimit.LastRequest.Add(interval); now.Before(next) {
+			return &quotaError{
+				Endpoint:  endpoint,
+				Remaining: rateLimit.Remaining,
+				RetryAt:   next,
+			}
+		}
+	}
+
+	return nil
+}
+
+// record stores the rate limit last reported by Nordigen for the endpoint in the state.
+// It returns true if the state has been changed.
+func (g *quotaGuard) record(accountState *state.Account, endpoint string, rateLimit *nordigen.RateLimit, now time.Time) bool {
+	if g == nil {
+		return false
+	}
+
+	remaining, reset, ok := rateLimit.Quota()
+	if !ok || reset.IsZero() {
+		return false
+	}
+
+	accountState.SetRateLimit(endpoint, &state.RateLimit{
+		Remaining:   remaining,
+		Reset:       reset,
+		LastRequest: now,
+	})
+
+	return true
+}
+
+// rateLimited returns the time to try again if the error was caused by a Nordigen rate limit.
+func rateLimited(err error) (time.Time, bool) {
+	var rateLimitErr *nordigen.RateLimitError
+	if errors.As(err, &rateLimitErr) {
+		return rateLimitErr.ResetAt(), true
+	}
+
+	var quotaErr *quotaError
+	if errors.As(err, &quotaErr) {
+		return quotaErr.RetryAt, true
+	}
+
+	return time.Time{}, false
+}
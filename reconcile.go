@@ -0,0 +1,266 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/lunchmoney"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/money"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// reconcileFixTransaction inserts a transaction adjusting the Lunchmoney balance by the difference.
+	reconcileFixTransaction = "transaction"
+	// reconcileFixBalance sets the Lunchmoney balance to the bank balance.
+	reconcileFixBalance = "balance"
+
+	// adjustmentPayee is the payee of transactions inserted to fix the difference of the balances.
+	adjustmentPayee = "Balance adjustment"
+)
+
+// balanceComparison is the comparison of a Nordigen balance with the balance of a Lunchmoney asset.
+type balanceComparison struct {
+	Account           *accountConfig
+	BalanceType       string
+	BankBalance       money.Amount
+	BankCurrency      string
+	LunchmoneyBalance money.Amount
+	Currency          string
+	// Difference is the bank balance minus the Lunchmoney balance, it is only set if both currencies match.
+	Difference *money.Amount
+	Fixed      bool
+}
+
+// reconcile compares the balances of all mapped Nordigen accounts with their Lunchmoney assets
+// and prints the differences, optionally fixing them.
+func reconcile(
+	ctx context.Context,
+	args []string,
+	out io.Writer,
+	accounts []*accountConfig,
+	nordigenClient nordigenAPI,
+	lunchmoneyClient lunchmoneyAPI,
+	log *zap.Logger,
+) error {
+	flags := flag.NewFlagSet("reconcile", flag.ContinueOnError)
+	flags.SetOutput(out)
+
+	fix := flags.String("fix", "", "fix differences by inserting a \"transaction\" or updating the \"balance\" of the asset")
+	balanceType := flags.String("type", "expected", "Nordigen balance type the Lunchmoney balance is fixed to")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse flags")
+	}
+
+	if *fix != "" && *fix != reconcileFixTransaction && *fix != reconcileFixBalance {
+		return errors.Errorf("unknown fix %q", *fix)
+	}
+
+	assets, err := lunchmoneyClient.GetAssets(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch assets from Lunchmoney")
+	}
+
+	assetsByID := make(map[int]*lunchmoney.Asset, len(assets))
+	for _, asset := range assets {
+		assetsByID[asset.ID] = asset
+	}
+
+	var (
+		comparisons   []*balanceComparison
+		total, failed int
+	)
+
+	seen := make(map[string]bool, len(accounts))
+
+	for _, account := range accounts {
+		key := stateKey(account.NordigenAccountID, account.LunchmoneyAssetID)
+		if seen[key] {
+			continue
+		}
+
+		seen[key] = true
+		total++
+
+		accountComparisons, err := reconcileAccount(ctx, account, assetsByID[account.LunchmoneyAssetID], *fix, *balanceType, nordigenClient, lunchmoneyClient, log)
+		if err != nil {
+			failed++
+
+			log.Error("reconciling failed",
+				zap.String("name", account.name()),
+				zap.String("nordigen_account_id", account.NordigenAccountID),
+				zap.Int("lunchmoney_asset_id", account.LunchmoneyAssetID),
+				zap.Error(err),
+			)
+		}
+
+		comparisons = append(comparisons, accountComparisons...)
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "NAME\tASSET ID\tBALANCE TYPE\tBANK BALANCE\tLUNCHMONEY BALANCE\tDIFFERENCE\tFIXED")
+	for _, comparison := range comparisons {
+		difference := "-"
+		if comparison.Difference != nil {
+			difference = comparison.Difference.Format(comparison.Currency)
+			if !comparison.Difference.IsNegative() {
+				difference = "+" + difference
+			}
+		}
+
+		fixed := "-"
+		if comparison.Fixed {
+			fixed = "yes"
+		}
+
+		fmt.Fprintf(tw, "%s\t%d\t%s\t%s %s\t%s %s\t%s\t%s\n",
+			comparison.Account.name(),
+			comparison.Account.LunchmoneyAssetID,
+			comparison.BalanceType,
+			comparison.BankBalance.Format(comparison.BankCurrency),
+			strings.ToUpper(comparison.BankCurrency),
+			comparison.LunchmoneyBalance.Format(comparison.Currency),
+			strings.ToUpper(comparison.Currency),
+			difference,
+			fixed,
+		)
+	}
+
+	err = tw.Flush()
+	if err != nil {
+		return errors.Wrap(err, "failed to write balances")
+	}
+
+	if failed > 0 {
+		return &syncError{
+			Failed: failed,
+			Total:  total,
+		}
+	}
+
+	return nil
+}
+
+// reconcileAccount compares the balances of a Nordigen account with its Lunchmoney asset and fixes the
+// difference to the balance type if fix is set. The comparisons made are returned even if fixing fails.
+func reconcileAccount(
+	ctx context.Context,
+	account *accountConfig,
+	asset *lunchmoney.Asset,
+	fix string,
+	balanceType string,
+	nordigenClient nordigenAPI,
+	lunchmoneyClient lunchmoneyAPI,
+	log *zap.Logger,
+) ([]*balanceComparison, error) {
+	if asset == nil {
+		return nil, errors.New("unable to find Lunchmoney asset")
+	}
+
+	balances, err := nordigenClient.GetAccountBalances(ctx, account.NordigenAccountID)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch account balances from Nordigen")
+	}
+
+	var lunchmoneyBalance money.Amount
+	if asset.Balance != nil {
+		lunchmoneyBalance = *asset.Balance
+	}
+
+	comparisons := make([]*balanceComparison, 0, len(balances))
+
+	var target *balanceComparison
+
+	for _, balance := range balances {
+		comparison := &balanceComparison{
+			Account:           account,
+			BalanceType:       balance.BalanceType,
+			BankBalance:       balance.BalanceAmount.Amount.Round(balance.BalanceAmount.Currency),
+			BankCurrency:      balance.BalanceAmount.Currency,
+			LunchmoneyBalance: lunchmoneyBalance,
+			Currency:          asset.Currency,
+		}
+
+		if strings.EqualFold(balance.BalanceAmount.Currency, asset.Currency) {
+			difference := comparison.BankBalance.Sub(lunchmoneyBalance)
+			comparison.Difference = &difference
+
+			if balance.BalanceType == balanceType && target == nil {
+				target = comparison
+			}
+		}
+
+		comparisons = append(comparisons, comparison)
+	}
+
+	if target == nil {
+		if fix != "" {
+			return comparisons, errors.Errorf("no %s balance in the currency of the asset reported by the bank", balanceType)
+		}
+
+		log.Warn("no balance of the type in the currency of the asset reported by the bank",
+			zap.String("name", account.name()),
+			zap.String("balance_type", balanceType),
+			zap.String("currency", asset.Currency),
+		)
+
+		return comparisons, nil
+	}
+
+	if fix == "" || target.Difference.IsZero() {
+		return comparisons, nil
+	}
+
+	err = fixBalance(ctx, fix, target, lunchmoneyClient)
+	if err != nil {
+		return comparisons, err
+	}
+
+	target.Fixed = true
+
+	log.Info("fixed balance",
+		zap.String("fix", fix),
+		zap.String("name", account.name()),
+		zap.Int("lunchmoney_asset_id", account.LunchmoneyAssetID),
+		zap.Stringer("difference", target.Difference),
+	)
+
+	return comparisons, nil
+}
+
+// fixBalance fixes the difference of the balances by inserting an adjustment transaction
+// or by setting the balance of the asset.
+func fixBalance(ctx context.Context, fix string, comparison *balanceComparison, lunchmoneyClient lunchmoneyAPI) error {
+	if fix == reconcileFixBalance {
+		return errors.Wrap(lunchmoneyClient.UpdateAsset(ctx, comparison.Account.LunchmoneyAssetID, &lunchmoney.Asset{
+			Balance: &comparison.BankBalance,
+		}), "failed to update Lunchmoney asset")
+	}
+
+	_, err := lunchmoneyClient.InsertTransactions(ctx, []*lunchmoney.Transaction{
+		{
+			AssetID:  comparison.Account.LunchmoneyAssetID,
+			Date:     lunchmoney.TransactionDate(time.Now()),
+			Amount:   *comparison.Difference,
+			Currency: strings.ToLower(comparison.Currency),
+			Payee:    adjustmentPayee,
+			Notes: fmt.Sprintf("Reconciled with the %s balance of %s %s",
+				comparison.BalanceType,
+				comparison.BankBalance.Format(comparison.BankCurrency),
+				strings.ToUpper(comparison.BankCurrency),
+			),
+			Status: lunchmoney.TransactionStatusCleared,
+		},
+	})
+
+	return errors.Wrap(err, "failed to insert adjustment transaction")
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen/nordigentest"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestReconcile(t *testing.T) {
+	ctx := context.Background()
+	servers := newTestServers(t)
+
+	servers.nordigen.SetAccount(testAccountID, &nordigentest.Account{
+		Details: &nordigen.Account{Currency: "EUR"},
+		Balances: []*nordigentest.Balance{
+			{Amount: "90.00", Currency: "EUR", Type: "closingBooked"},
+			{Amount: "87.5", Currency: "EUR", Type: "expected"},
+			{Amount: "50.00", Currency: "USD", Type: "expected"},
+		},
+	})
+
+	accounts := []*accountConfig{
+		{Name: "Checking", NordigenAccountID: testAccountID, LunchmoneyAssetID: servers.asset.ID, Balance: true},
+		{Name: "Checking", NordigenAccountID: testAccountID, LunchmoneyAssetID: servers.asset.ID, Transactions: true},
+	}
+
+	run := func(args ...string) string {
+		t.Helper()
+
+		var out bytes.Buffer
+
+		err := reconcile(ctx, args, &out, accounts, servers.nordigenClient, servers.lunchmoneyClient, zaptest.NewLogger(t))
+		if err != nil {
+			t.Fatalf("failed to reconcile: %v", err)
+		}
+
+		return out.String()
+	}
+
+	// all balances are reported without fixing anything
+	out := run()
+
+	lines := strings.Split(strings.TrimSpace(out), "\n")
+	if len(lines) != 4 {
+		t.Fatalf("expected a header and 3 balances, got:\n%s", out)
+	}
+
+	for i, want := range []string{"closingBooked", "expected", "expected"} {
+		if !strings.Contains(lines[i+1], want) {
+			t.Errorf("expected balance type %s in line %q", want, lines[i+1])
+		}
+	}
+
+	if !strings.Contains(lines[1], "-10.00") || !strings.Contains(lines[2], "-12.50") {
+		t.Errorf("unexpected differences:\n%s", out)
+	}
+
+	if len(servers.lunchmoney.Transactions()) != 0 || servers.lunchmoney.Asset(servers.asset.ID).Balance.String() != "100" {
+		t.Fatal("expected nothing to be fixed without -fix")
+	}
+
+	// the difference to the expected balance is inserted as a transaction
+	run("-fix=transaction")
+
+	transactions := servers.lunchmoney.Transactions()
+	if len(transactions) != 1 || transactions[0].Amount.String() != "-12.50" || transactions[0].Payee != adjustmentPayee ||
+		transactions[0].AssetID != servers.asset.ID {
+		t.Fatalf("expected an adjustment transaction, got %+v", transactions)
+	}
+
+	// the balance of the asset is set to the closing booked balance
+	run("-fix=balance", "-type=closingBooked")
+
+	if balance := servers.lunchmoney.Asset(servers.asset.ID).Balance; balance == nil || balance.String() != "90.00" {
+		t.Fatalf("expected balance 90.00, got %v", balance)
+	}
+
+	err := reconcile(ctx, []string{"-fix=unknown"}, io.Discard, accounts, servers.nordigenClient, servers.lunchmoneyClient, zaptest.NewLogger(t))
+	if err == nil {
+		t.Fatal("expected an error for an unknown fix")
+	}
+}
+
+func TestReconcileFailures(t *testing.T) {
+	ctx := context.Background()
+	servers := newTestServers(t)
+
+	servers.nordigen.SetAccount(testAccountID, &nordigentest.Account{
+		Details: &nordigen.Account{Currency: "EUR"},
+		Balances: []*nordigentest.Balance{
+			{Amount: "90.00", Currency: "EUR", Type: "closingBooked"},
+		},
+	})
+	servers.nordigen.SetAccount("account-2", &nordigentest.Account{
+		Details: &nordigen.Account{Currency: "EUR"},
+	})
+
+	accounts := []*accountConfig{
+		{NordigenAccountID: testAccountID, LunchmoneyAssetID: servers.asset.ID, Balance: true},
+		{NordigenAccountID: "account-2", LunchmoneyAssetID: servers.asset.ID, Balance: true},
+	}
+
+	reconcileWith := func(args ...string) error {
+		return reconcile(ctx, args, io.Discard, accounts, servers.nordigenClient, servers.lunchmoneyClient, zaptest.NewLogger(t))
+	}
+
+	// a missing balance type is only reported without fixing
+	err := reconcileWith()
+	if err != nil {
+		t.Fatalf("failed to reconcile: %v", err)
+	}
+
+	// the balances of the second account cannot be fetched
+	servers.nordigen.Fail("/accounts/account-2/balances/", http.StatusInternalServerError, 10)
+
+	err = reconcileWith("-fix=balance", "-type=closingBooked")
+	if exitCode(err) != exitCodePartialFailure {
+		t.Fatalf("expected a partial failure, got %v", err)
+	}
+
+	if balance := servers.lunchmoney.Asset(servers.asset.ID).Balance; balance.String() != "90.00" {
+		t.Errorf("expected the first account to be fixed, got %v", balance)
+	}
+
+	// the expected balance is not reported by the bank and the second account still fails
+	err = reconcileWith("-fix=transaction")
+	if exitCode(err) != exitCodeFailure || err == nil {
+		t.Fatalf("expected a failure, got %v", err)
+	}
+
+	if transactions := servers.lunchmoney.Transactions(); len(transactions) != 0 {
+		t.Errorf("expected nothing to be inserted, got %+v", transactions)
+	}
+}
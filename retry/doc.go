@@ -0,0 +1,4 @@
+/*
+Package retry retries HTTP requests failing with transient errors using exponential backoff.
+*/
+package retry
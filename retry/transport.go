@@ -0,0 +1,303 @@
+package retry
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Defaults used for zero values of the transport settings.
+const (
+	DefaultMaxRetries    = 4
+	DefaultMinBackoff    = 500 * time.Millisecond
+	DefaultMaxBackoff    = 30 * time.Second
+	DefaultMaxRetryAfter = time.Minute
+)
+
+// maxDrainBytes is the maximum number of bytes read from the body of a discarded response
+// to allow reusing the connection.
+const maxDrainBytes = 4096
+
+// Transport is an http.RoundTripper retrying idempotent requests which failed with a connection error,
+// a timeout or a server error. Requests are retried with exponential backoff and jitter,
+// a Retry-After header of the response is honoured.
+//
+// GET, HEAD, OPTIONS and PUT requests are idempotent, other requests are only retried if their context
+// has been marked with Idempotent. Requests whose context has been marked with NotIdempotent are never retried.
+type Transport struct {
+	// Base executes the requests, http.DefaultTransport is used if it is nil.
+	Base http.RoundTripper
+	// MaxRetries is the maximum number of retries of a request, a negative value disables retries.
+	MaxRetries int
+	// MinBackoff is the wait before the first retry, it is doubled for every further retry.
+	MinBackoff time.Duration
+	// MaxBackoff caps the wait between retries.
+	MaxBackoff time.Duration
+	// MaxRetryAfter is the longest Retry-After accepted, responses asking for a longer wait are returned.
+	MaxRetryAfter time.Duration
+	// Timeout limits the duration of every single attempt including reading the response body.
+	Timeout time.Duration
+	// OnRetry is called before waiting for a retry with the reason of the retry.
+	OnRetry func(req *http.Request, attempt int, wait time.Duration, reason error)
+}
+
+type idempotentKey struct{}
+
+// Idempotent marks requests made with the returned context as safe to retry,
+// e.g. because the server deduplicates them.
+func Idempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, true)
+}
+
+// NotIdempotent marks requests made with the returned context as unsafe to retry regardless of their method,
+// e.g. a PUT which cannot be applied twice.
+func NotIdempotent(ctx context.Context) context.Context {
+	return context.WithValue(ctx, idempotentKey{}, false)
+}
+
+// RoundTrip executes a request, retrying it if it failed with a transient error.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	maxRetries := t.MaxRetries
+	if maxRetries == 0 {
+		maxRetries = DefaultMaxRetries
+	}
+
+	if !retryable(req) {
+		maxRetries = 0
+	}
+
+	for attempt := 0; ; attempt++ {
+		attemptReq, err := rewind(req, attempt)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := t.roundTrip(attemptReq)
+		if attempt >= maxRetries || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		wait, retry := t.shouldRetry(resp, err, attempt)
+		if !retry {
+			return resp, err
+		}
+
+		reason := err
+		if resp != nil {
+			reason = errors.Errorf("received status code %s", resp.Status)
+
+			// read the rest of the body so the connection can be reused
+			io.CopyN(io.Discard, resp.Body, maxDrainBytes)
+			resp.Body.Close()
+		}
+
+		if t.OnRetry != nil {
+			t.OnRetry(req, attempt+1, wait, reason)
+		}
+
+		timer := time.NewTimer(wait)
+
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// roundTrip executes a single attempt of a request.
+func (t *Transport) roundTrip(req *http.Request) (*http.Response, error) {
+	base := t.Base
+	if base == nil {
+		base = http.DefaultTransport
+	}
+
+	if t.Timeout <= 0 {
+		return base.RoundTrip(req)
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), t.Timeout)
+
+	resp, err := base.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// the timeout ends once the body has been read
+	resp.Body = &cancelBody{
+		ReadCloser: resp.Body,
+		cancel:     cancel,
+	}
+
+	return resp, nil
+}
+
+// shouldRetry returns the wait before the next attempt, false is returned if the attempt must not be retried.
+func (t *Transport) shouldRetry(resp *http.Response, err error, attempt int) (time.Duration, bool) {
+	if err != nil {
+		return t.backoff(attempt), true
+	}
+
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+	default:
+		return 0, false
+	}
+
+	wait := t.backoff(attempt)
+
+	retryAfter, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now())
+	if !ok {
+		// rate limits without a Retry-After can last until the next day
+		if resp.StatusCode == http.StatusTooManyRequests {
+			return 0, false
+		}
+
+		return wait, true
+	}
+
+	maxRetryAfter := t.MaxRetryAfter
+	if maxRetryAfter == 0 {
+		maxRetryAfter = DefaultMaxRetryAfter
+	}
+
+	if retryAfter > maxRetryAfter {
+		return 0, false
+	}
+
+	if retryAfter > wait {
+		wait = retryAfter
+	}
+
+	return wait, true
+}
+
+// backoff returns the wait before a retry, it grows exponentially with every attempt.
+// A random jitter of up to half the wait prevents clients from retrying at the same time.
+func (t *Transport) backoff(attempt int) time.Duration {
+	minBackoff := t.MinBackoff
+	if minBackoff <= 0 {
+		minBackoff = DefaultMinBackoff
+	}
+
+	maxBackoff := t.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultMaxBackoff
+	}
+
+	wait := minBackoff
+	for i := 0; i < attempt && wait < maxBackoff; i++ {
+		wait *= 2
+	}
+
+	if wait > maxBackoff {
+		wait = maxBackoff
+	}
+
+	return wait/2 + jitter(wait/2)
+}
+
+var (
+	randLock sync.Mutex
+	random   = rand.New(rand.NewSource(time.Now().UnixNano()))
+)
+
+// jitter returns a random duration in [0, max].
+func jitter(max time.Duration) time.Duration {
+	if max <= 0 {
+		return 0
+	}
+
+	randLock.Lock()
+	defer randLock.Unlock()
+
+	return time.Duration(random.Int63n(int64(max) + 1))
+}
+
+// retryable returns true if the request can be sent again without side effects.
+func retryable(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false // the body cannot be sent again
+	}
+
+	// an explicit mark takes precedence over the method
+	if idempotent, ok := req.Context().Value(idempotentKey{}).(bool); ok {
+		return idempotent
+	}
+
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut:
+		return true
+	}
+
+	return false
+}
+
+// rewind returns the request to send for an attempt, retries get a copy with a fresh body.
+func rewind(req *http.Request, attempt int) (*http.Request, error) {
+	if attempt == 0 || req.GetBody == nil {
+		return req, nil
+	}
+
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to rewind request body")
+	}
+
+	retryReq := req.Clone(req.Context())
+	retryReq.Body = body
+
+	return retryReq, nil
+}
+
+// parseRetryAfter parses a Retry-After header containing either seconds or an HTTP date.
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	date, err := http.ParseTime(value)
+	if err != nil {
+		return 0, false
+	}
+
+	if wait := date.Sub(now); wait > 0 {
+		return wait, true
+	}
+
+	return 0, true
+}
+
+// cancelBody cancels the context of an attempt once the response body is closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close closes the body and releases the context of the attempt.
+func (b *cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+
+	return err
+}
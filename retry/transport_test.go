@@ -0,0 +1,286 @@
+package retry
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testServer responds with the given status codes in order, the last one is repeated.
+type testServer struct {
+	*httptest.Server
+
+	lock     sync.Mutex
+	statuses []int
+	header   http.Header
+	bodies   []string
+}
+
+func newTestServer(t *testing.T, header http.Header, statuses ...int) *testServer {
+	s := &testServer{
+		statuses: statuses,
+		header:   header,
+	}
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+
+		s.lock.Lock()
+		defer s.lock.Unlock()
+
+		status := s.statuses[0]
+		if len(s.statuses) > 1 {
+			s.statuses = s.statuses[1:]
+		}
+
+		s.bodies = append(s.bodies, string(body))
+
+		if status != http.StatusOK {
+			for key, values := range s.header {
+				w.Header()[key] = values
+			}
+		}
+
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(s.Close)
+
+	return s
+}
+
+func (s *testServer) requests() []string {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	return append([]string(nil), s.bodies...)
+}
+
+func newTestClient() *http.Client {
+	return &http.Client{
+		Transport: &Transport{
+			MinBackoff: time.Millisecond,
+			MaxBackoff: 5 * time.Millisecond,
+		},
+	}
+}
+
+func TestTransport(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		idempotent    bool
+		notIdempotent bool
+		header        http.Header
+		statuses      []int
+		wantStatus    int
+		wantTries     int
+	}{
+		{
+			name:       "get succeeds after server errors",
+			method:     http.MethodGet,
+			statuses:   []int{http.StatusServiceUnavailable, http.StatusBadGateway, http.StatusOK},
+			wantStatus: http.StatusOK,
+			wantTries:  3,
+		},
+		{
+			name:       "put succeeds after server error",
+			method:     http.MethodPut,
+			statuses:   []int{http.StatusInternalServerError, http.StatusOK},
+			wantStatus: http.StatusOK,
+			wantTries:  2,
+		},
+		{
+			name:       "gives up after max retries",
+			method:     http.MethodGet,
+			statuses:   []int{http.StatusGatewayTimeout},
+			wantStatus: http.StatusGatewayTimeout,
+			wantTries:  DefaultMaxRetries + 1,
+		},
+		{
+			name:       "post is not retried",
+			method:     http.MethodPost,
+			statuses:   []int{http.StatusServiceUnavailable, http.StatusOK},
+			wantStatus: http.StatusServiceUnavailable,
+			wantTries:  1,
+		},
+		{
+			name:       "idempotent post is retried",
+			method:     http.MethodPost,
+			idempotent: true,
+			statuses:   []int{http.StatusServiceUnavailable, http.StatusOK},
+			wantStatus: http.StatusOK,
+			wantTries:  2,
+		},
+		{
+			name:          "put marked as not idempotent is not retried",
+			method:        http.MethodPut,
+			notIdempotent: true,
+			statuses:      []int{http.StatusBadGateway, http.StatusOK},
+			wantStatus:    http.StatusBadGateway,
+			wantTries:     1,
+		},
+		{
+			name:       "client errors are not retried",
+			method:     http.MethodGet,
+			statuses:   []int{http.StatusBadRequest, http.StatusOK},
+			wantStatus: http.StatusBadRequest,
+			wantTries:  1,
+		},
+		{
+			name:       "rate limit without retry after is not retried",
+			method:     http.MethodGet,
+			statuses:   []int{http.StatusTooManyRequests, http.StatusOK},
+			wantStatus: http.StatusTooManyRequests,
+			wantTries:  1,
+		},
+		{
+			name:       "rate limit with retry after is retried",
+			method:     http.MethodGet,
+			header:     http.Header{"Retry-After": []string{"0"}},
+			statuses:   []int{http.StatusTooManyRequests, http.StatusOK},
+			wantStatus: http.StatusOK,
+			wantTries:  2,
+		},
+		{
+			name:       "long retry after is not awaited",
+			method:     http.MethodGet,
+			header:     http.Header{"Retry-After": []string{"3600"}},
+			statuses:   []int{http.StatusServiceUnavailable, http.StatusOK},
+			wantStatus: http.StatusServiceUnavailable,
+			wantTries:  1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newTestServer(t, tt.header, tt.statuses...)
+
+			ctx := context.Background()
+			if tt.idempotent {
+				ctx = Idempotent(ctx)
+			}
+
+			if tt.notIdempotent {
+				ctx = NotIdempotent(ctx)
+			}
+
+			req, err := http.NewRequestWithContext(ctx, tt.method, server.URL, strings.NewReader("body"))
+			if err != nil {
+				t.Fatalf("failed to create request: %v", err)
+			}
+
+			resp, err := newTestClient().Do(req)
+			if err != nil {
+				t.Fatalf("failed to make request: %v", err)
+			}
+			resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Errorf("expected status %d, got %d", tt.wantStatus, resp.StatusCode)
+			}
+
+			requests := server.requests()
+			if len(requests) != tt.wantTries {
+				t.Fatalf("expected %d requests, got %d", tt.wantTries, len(requests))
+			}
+
+			// the body is sent again with every retry
+			for i, body := range requests {
+				if body != "body" {
+					t.Errorf("expected body of request %d to be sent, got %q", i+1, body)
+				}
+			}
+		})
+	}
+}
+
+func TestTransportConnectionErrors(t *testing.T) {
+	var lock sync.Mutex
+	var tries int
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lock.Lock()
+		tries++
+		try := tries
+		lock.Unlock()
+
+		// reset the connection of the first request
+		if try == 1 {
+			conn, _, err := w.(http.Hijacker).Hijack()
+			if err == nil {
+				conn.Close()
+			}
+
+			return
+		}
+
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer server.Close()
+
+	resp, err := newTestClient().Get(server.URL)
+	if err != nil {
+		t.Fatalf("failed to make request: %v", err)
+	}
+	resp.Body.Close()
+
+	if tries != 2 {
+		t.Errorf("expected 2 requests, got %d", tries)
+	}
+}
+
+func TestTransportCanceled(t *testing.T) {
+	server := newTestServer(t, nil, http.StatusServiceUnavailable)
+
+	client := &http.Client{
+		Transport: &Transport{
+			MinBackoff: time.Hour,
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatalf("failed to create request: %v", err)
+	}
+
+	_, err = client.Do(req)
+	if err == nil {
+		t.Fatal("expected an error if the context is canceled while waiting")
+	}
+
+	if tries := len(server.requests()); tries != 1 {
+		t.Errorf("expected 1 request, got %d", tries)
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2022, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{value: "", wantOK: false},
+		{value: "120", want: 2 * time.Minute, wantOK: true},
+		{value: "-1", wantOK: false},
+		{value: "Sat, 01 Jan 2022 12:00:30 GMT", want: 30 * time.Second, wantOK: true},
+		{value: "Sat, 01 Jan 2022 11:00:00 GMT", want: 0, wantOK: true},
+		{value: "soon", wantOK: false},
+	}
+
+	for _, tt := range tests {
+		got, ok := parseRetryAfter(tt.value, now)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("parseRetryAfter(%q) = %s, %t, expected %s, %t", tt.value, got, ok, tt.want, tt.wantOK)
+		}
+	}
+}
@@ -0,0 +1,4 @@
+/*
+Package rules rewrites transactions with user-defined rules before they are synced.
+*/
+package rules
@@ -0,0 +1,511 @@
+package rules
+
+import (
+	"bytes"
+	_ "embed" // embed default rules
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/money"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v3"
+)
+
+//go:embed defaults.yaml
+var defaultRules []byte
+
+// Rule rewrites transactions matching all of its conditions.
+type Rule struct {
+	Name  string `yaml:"name"`
+	Match Match  `yaml:"match"`
+	Set   Set    `yaml:"set"`
+	// Skip excludes matching transactions from the sync.
+	Skip bool `yaml:"skip"`
+}
+
+// Match contains the conditions of a rule, empty conditions are ignored.
+// Text conditions are regular expressions, use (?i) to match case-insensitive.
+type Match struct {
+	CreditorName                   string `yaml:"creditor_name"`
+	DebtorName                     string `yaml:"debtor_name"`
+	Payee                          string `yaml:"payee"`
+	RemittanceInformation          string `yaml:"remittance_information"`
+	BankTransactionCode            string `yaml:"bank_transaction_code"`
+	ProprietaryBankTransactionCode string `yaml:"proprietary_bank_transaction_code"`
+	AdditionalInformation          string `yaml:"additional_information"`
+	// IBAN matches the IBAN of the creditor or debtor account.
+	IBAN                 string `yaml:"iban"`
+	Currency             string `yaml:"currency"`
+	MerchantCategoryCode string `yaml:"merchant_category_code"`
+	// Keywords matches if any of the keywords is contained in the remittance or additional information,
+	// ignoring the case.
+	Keywords []string `yaml:"keywords"`
+
+	AmountMin *money.Amount `yaml:"amount_min"`
+	AmountMax *money.Amount `yaml:"amount_max"`
+}
+
+// Set contains the values a rule sets on matching transactions.
+// Text values are templates rendered with the Transaction, the Account and the current Payee and Notes,
+// values rendering to an empty string are not set.
+type Set struct {
+	Payee string `yaml:"payee"`
+	Notes string `yaml:"notes"`
+	// Category is the name of the category, it is resolved to the ID with ResolveCategories.
+	Category   string   `yaml:"category"`
+	CategoryID int      `yaml:"category_id"`
+	Tags       []string `yaml:"tags"`
+	Status     string   `yaml:"status"`
+}
+
+// Result contains the values of a transaction which rules can change.
+type Result struct {
+	Payee      string
+	Notes      string
+	CategoryID int
+	Tags       []string
+	Status     string
+	Skip       bool
+}
+
+// RuleSet is a compiled list of rules.
+type RuleSet struct {
+	rules []*compiledRule
+}
+
+type compiledRule struct {
+	rule *Rule
+
+	conditions []*condition
+	categoryID int
+	payee      *template.Template
+	notes      *template.Template
+	tags       []*template.Template
+}
+
+// condition matches values extracted from the transaction against a regular expression,
+// it matches if any of the values matches.
+type condition struct {
+	values func(data *templateData) []string
+	regexp *regexp.Regexp
+}
+
+// templateData is the data conditions are matched against and templates are rendered with.
+type templateData struct {
+	Transaction nordigen.Transaction
+	Account     nordigen.Account
+	Payee       string
+	Notes       string
+}
+
+var templateFuncs = template.FuncMap{
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"title": func(s string) string {
+		return strings.Title(strings.ToLower(s))
+	},
+}
+
+// DefaultRules returns the built-in rules.
+func DefaultRules() ([]*Rule, error) {
+	return parse(defaultRules)
+}
+
+// Load reads rules from a YAML file.
+func Load(path string) ([]*Rule, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to read rules file")
+	}
+
+	return parse(data)
+}
+
+func parse(data []byte) ([]*Rule, error) {
+	var file struct {
+		Rules []*Rule `yaml:"rules"`
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	err := decoder.Decode(&file)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode rules")
+	}
+
+	return file.Rules, nil
+}
+
+// Compile validates the rules and compiles their regular expressions and templates.
+func Compile(rules []*Rule) (*RuleSet, error) {
+	ruleSet := &RuleSet{
+		rules: make([]*compiledRule, 0, len(rules)),
+	}
+
+	for i, rule := range rules {
+		compiled, err := compile(rule)
+		if err != nil {
+			name := rule.Name
+			if name == "" {
+				name = fmt.Sprintf("#%d", i+1)
+			}
+
+			return nil, errors.Wrapf(err, "invalid rule %q", name)
+		}
+
+		ruleSet.rules = append(ruleSet.rules, compiled)
+	}
+
+	return ruleSet, nil
+}
+
+func compile(rule *Rule) (*compiledRule, error) {
+	compiled := &compiledRule{
+		rule: rule,
+	}
+
+	textConditions := []struct {
+		field  string
+		expr   string
+		values func(data *templateData) []string
+	}{
+		{"creditor_name", rule.Match.CreditorName, func(data *templateData) []string {
+			return []string{data.Transaction.CreditorName}
+		}},
+		{"debtor_name", rule.Match.DebtorName, func(data *templateData) []string {
+			return []string{data.Transaction.DebtorName}
+		}},
+		{"payee", rule.Match.Payee, func(data *templateData) []string {
+			return []string{data.Payee}
+		}},
+		{"remittance_information", rule.Match.RemittanceInformation, func(data *templateData) []string {
+			return append(
+				[]string{data.Transaction.RemittanceInformationUnstructured},
+				data.Transaction.RemittanceInformationUnstructuredArray...,
+			)
+		}},
+		{"bank_transaction_code", rule.Match.BankTransactionCode, func(data *templateData) []string {
+			return []string{data.Transaction.BankTransactionCode}
+		}},
+		{"proprietary_bank_transaction_code", rule.Match.ProprietaryBankTransactionCode, func(data *templateData) []string {
+			return []string{data.Transaction.ProprietaryBankTransactionCode}
+		}},
+		{"additional_information", rule.Match.AdditionalInformation, func(data *templateData) []string {
+			return []string{data.Transaction.AdditionalInformation}
+		}},
+		{"iban", rule.Match.IBAN, func(data *templateData) []string {
+			var ibans []string
+
+			if data.Transaction.CreditorAccount != nil {
+				ibans = append(ibans, data.Transaction.CreditorAccount.IBAN)
+			}
+
+			if data.Transaction.DebtorAccount != nil {
+				ibans = append(ibans, data.Transaction.DebtorAccount.IBAN)
+			}
+
+			return ibans
+		}},
+		{"currency", rule.Match.Currency, func(data *templateData) []string {
+			return []string{data.Transaction.TransactionAmount.Currency}
+		}},
+		{"merchant_category_code", rule.Match.MerchantCategoryCode, func(data *templateData) []string {
+			return []string{data.Transaction.MerchantCategoryCode}
+		}},
+		{"keywords", keywordsExpr(rule.Match.Keywords), func(data *templateData) []string {
+			return append(
+				[]string{data.Transaction.RemittanceInformationUnstructured, data.Transaction.AdditionalInformation},
+				data.Transaction.RemittanceInformationUnstructuredArray...,
+			)
+		}},
+	}
+
+	for _, textCondition := range textConditions {
+		if textCondition.expr == "" {
+			continue
+		}
+
+		re, err := regexp.Compile(textCondition.expr)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to compile %s", textCondition.field)
+		}
+
+		compiled.conditions = append(compiled.conditions, &condition{
+			values: textCondition.values,
+			regexp: re,
+		})
+	}
+
+	var err error
+
+	compiled.payee, err = compileTemplate(rule.Set.Payee)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to compile payee")
+	}
+
+	compiled.notes, err = compileTemplate(rule.Set.Notes)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to compile notes")
+	}
+
+	for _, tag := range rule.Set.Tags {
+		tagTemplate, err := compileTemplate(tag)
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to compile tag")
+		}
+
+		compiled.tags = append(compiled.tags, tagTemplate)
+	}
+
+	if rule.Set.Category != "" && rule.Set.CategoryID > 0 {
+		return nil, errors.New("category and category_id cannot be set both")
+	}
+
+	compiled.categoryID = rule.Set.CategoryID
+
+	switch rule.Set.Status {
+	case "", "cleared", "uncleared":
+	default:
+		return nil, errors.Errorf("unknown status %q", rule.Set.Status)
+	}
+
+	return compiled, nil
+}
+
+// keywordsExpr returns a regular expression matching any of the keywords ignoring the case.
+func keywordsExpr(keywords []string) string {
+	quoted := make([]string, 0, len(keywords))
+
+	for _, keyword := range keywords {
+		if keyword == "" {
+			continue
+		}
+
+		quoted = append(quoted, regexp.QuoteMeta(keyword))
+	}
+
+	if len(quoted) == 0 {
+		return ""
+	}
+
+	return "(?i)" + strings.Join(quoted, "|")
+}
+
+func compileTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+
+	return template.New("").Funcs(templateFuncs).Option("missingkey=error").Parse(text)
+}
+
+// CategoryNames returns the names of all categories set by rules.
+func (rs *RuleSet) CategoryNames() []string {
+	if rs == nil {
+		return nil
+	}
+
+	var names []string
+
+	for _, rule := range rs.rules {
+		if rule.rule.Set.Category != "" {
+			names = append(names, rule.rule.Set.Category)
+		}
+	}
+
+	return names
+}
+
+// Categories resolves category names to IDs, names are compared ignoring the case.
+// Names of multiple categories which only differ in their case are ambiguous.
+type Categories struct {
+	ids       map[string]int
+	ambiguous map[string]bool
+}
+
+// NewCategories creates an empty set of categories.
+func NewCategories() *Categories {
+	return &Categories{
+		ids:       make(map[string]int),
+		ambiguous: make(map[string]bool),
+	}
+}
+
+// Add adds a category.
+func (c *Categories) Add(name string, id int) {
+	key := strings.ToLower(name)
+	if existing, ok := c.ids[key]; ok && existing != id {
+		c.ambiguous[key] = true
+	}
+
+	c.ids[key] = id
+}
+
+// Resolve returns the ID of the category with the name.
+func (c *Categories) Resolve(name string) (int, error) {
+	key := strings.ToLower(name)
+
+	if c != nil && c.ambiguous[key] {
+		return 0, errors.Errorf("ambiguous category %q", name)
+	}
+
+	if c == nil || c.ids[key] <= 0 {
+		return 0, errors.Errorf("unknown category %q", name)
+	}
+
+	return c.ids[key], nil
+}
+
+// ResolveCategories resolves the category names of the rules to IDs.
+// It has to be called before applying rules setting categories by name.
+func (rs *RuleSet) ResolveCategories(categories *Categories) error {
+	if rs == nil {
+		return nil
+	}
+
+	for _, rule := range rs.rules {
+		if rule.rule.Set.Category == "" {
+			continue
+		}
+
+		id, err := categories.Resolve(rule.rule.Set.Category)
+		if err != nil {
+			return errors.Wrapf(err, "failed to resolve category of rule %q", rule.rule.Name)
+		}
+
+		rule.categoryID = id
+	}
+
+	return nil
+}
+
+// Apply applies all matching rules in order to the result, rules see the changes of previous rules.
+// Applying stops at the first matching rule skipping the transaction.
+func (rs *RuleSet) Apply(trx nordigen.Transaction, account *nordigen.Account, result *Result) error {
+	if rs == nil {
+		return nil
+	}
+
+	data := &templateData{
+		Transaction: trx,
+	}
+
+	if account != nil {
+		data.Account = *account
+	}
+
+	for _, rule := range rs.rules {
+		data.Payee, data.Notes = result.Payee, result.Notes
+
+		if !rule.matches(data) {
+			continue
+		}
+
+		if rule.rule.Skip {
+			result.Skip = true
+
+			return nil
+		}
+
+		err := rule.apply(data, result)
+		if err != nil {
+			return errors.Wrapf(err, "failed to apply rule %q", rule.rule.Name)
+		}
+	}
+
+	return nil
+}
+
+func (r *compiledRule) matches(data *templateData) bool {
+	for _, cond := range r.conditions {
+		matched := false
+
+		for _, value := range cond.values(data) {
+			if cond.regexp.MatchString(value) {
+				matched = true
+				break
+			}
+		}
+
+		if !matched {
+			return false
+		}
+	}
+
+	amount := data.Transaction.TransactionAmount.Amount
+
+	if r.rule.Match.AmountMin != nil && amount.Cmp(*r.rule.Match.AmountMin) < 0 {
+		return false
+	}
+
+	if r.rule.Match.AmountMax != nil && amount.Cmp(*r.rule.Match.AmountMax) > 0 {
+		return false
+	}
+
+	return true
+}
+
+func (r *compiledRule) apply(data *templateData, result *Result) error {
+	payee, err := render(r.payee, data)
+	if err != nil {
+		return errors.Wrap(err, "failed to render payee")
+	}
+
+	if payee != "" {
+		result.Payee = payee
+	}
+
+	notes, err := render(r.notes, data)
+	if err != nil {
+		return errors.Wrap(err, "failed to render notes")
+	}
+
+	if notes != "" {
+		result.Notes = notes
+	}
+
+	for _, tagTemplate := range r.tags {
+		tag, err := render(tagTemplate, data)
+		if err != nil {
+			return errors.Wrap(err, "failed to render tag")
+		}
+
+		if tag != "" {
+			result.Tags = append(result.Tags, tag)
+		}
+	}
+
+	if r.rule.Set.Category != "" && r.categoryID <= 0 {
+		return errors.Errorf("category %q has not been resolved", r.rule.Set.Category)
+	}
+
+	if r.categoryID > 0 {
+		result.CategoryID = r.categoryID
+	}
+
+	if r.rule.Set.Status != "" {
+		result.Status = r.rule.Set.Status
+	}
+
+	return nil
+}
+
+func render(tmpl *template.Template, data *templateData) (string, error) {
+	if tmpl == nil {
+		return "", nil
+	}
+
+	var buf strings.Builder
+
+	err := tmpl.Execute(&buf, data)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(buf.String()), nil
+}
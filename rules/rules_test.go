@@ -0,0 +1,436 @@
+package rules
+
+import (
+	"testing"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/money"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+)
+
+func TestDefaultRules(t *testing.T) {
+	defaults, err := DefaultRules()
+	if err != nil {
+		t.Fatalf("failed to parse default rules: %v", err)
+	}
+
+	ruleSet, err := Compile(defaults)
+	if err != nil {
+		t.Fatalf("failed to compile default rules: %v", err)
+	}
+
+	// the payees are the ones set by the heuristics the default rules replaced
+	tests := []struct {
+		name      string
+		trx       nordigen.Transaction
+		ownerName string
+		payee     string
+		wantPayee string
+	}{
+		{
+			name:      "wallet transfer",
+			trx:       nordigen.Transaction{AdditionalInformation: "MONEY_TRANSFER"},
+			ownerName: "Jane Doe",
+			wantPayee: "Jane Doe",
+		},
+		{
+			name:      "wallet top up",
+			trx:       nordigen.Transaction{ProprietaryBankTransactionCode: "TOPUP"},
+			ownerName: "Jane Doe",
+			wantPayee: "Jane Doe",
+		},
+		{
+			name:      "wallet transfer without owner name",
+			trx:       nordigen.Transaction{AdditionalInformation: "MONEY_TRANSFER"},
+			wantPayee: "",
+		},
+		{
+			name:      "wallet transfer with payee",
+			trx:       nordigen.Transaction{AdditionalInformation: "MONEY_TRANSFER", CreditorName: "Shop"},
+			ownerName: "Jane Doe",
+			payee:     "Shop",
+			wantPayee: "Shop",
+		},
+		{
+			name:      "partial additional information",
+			trx:       nordigen.Transaction{AdditionalInformation: "MONEY_TRANSFER_FEE"},
+			ownerName: "Jane Doe",
+			wantPayee: "",
+		},
+		{
+			name:      "exchange",
+			trx:       nordigen.Transaction{ProprietaryBankTransactionCode: "EXCHANGE"},
+			wantPayee: "Exchange",
+		},
+		{
+			name:      "transfer",
+			trx:       nordigen.Transaction{ProprietaryBankTransactionCode: "TRANSFER"},
+			ownerName: "Jane Doe",
+			wantPayee: "Transfer",
+		},
+		{
+			name:      "transfer with payee",
+			trx:       nordigen.Transaction{ProprietaryBankTransactionCode: "TRANSFER", DebtorName: "John Doe"},
+			payee:     "John Doe",
+			wantPayee: "John Doe",
+		},
+		{
+			name:      "card payment",
+			trx:       nordigen.Transaction{ProprietaryBankTransactionCode: "CARD_PAYMENT"},
+			ownerName: "Jane Doe",
+			wantPayee: "",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := &Result{
+				Payee: tt.payee,
+				Notes: "Invoice 42",
+			}
+
+			err := ruleSet.Apply(tt.trx, &nordigen.Account{OwnerName: tt.ownerName}, result)
+			if err != nil {
+				t.Fatalf("failed to apply rules: %v", err)
+			}
+
+			if result.Payee != tt.wantPayee {
+				t.Errorf("expected payee %q, got %q", tt.wantPayee, result.Payee)
+			}
+
+			// the notes are always the remittance information
+			if result.Notes != "Invoice 42" || result.CategoryID != 0 || len(result.Tags) != 0 || result.Status != "" || result.Skip {
+				t.Errorf("expected nothing else to be changed, got %+v", result)
+			}
+		})
+	}
+}
+
+func TestApply(t *testing.T) {
+	amount := func(value string) *money.Amount {
+		a := money.MustParse(value)
+		return &a
+	}
+
+	tests := []struct {
+		name      string
+		rules     []*Rule
+		trx       nordigen.Transaction
+		want      Result
+		wantError bool
+	}{
+		{
+			name: "amount at upper bound",
+			rules: []*Rule{
+				{Match: Match{AmountMin: amount("-50"), AmountMax: amount("-10")}, Set: Set{Payee: "Groceries"}},
+			},
+			trx:  transaction("-10.00"),
+			want: Result{Payee: "Groceries", Notes: "Invoice"},
+		},
+		{
+			name: "amount at lower bound",
+			rules: []*Rule{
+				{Match: Match{AmountMin: amount("-50")}, Set: Set{Payee: "Groceries"}},
+			},
+			trx:  transaction("-50.00"),
+			want: Result{Payee: "Groceries", Notes: "Invoice"},
+		},
+		{
+			name: "amount below lower bound",
+			rules: []*Rule{
+				{Match: Match{AmountMin: amount("-50")}, Set: Set{Payee: "Groceries"}},
+			},
+			trx:  transaction("-50.01"),
+			want: Result{Payee: "Shop", Notes: "Invoice"},
+		},
+		{
+			name: "amount above upper bound",
+			rules: []*Rule{
+				{Match: Match{AmountMax: amount("-10")}, Set: Set{Payee: "Groceries"}},
+			},
+			trx:  transaction("-9.99"),
+			want: Result{Payee: "Shop", Notes: "Invoice"},
+		},
+		{
+			name: "conditions combined",
+			rules: []*Rule{
+				{Match: Match{CreditorName: "^Shop$", AmountMax: amount("0")}, Set: Set{Notes: "{{ .Payee }}: {{ .Notes | upper }}"}},
+				{Match: Match{CreditorName: "^Other$"}, Set: Set{Payee: "Other"}},
+			},
+			trx:  transaction("-10"),
+			want: Result{Payee: "Shop", Notes: "Shop: INVOICE"},
+		},
+		{
+			name: "later rules see changes",
+			rules: []*Rule{
+				{Match: Match{Payee: "^Shop$"}, Set: Set{Payee: "Supermarket", Tags: []string{"food"}}},
+				{Match: Match{Payee: "^Supermarket$"}, Set: Set{Tags: []string{"{{ .Transaction.TransactionAmount.Currency | lower }}"}, Status: "cleared"}},
+			},
+			trx:  transaction("-10"),
+			want: Result{Payee: "Supermarket", Notes: "Invoice", Tags: []string{"food", "eur"}, Status: "cleared"},
+		},
+		{
+			name: "empty template output keeps value",
+			rules: []*Rule{
+				{Set: Set{Payee: "{{ .Transaction.DebtorName }}"}},
+			},
+			trx:  transaction("-10"),
+			want: Result{Payee: "Shop", Notes: "Invoice"},
+		},
+		{
+			name: "skip",
+			rules: []*Rule{
+				{Match: Match{AmountMax: amount("0")}, Skip: true},
+				{Set: Set{Payee: "Never"}},
+			},
+			trx:  transaction("-10"),
+			want: Result{Payee: "Shop", Notes: "Invoice", Skip: true},
+		},
+		{
+			name: "skip not matching",
+			rules: []*Rule{
+				{Match: Match{AmountMin: amount("0")}, Skip: true},
+			},
+			trx:  transaction("-10"),
+			want: Result{Payee: "Shop", Notes: "Invoice"},
+		},
+		{
+			name: "template error",
+			rules: []*Rule{
+				{Name: "broken", Set: Set{Payee: "{{ .Unknown }}"}},
+			},
+			trx:       transaction("-10"),
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ruleSet, err := Compile(tt.rules)
+			if err != nil {
+				t.Fatalf("failed to compile rules: %v", err)
+			}
+
+			result := &Result{
+				Payee: "Shop",
+				Notes: "Invoice",
+			}
+
+			err = ruleSet.Apply(tt.trx, nil, result)
+			if tt.wantError {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed to apply rules: %v", err)
+			}
+
+			if !equalResults(*result, tt.want) {
+				t.Errorf("expected %+v, got %+v", tt.want, *result)
+			}
+		})
+	}
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name string
+		rule *Rule
+	}{
+		{"invalid regular expression", &Rule{Match: Match{Payee: "("}}},
+		{"invalid payee template", &Rule{Set: Set{Payee: "{{ .Payee"}}},
+		{"invalid notes template", &Rule{Set: Set{Notes: "{{ end }}"}}},
+		{"unknown template function", &Rule{Set: Set{Tags: []string{"{{ .Payee | unknown }}"}}}},
+		{"category and category id", &Rule{Set: Set{Category: "Food", CategoryID: 1}}},
+		{"unknown status", &Rule{Set: Set{Status: "pending"}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Compile([]*Rule{tt.rule})
+			if err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestResolveCategories(t *testing.T) {
+	categories := NewCategories()
+	categories.Add("Groceries", 1)
+	categories.Add("Restaurants", 2)
+	categories.Add("Travel", 3)
+	categories.Add("travel", 4)
+	categories.Add("Rent", 5)
+	categories.Add("Rent", 6)
+	categories.Add("Cinema", 7)
+	categories.Add("Cinema", 7)
+
+	tests := []struct {
+		name           string
+		category       string
+		trx            nordigen.Transaction
+		match          Match
+		wantCategoryID int
+		wantError      bool
+	}{
+		{
+			name:           "name",
+			category:       "Groceries",
+			wantCategoryID: 1,
+		},
+		{
+			name:           "name ignoring the case",
+			category:       "RESTAURANTS",
+			wantCategoryID: 2,
+		},
+		{
+			name:           "keyword",
+			category:       "Groceries",
+			trx:            nordigen.Transaction{RemittanceInformationUnstructuredArray: []string{"Card payment", "SUPERMARKET 123"}},
+			match:          Match{Keywords: []string{"bakery", "supermarket"}},
+			wantCategoryID: 1,
+		},
+		{
+			name:     "keyword not matching",
+			category: "Groceries",
+			trx:      nordigen.Transaction{AdditionalInformation: "Cinema"},
+			match:    Match{Keywords: []string{"bakery", "supermarket"}},
+		},
+		{
+			name:           "merchant category code",
+			category:       "Restaurants",
+			trx:            nordigen.Transaction{MerchantCategoryCode: "5812"},
+			match:          Match{MerchantCategoryCode: "^58(12|14)$"},
+			wantCategoryID: 2,
+		},
+		{
+			name:     "merchant category code not matching",
+			category: "Restaurants",
+			trx:      nordigen.Transaction{MerchantCategoryCode: "5411"},
+			match:    Match{MerchantCategoryCode: "^58(12|14)$"},
+		},
+		{
+			name:           "name added twice",
+			category:       "cinema",
+			wantCategoryID: 7,
+		},
+		{
+			name:      "unknown name",
+			category:  "Utilities",
+			wantError: true,
+		},
+		{
+			name:      "ambiguous name",
+			category:  "Travel",
+			wantError: true,
+		},
+		{
+			name:      "duplicate name",
+			category:  "Rent",
+			wantError: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ruleSet, err := Compile([]*Rule{
+				{Name: "category", Match: tt.match, Set: Set{Category: tt.category}},
+			})
+			if err != nil {
+				t.Fatalf("failed to compile rules: %v", err)
+			}
+
+			if names := ruleSet.CategoryNames(); len(names) != 1 || names[0] != tt.category {
+				t.Errorf("expected category names [%s], got %v", tt.category, names)
+			}
+
+			// categories set by name cannot be applied before they are resolved
+			err = ruleSet.Apply(tt.trx, nil, &Result{})
+			if err == nil && tt.wantCategoryID > 0 {
+				t.Error("expected an error for an unresolved category")
+			}
+
+			err = ruleSet.ResolveCategories(categories)
+			if tt.wantError {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed to resolve categories: %v", err)
+			}
+
+			result := &Result{}
+
+			err = ruleSet.Apply(tt.trx, nil, result)
+			if err != nil {
+				t.Fatalf("failed to apply rules: %v", err)
+			}
+
+			if result.CategoryID != tt.wantCategoryID {
+				t.Errorf("expected category %d, got %d", tt.wantCategoryID, result.CategoryID)
+			}
+		})
+	}
+}
+
+func TestCategoryNames(t *testing.T) {
+	ruleSet, err := Compile([]*Rule{
+		{Set: Set{Category: "Groceries"}},
+		{Set: Set{CategoryID: 2}},
+		{Set: Set{Payee: "Shop"}},
+		{Set: Set{Category: "Travel"}},
+	})
+	if err != nil {
+		t.Fatalf("failed to compile rules: %v", err)
+	}
+
+	if names := ruleSet.CategoryNames(); len(names) != 2 || names[0] != "Groceries" || names[1] != "Travel" {
+		t.Errorf("expected the names of the categories set by name, got %v", names)
+	}
+
+	var empty *RuleSet
+
+	if names := empty.CategoryNames(); names != nil {
+		t.Errorf("expected no names without rules, got %v", names)
+	}
+
+	if err := empty.ResolveCategories(nil); err != nil {
+		t.Errorf("expected no error without rules, got %v", err)
+	}
+}
+
+func transaction(amount string) nordigen.Transaction {
+	return nordigen.Transaction{
+		TransactionAmount: nordigen.Amount{
+			Amount:   money.MustParse(amount),
+			Currency: "EUR",
+		},
+		CreditorName: "Shop",
+	}
+}
+
+func equalResults(a, b Result) bool {
+	if a.Payee != b.Payee || a.Notes != b.Notes || a.CategoryID != b.CategoryID || a.Status != b.Status || a.Skip != b.Skip {
+		return false
+	}
+
+	if len(a.Tags) != len(b.Tags) {
+		return false
+	}
+
+	for i := range a.Tags {
+		if a.Tags[i] != b.Tags[i] {
+			return false
+		}
+	}
+
+	return true
+}
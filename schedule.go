@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/robfig/cron/v3"
+	"go.uber.org/zap"
+)
+
+// defaultScheduleInterval is used if neither an interval nor a cron expression is configured.
+const defaultScheduleInterval = 4 * time.Hour
+
+// schedule returns the next time a sync should run.
+type schedule interface {
+	Next(time.Time) time.Time
+}
+
+// intervalSchedule runs a sync every fixed duration.
+type intervalSchedule time.Duration
+
+// Next returns the next time a sync should run.
+func (s intervalSchedule) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(s))
+}
+
+// parseSchedule creates a schedule from a cron expression or an interval, the cron expression takes precedence.
+func parseSchedule(cronExpression string, interval time.Duration) (schedule, error) {
+	if cronExpression != "" {
+		sched, err := cron.ParseStandard(cronExpression)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to parse cron expression %q", cronExpression)
+		}
+
+		return sched, nil
+	}
+
+	if interval < 0 {
+		return nil, errors.New("interval cannot be negative")
+	}
+
+	if interval == 0 {
+		interval = defaultScheduleInterval
+	}
+
+	return intervalSchedule(interval), nil
+}
+
+// serve runs the sync once on start and then according to the schedule until the context is cancelled.
+// Runs never overlap, the next run is scheduled after the previous one has finished.
+func serve(
+	ctx context.Context,
+	sched schedule,
+	jitter time.Duration,
+	run func(ctx context.Context) error,
+	log *zap.Logger,
+) error {
+	random := rand.New(rand.NewSource(time.Now().UnixNano()))
+
+	for {
+		err := run(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return nil
+			}
+
+			log.Error("scheduled sync failed", zap.Error(err))
+		}
+
+		next := sched.Next(time.Now())
+		if jitter > 0 {
+			next = next.Add(time.Duration(random.Int63n(int64(jitter))))
+		}
+
+		log.Info("scheduled next sync", zap.Time("next", next))
+
+		timer := time.NewTimer(time.Until(next))
+
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+
+			return nil
+		case <-timer.C:
+		}
+	}
+}
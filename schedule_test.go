@@ -0,0 +1,153 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestParseSchedule(t *testing.T) {
+	now := time.Date(2021, 10, 5, 10, 30, 0, 0, time.Local)
+
+	tests := []struct {
+		name     string
+		cron     string
+		interval time.Duration
+		wantNext time.Time
+		wantErr  bool
+	}{
+		{
+			name:     "default interval",
+			wantNext: now.Add(defaultScheduleInterval),
+		},
+		{
+			name:     "interval",
+			interval: 30 * time.Minute,
+			wantNext: now.Add(30 * time.Minute),
+		},
+		{
+			name:     "cron expression",
+			cron:     "15 */4 * * *",
+			wantNext: time.Date(2021, 10, 5, 12, 15, 0, 0, time.Local),
+		},
+		{
+			name:     "cron expression takes precedence",
+			cron:     "0 6 * * *",
+			interval: 30 * time.Minute,
+			wantNext: time.Date(2021, 10, 6, 6, 0, 0, 0, time.Local),
+		},
+		{
+			name:    "invalid cron expression",
+			cron:    "every day",
+			wantErr: true,
+		},
+		{
+			name:    "cron expression with seconds",
+			cron:    "0 15 */4 * * *",
+			wantErr: true,
+		},
+		{
+			name:     "negative interval",
+			interval: -time.Minute,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sched, err := parseSchedule(tt.cron, tt.interval)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed to parse schedule: %v", err)
+			}
+
+			if next := sched.Next(now); !next.Equal(tt.wantNext) {
+				t.Errorf("expected next run at %s, got %s", tt.wantNext, next)
+			}
+		})
+	}
+}
+
+func TestServe(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var runs int
+
+	// failed runs are scheduled again, the context is cancelled during the third run
+	run := func(ctx context.Context) error {
+		runs++
+
+		if runs == 3 {
+			cancel()
+
+			return ctx.Err()
+		}
+
+		return errors.New("sync failed")
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- serve(ctx, intervalSchedule(time.Millisecond), time.Millisecond, run, zaptest.NewLogger(t))
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected serving to stop without an error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected serving to stop once the context is cancelled")
+	}
+
+	if runs != 3 {
+		t.Errorf("expected 3 runs, got %d", runs)
+	}
+}
+
+func TestServeStopsWhileWaiting(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	var runs int
+
+	run := func(ctx context.Context) error {
+		runs++
+
+		return nil
+	}
+
+	done := make(chan error, 1)
+
+	go func() {
+		done <- serve(ctx, intervalSchedule(time.Hour), 0, run, zaptest.NewLogger(t))
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("expected serving to stop without an error, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected serving to stop once the context is cancelled")
+	}
+
+	if runs != 1 {
+		t.Errorf("expected a single run on start, got %d", runs)
+	}
+}
@@ -0,0 +1,4 @@
+/*
+Package state persists the progress of syncing accounts between runs.
+*/
+package state
@@ -0,0 +1,118 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// FileStore stores the state of all account mappings in a single JSON file.
+type FileStore struct {
+	path string
+
+	lock sync.Mutex
+}
+
+// NewFileStore creates a new file based store, the file is created on the first save.
+func NewFileStore(path string) (*FileStore, error) {
+	if path == "" {
+		return nil, errors.New("path cannot be empty")
+	}
+
+	return &FileStore{
+		path: path,
+	}, nil
+}
+
+// Load returns the state for the given key.
+func (s *FileStore) Load(ctx context.Context, key string) (*Account, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	accounts, err := s.read()
+	if err != nil {
+		return nil, err
+	}
+
+	account, ok := accounts[key]
+	if !ok || account == nil {
+		return NewAccount(), nil
+	}
+
+	if account.Transactions == nil {
+		account.Transactions = make(map[string]*Transaction)
+	}
+
+	if account.Pending == nil {
+		account.Pending = make(map[string]*PendingTransaction)
+	}
+
+	return account, nil
+}
+
+// Save persists the state for the given key.
+func (s *FileStore) Save(ctx context.Context, key string, account *Account) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	accounts, err := s.read()
+	if err != nil {
+		return err
+	}
+
+	accounts[key] = account
+
+	data, err := json.MarshalIndent(accounts, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal state")
+	}
+
+	// write to a temporary file first so an interrupted write does not corrupt the state
+	tmpFile, err := os.CreateTemp(filepath.Dir(s.path), filepath.Base(s.path)+".*.tmp")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary state file")
+	}
+	defer os.Remove(tmpFile.Name())
+
+	_, err = tmpFile.Write(data)
+	if err != nil {
+		tmpFile.Close()
+		return errors.Wrap(err, "failed to write temporary state file")
+	}
+
+	err = tmpFile.Close()
+	if err != nil {
+		return errors.Wrap(err, "failed to close temporary state file")
+	}
+
+	err = os.Rename(tmpFile.Name(), s.path)
+	if err != nil {
+		return errors.Wrap(err, "failed to replace state file")
+	}
+
+	return nil
+}
+
+func (s *FileStore) read() (map[string]*Account, error) {
+	accounts := make(map[string]*Account)
+
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return accounts, nil
+		}
+
+		return nil, errors.Wrap(err, "failed to read state file")
+	}
+
+	err = json.Unmarshal(data, &accounts)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode state file")
+	}
+
+	return accounts, nil
+}
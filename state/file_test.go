@@ -0,0 +1,181 @@
+package state
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/money"
+)
+
+func TestFileStore(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	_, err := NewFileStore("")
+	if err == nil {
+		t.Fatal("expected an error for an empty path")
+	}
+
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	// a missing file is an empty state and is not created by loading
+	account, err := store.Load(ctx, "account-1:1")
+	if err != nil {
+		t.Fatalf("failed to load state: %v", err)
+	}
+
+	if !account.LastBookingDate.IsZero() || account.Transactions == nil || len(account.Transactions) != 0 || account.Pending == nil {
+		t.Errorf("expected an empty state, got %+v", account)
+	}
+
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Fatalf("expected the state file not to be created by loading, got %v", err)
+	}
+
+	bookingDate := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+	reset := time.Date(2021, 10, 2, 12, 0, 0, 0, time.UTC)
+
+	account.MarkSynced("trx-1", bookingDate)
+	account.SetValues("trx-1", &TransactionValues{
+		Date:   bookingDate,
+		Payee:  "Bakery",
+		Amount: money.MustParse("-12.50"),
+	})
+	account.AddPending("pending-1", &PendingTransaction{
+		LunchmoneyID: 42,
+		Date:         bookingDate,
+		Amount:       money.MustParse("-5.00"),
+		Currency:     "eur",
+		Payee:        "Kiosk",
+	})
+	account.AddTransfer("trx-1", &Transfer{
+		LunchmoneyID: 43,
+		Date:         bookingDate,
+		Amount:       money.MustParse("-12.50"),
+		Currency:     "eur",
+		Counterparty: "account-2",
+	})
+	account.SetRateLimit("transactions", &RateLimit{
+		Remaining: 3,
+		Reset:     reset,
+	})
+
+	err = store.Save(ctx, "account-1:1", account)
+	if err != nil {
+		t.Fatalf("failed to save state: %v", err)
+	}
+
+	err = store.Save(ctx, "account-2:2", &Account{LastBookingDate: bookingDate})
+	if err != nil {
+		t.Fatalf("failed to save state: %v", err)
+	}
+
+	// a new store reads the state saved by the first one
+	store, err = NewFileStore(path)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	loaded, err := store.Load(ctx, "account-1:1")
+	if err != nil {
+		t.Fatalf("failed to load state: %v", err)
+	}
+
+	if !loaded.LastBookingDate.Equal(bookingDate) || !loaded.Synced("trx-1") {
+		t.Errorf("expected trx-1 to be synced, got %+v", loaded)
+	}
+
+	if values := loaded.Transactions["trx-1"].Values; values == nil || values.Payee != "Bakery" || values.Amount.String() != "-12.50" {
+		t.Errorf("expected the values of trx-1, got %+v", values)
+	}
+
+	if pending := loaded.Pending["pending-1"]; pending == nil || pending.LunchmoneyID != 42 || pending.Amount.String() != "-5.00" {
+		t.Errorf("expected the pending transaction, got %+v", pending)
+	}
+
+	if transfer := loaded.Transfers["trx-1"]; transfer == nil || transfer.LunchmoneyID != 43 || transfer.Counterparty != "account-2" {
+		t.Errorf("expected the transfer, got %+v", transfer)
+	}
+
+	if rateLimit := loaded.RateLimits["transactions"]; rateLimit == nil || rateLimit.Remaining != 3 || !rateLimit.Reset.Equal(reset) {
+		t.Errorf("expected the rate limit, got %+v", rateLimit)
+	}
+
+	// states saved without transactions are loaded with empty maps
+	other, err := store.Load(ctx, "account-2:2")
+	if err != nil {
+		t.Fatalf("failed to load state: %v", err)
+	}
+
+	if !other.LastBookingDate.Equal(bookingDate) || other.Transactions == nil || other.Pending == nil {
+		t.Errorf("expected the second state, got %+v", other)
+	}
+
+	// the temporary file is renamed to the state file
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatalf("failed to read directory: %v", err)
+	}
+
+	if len(entries) != 1 || entries[0].Name() != "state.json" {
+		t.Errorf("expected only the state file, got %v", entries)
+	}
+}
+
+func TestFileStoreInvalid(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	path := filepath.Join(dir, "state.json")
+
+	err := os.WriteFile(path, []byte("{invalid"), 0o600)
+	if err != nil {
+		t.Fatalf("failed to write state file: %v", err)
+	}
+
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	_, err = store.Load(ctx, "account-1:1")
+	if err == nil {
+		t.Error("expected an error for an invalid state file")
+	}
+
+	// the state of other mappings in the file must not be lost
+	err = store.Save(ctx, "account-1:1", NewAccount())
+	if err == nil {
+		t.Error("expected an error for an invalid state file")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read state file: %v", err)
+	}
+
+	if string(data) != "{invalid" {
+		t.Errorf("expected the state file not to be replaced, got %q", data)
+	}
+
+	// the state file cannot be replaced if its directory does not exist
+	store, err = NewFileStore(filepath.Join(dir, "missing", "state.json"))
+	if err != nil {
+		t.Fatalf("failed to create store: %v", err)
+	}
+
+	err = store.Save(ctx, "account-1:1", NewAccount())
+	if err == nil {
+		t.Error("expected an error for a missing directory")
+	}
+
+	if entries, err := os.ReadDir(dir); err != nil || len(entries) != 1 {
+		t.Errorf("expected no temporary files to be left, got %v (%v)", entries, err)
+	}
+}
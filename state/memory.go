@@ -0,0 +1,59 @@
+package state
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/pkg/errors"
+)
+
+// MemoryStore keeps the state in memory only, it is lost when the process exits.
+type MemoryStore struct {
+	accounts map[string][]byte
+
+	lock sync.Mutex
+}
+
+// NewMemoryStore creates a new in-memory store.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		accounts: make(map[string][]byte),
+	}
+}
+
+// Load returns the state for the given key.
+func (s *MemoryStore) Load(ctx context.Context, key string) (*Account, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	data, ok := s.accounts[key]
+	if !ok {
+		return NewAccount(), nil
+	}
+
+	// state is stored encoded so changes to a loaded state are not persisted without saving
+	account := NewAccount()
+
+	err := json.Unmarshal(data, account)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to decode state")
+	}
+
+	return account, nil
+}
+
+// Save persists the state for the given key.
+func (s *MemoryStore) Save(ctx context.Context, key string, account *Account) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	data, err := json.Marshal(account)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode state")
+	}
+
+	s.accounts[key] = data
+
+	return nil
+}
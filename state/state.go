@@ -0,0 +1,161 @@
+package state
+
+import (
+	"context"
+	"time"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/money"
+)
+
+// Store loads and saves the sync state of account mappings.
+type Store interface {
+	// Load returns the state for the given key, an empty state is returned if none has been saved yet.
+	Load(ctx context.Context, key string) (*Account, error)
+	// Save persists the state for the given key.
+	Save(ctx context.Context, key string, account *Account) error
+}
+
+// Account represents the sync state of a single account mapping.
+type Account struct {
+	// LastBookingDate is the most recent booking date of all synced transactions.
+	LastBookingDate time.Time `json:"last_booking_date"`
+	// Transactions contains all synced transactions keyed by their external ID.
+	Transactions map[string]*Transaction `json:"transactions"`
+	// Pending contains all pending transactions inserted into Lunchmoney keyed by their external ID.
+	Pending map[string]*PendingTransaction `json:"pending,omitempty"`
+	// Transfers contains all transfers inserted into Lunchmoney which have not been linked to their
+	// counterpart in another account yet, keyed by their external ID.
+	Transfers map[string]*Transfer `json:"transfers,omitempty"`
+	// RateLimits contains the last known rate limits of the Nordigen endpoints of the account keyed by endpoint.
+	RateLimits map[string]*RateLimit `json:"rate_limits,omitempty"`
+	// Reauth is the requisition created to authenticate an expiring requisition again. It is only set
+	// in the state saved for the expiring requisition, not in the state of account mappings.
+	Reauth *Reauth `json:"reauth,omitempty"`
+}
+
+// Transaction represents a transaction that has been synced.
+type Transaction struct {
+	BookingDate time.Time `json:"booking_date"`
+	// Values are the values last written to Lunchmoney, they are nil for transactions synced by older versions.
+	Values *TransactionValues `json:"values,omitempty"`
+}
+
+// TransactionValues are the values of a transaction written to Lunchmoney. Comparing them to the
+// transaction in Lunchmoney shows whether it has been edited by hand since it was synced.
+type TransactionValues struct {
+	Date   time.Time    `json:"date"`
+	Payee  string       `json:"payee"`
+	Notes  string       `json:"notes"`
+	Amount money.Amount `json:"amount"`
+}
+
+// PendingTransaction represents a pending transaction that has been inserted into Lunchmoney
+// and has to be replaced once it is booked.
+type PendingTransaction struct {
+	LunchmoneyID int          `json:"lunchmoney_id"`
+	Date         time.Time    `json:"date"`
+	Amount       money.Amount `json:"amount"`
+	Currency     string       `json:"currency"`
+	Payee        string       `json:"payee"`
+}
+
+// Transfer represents one half of a transfer between two synced accounts.
+type Transfer struct {
+	LunchmoneyID int          `json:"lunchmoney_id"`
+	Date         time.Time    `json:"date"`
+	Amount       money.Amount `json:"amount"`
+	Currency     string       `json:"currency"`
+	Payee        string       `json:"payee"`
+	// Counterparty is the Nordigen account ID of the other account.
+	Counterparty string `json:"counterparty"`
+}
+
+// RateLimit represents the remaining requests to a Nordigen endpoint until the limit resets.
+type RateLimit struct {
+	Remaining   int       `json:"remaining"`
+	Reset       time.Time `json:"reset"`
+	LastRequest time.Time `json:"last_request"`
+}
+
+// Reauth represents a requisition created to authenticate an expiring requisition again,
+// it is reused until it has been linked or has expired.
+type Reauth struct {
+	RequisitionID string    `json:"requisition_id"`
+	Link          string    `json:"link"`
+	Created       time.Time `json:"created"`
+}
+
+// NewAccount creates a new empty account state.
+func NewAccount() *Account {
+	return &Account{
+		Transactions: make(map[string]*Transaction),
+		Pending:      make(map[string]*PendingTransaction),
+		Transfers:    make(map[string]*Transfer),
+	}
+}
+
+// Synced returns true if the transaction with the given external ID has been synced already.
+func (a *Account) Synced(externalID string) bool {
+	_, ok := a.Transactions[externalID]
+	return ok
+}
+
+// MarkSynced records the transaction with the given external ID as synced.
+func (a *Account) MarkSynced(externalID string, bookingDate time.Time) {
+	if a.Transactions == nil {
+		a.Transactions = make(map[string]*Transaction)
+	}
+
+	a.Transactions[externalID] = &Transaction{
+		BookingDate: bookingDate,
+	}
+
+	if bookingDate.After(a.LastBookingDate) {
+		a.LastBookingDate = bookingDate
+	}
+}
+
+// SetValues records the values written to Lunchmoney for a synced transaction.
+// Nothing is recorded if the transaction has not been synced.
+func (a *Account) SetValues(externalID string, values *TransactionValues) {
+	if trx, ok := a.Transactions[externalID]; ok {
+		trx.Values = values
+	}
+}
+
+// Prune removes all transactions booked before the given date.
+// They will not be returned by Nordigen again, so there is no need to remember them.
+func (a *Account) Prune(before time.Time) {
+	for externalID, trx := range a.Transactions {
+		if trx.BookingDate.Before(before) {
+			delete(a.Transactions, externalID)
+		}
+	}
+}
+
+// AddPending records a pending transaction inserted into Lunchmoney.
+func (a *Account) AddPending(externalID string, trx *PendingTransaction) {
+	if a.Pending == nil {
+		a.Pending = make(map[string]*PendingTransaction)
+	}
+
+	a.Pending[externalID] = trx
+}
+
+// AddTransfer records a transfer inserted into Lunchmoney that has to be linked to its counterpart.
+func (a *Account) AddTransfer(externalID string, trx *Transfer) {
+	if a.Transfers == nil {
+		a.Transfers = make(map[string]*Transfer)
+	}
+
+	a.Transfers[externalID] = trx
+}
+
+// SetRateLimit records the rate limit of a Nordigen endpoint.
+func (a *Account) SetRateLimit(endpoint string, rateLimit *RateLimit) {
+	if a.RateLimits == nil {
+		a.RateLimits = make(map[string]*RateLimit)
+	}
+
+	a.RateLimits[endpoint] = rateLimit
+}
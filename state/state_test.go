@@ -0,0 +1,88 @@
+package state
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/money"
+)
+
+func TestMarkSynced(t *testing.T) {
+	first := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+	second := first.AddDate(0, 0, 1)
+
+	// the zero value is usable
+	account := &Account{}
+
+	if account.Synced("trx-1") {
+		t.Fatal("expected trx-1 not to be synced")
+	}
+
+	account.MarkSynced("trx-2", second)
+	account.MarkSynced("trx-1", first)
+
+	if !account.Synced("trx-1") || !account.Synced("trx-2") || account.Synced("trx-3") {
+		t.Errorf("expected trx-1 and trx-2 to be synced, got %v", account.Transactions)
+	}
+
+	// the last booking date never moves backwards
+	if !account.LastBookingDate.Equal(second) {
+		t.Errorf("expected last booking date %s, got %s", second, account.LastBookingDate)
+	}
+
+	values := &TransactionValues{Payee: "Bakery", Amount: money.MustParse("-12.50")}
+
+	account.SetValues("trx-1", values)
+	account.SetValues("trx-3", values)
+
+	if account.Transactions["trx-1"].Values != values {
+		t.Errorf("expected the values of trx-1 to be set, got %+v", account.Transactions["trx-1"])
+	}
+
+	if account.Synced("trx-3") {
+		t.Error("expected setting values not to mark trx-3 as synced")
+	}
+
+	// syncing again replaces the values
+	account.MarkSynced("trx-1", first)
+
+	if account.Transactions["trx-1"].Values != nil {
+		t.Errorf("expected the values of trx-1 to be reset, got %+v", account.Transactions["trx-1"].Values)
+	}
+}
+
+func TestPrune(t *testing.T) {
+	before := time.Date(2021, 10, 1, 0, 0, 0, 0, time.UTC)
+
+	account := NewAccount()
+	account.MarkSynced("earlier", before.AddDate(0, 0, -1))
+	account.MarkSynced("just-before", before.Add(-time.Nanosecond))
+	account.MarkSynced("at", before)
+	account.MarkSynced("after", before.AddDate(0, 0, 1))
+
+	lastBookingDate := account.LastBookingDate
+
+	account.Prune(before)
+
+	for externalID, wantSynced := range map[string]bool{
+		"earlier":     false,
+		"just-before": false,
+		"at":          true,
+		"after":       true,
+	} {
+		if synced := account.Synced(externalID); synced != wantSynced {
+			t.Errorf("expected synced of %s to be %t, got %t", externalID, wantSynced, synced)
+		}
+	}
+
+	if !account.LastBookingDate.Equal(lastBookingDate) {
+		t.Errorf("expected the last booking date to be kept, got %s", account.LastBookingDate)
+	}
+
+	// pruning everything leaves an empty state
+	account.Prune(before.AddDate(1, 0, 0))
+
+	if len(account.Transactions) != 0 {
+		t.Errorf("expected all transactions to be pruned, got %v", account.Transactions)
+	}
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/state"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// defaultExpiryWarningDays are the days before the expiry of a requisition at which warnings are logged.
+var defaultExpiryWarningDays = []int{14, 7, 3, 1}
+
+// requisitionStatus describes when the access of a requisition expires.
+type requisitionStatus struct {
+	Requisition *nordigen.Requisition
+	Agreement   *nordigen.Agreement
+	ExpiresAt   time.Time
+	DaysLeft    int
+	// ReauthRequisitionID is the requisition created to authenticate the requisition again,
+	// ReauthLink is its link unless it has been linked already.
+	ReauthRequisitionID string
+	ReauthLink          string
+	ReauthLinked        bool
+}
+
+// expired returns true if the access of the requisition has expired.
+func (s *requisitionStatus) expired() bool {
+	return s.Requisition.Status == nordigen.RequisitionStatusExpired || s.DaysLeft < 0
+}
+
+// expiryChecker checks the expiry of requisitions and creates links to authenticate them again.
+type expiryChecker struct {
+	nordigenClient *nordigen.Client
+	// store keeps the requisitions created to authenticate again, so they are reused until they are linked
+	store       state.Store
+	warningDays []int
+	redirect    string
+	// dryRun only reuses links created before and never creates new requisitions if set
+	dryRun bool
+	log    *zap.Logger
+}
+
+// statuses returns the expiry status of the given requisitions.
+func (c *expiryChecker) statuses(ctx context.Context, requisitions []*nordigen.Requisition) ([]*requisitionStatus, error) {
+	statuses := make([]*requisitionStatus, 0, len(requisitions))
+
+	for _, requisition := range requisitions {
+		status := &requisitionStatus{
+			Requisition: requisition,
+		}
+
+		if requisition.Agreement != "" {
+			agreement, err := c.nordigenClient.GetAgreement(ctx, requisition.Agreement)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to fetch agreement of requisition %s", requisition.ID)
+			}
+
+			status.Agreement = agreement
+			status.ExpiresAt = agreement.ExpiresAt()
+			status.DaysLeft = int(math.Floor(time.Until(status.ExpiresAt).Hours() / 24))
+		}
+
+		statuses = append(statuses, status)
+	}
+
+	return statuses, nil
+}
+
+// threshold returns the smallest warning threshold the requisition has reached, false is returned if none is reached.
+func (c *expiryChecker) threshold(status *requisitionStatus) (int, bool) {
+	if status.Agreement == nil {
+		return 0, false
+	}
+
+	thresholds := append([]int(nil), c.warningDays...)
+	sort.Ints(thresholds)
+
+	for _, threshold := range thresholds {
+		if status.DaysLeft <= threshold {
+			return threshold, true
+		}
+	}
+
+	return 0, false
+}
+
+// needsReauth returns true if the requisition has expired or reached the last warning threshold.
+func (c *expiryChecker) needsReauth(status *requisitionStatus) bool {
+	if status.expired() {
+		return true
+	}
+
+	if status.Agreement == nil || len(c.warningDays) == 0 {
+		return false
+	}
+
+	lowest := c.warningDays[0]
+	for _, threshold := range c.warningDays {
+		if threshold < lowest {
+			lowest = threshold
+		}
+	}
+
+	return status.DaysLeft <= lowest
+}
+
+// reauthStateKey returns the key of the state keeping the requisition created to authenticate
+// the given requisition again.
+func reauthStateKey(requisitionID string) string {
+	return "reauth:" + requisitionID
+}
+
+// reauthLink stores the link to authenticate the requisition again in the status. The requisition created
+// for it before is reused until it has been linked or has expired, otherwise a new one is created.
+func (c *expiryChecker) reauthLink(ctx context.Context, status *requisitionStatus) error {
+	key := reauthStateKey(status.Requisition.ID)
+
+	requisitionState, err := c.store.Load(ctx, key)
+	if err != nil {
+		return errors.Wrap(err, "failed to load state")
+	}
+
+	if requisitionState.Reauth != nil {
+		reused, err := c.reuseReauth(ctx, requisitionState.Reauth, status)
+		if err != nil || reused {
+			return err
+		}
+	}
+
+	if c.dryRun {
+		c.log.Info("dry run, skipping creation of re-authentication link",
+			zap.String("requisition_id", status.Requisition.ID),
+		)
+
+		return nil
+	}
+
+	requisition, err := c.createReauthRequisition(ctx, status)
+	if err != nil {
+		return err
+	}
+
+	requisitionState.Reauth = &state.Reauth{
+		RequisitionID: requisition.ID,
+		Link:          requisition.Link,
+		Created:       requisition.Created,
+	}
+
+	status.ReauthRequisitionID = requisition.ID
+	status.ReauthLink = requisition.Link
+
+	return errors.Wrap(c.store.Save(ctx, key, requisitionState), "failed to save state")
+}
+
+// reuseReauth stores the requisition created before in the status, false is returned if it cannot be reused
+// because it has expired, has been rejected or deleted.
+func (c *expiryChecker) reuseReauth(ctx context.Context, reauth *state.Reauth, status *requisitionStatus) (bool, error) {
+	requisition, err := c.nordigenClient.GetRequisition(ctx, reauth.RequisitionID)
+	if err != nil {
+		var apiErr *nordigen.APIError
+		if errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound {
+			return false, nil
+		}
+
+		return false, errors.Wrapf(err, "failed to fetch re-authentication requisition %s", reauth.RequisitionID)
+	}
+
+	switch requisition.Status {
+	case nordigen.RequisitionStatusExpired, nordigen.RequisitionStatusRejected, nordigen.RequisitionStatusSuspended:
+		return false, nil
+	}
+
+	status.ReauthRequisitionID = requisition.ID
+	status.ReauthLinked = requisition.Status == nordigen.RequisitionStatusLinked
+
+	if !status.ReauthLinked {
+		status.ReauthLink = requisition.Link
+	}
+
+	return true, nil
+}
+
+// createReauthRequisition creates a new requisition for the same institution with the same agreement parameters.
+func (c *expiryChecker) createReauthRequisition(ctx context.Context, status *requisitionStatus) (*nordigen.Requisition, error) {
+	agreementRequest := &nordigen.AgreementRequest{
+		InstitutionID: status.Requisition.InstitutionID,
+	}
+
+	if status.Agreement != nil {
+		agreementRequest.MaxHistoricalDays = status.Agreement.MaxHistoricalDays
+		agreementRequest.AccessValidForDays = status.Agreement.AccessValidForDays
+		agreementRequest.AccessScope = status.Agreement.AccessScope
+	}
+
+	agreement, err := c.nordigenClient.CreateAgreement(ctx, agreementRequest)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create agreement")
+	}
+
+	reference, err := randomReference()
+	if err != nil {
+		return nil, err
+	}
+
+	requisition, err := c.nordigenClient.CreateRequisition(ctx, &nordigen.RequisitionRequest{
+		Redirect:      c.redirect,
+		InstitutionID: status.Requisition.InstitutionID,
+		Reference:     reference,
+		Agreement:     agreement.ID,
+		UserLanguage:  status.Requisition.UserLanguage,
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create requisition")
+	}
+
+	return requisition, nil
+}
+
+// check logs warnings for all requisitions containing the given accounts which expire soon,
+// links to authenticate them again are created if reauth is set.
+func (c *expiryChecker) check(ctx context.Context, nordigenAccountIDs []string, reauth bool) error {
+	requisitions, err := c.nordigenClient.ListAllRequisitions(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to list requisitions")
+	}
+
+	accountIDs := make(map[string]bool, len(nordigenAccountIDs))
+	for _, accountID := range nordigenAccountIDs {
+		accountIDs[accountID] = true
+	}
+
+	relevant := make([]*nordigen.Requisition, 0, len(requisitions))
+
+	for _, requisition := range requisitions {
+		for _, accountID := range requisition.Accounts {
+			if accountIDs[accountID] {
+				relevant = append(relevant, requisition)
+				break
+			}
+		}
+	}
+
+	statuses, err := c.statuses(ctx, relevant)
+	if err != nil {
+		return err
+	}
+
+	for _, status := range statuses {
+		fields := []zap.Field{
+			zap.String("requisition_id", status.Requisition.ID),
+			zap.String("institution_id", status.Requisition.InstitutionID),
+			zap.Strings("accounts", status.Requisition.Accounts),
+			zap.Time("expires_at", status.ExpiresAt),
+			zap.Int("days_left", status.DaysLeft),
+		}
+
+		if reauth && c.needsReauth(status) {
+			err = c.reauthLink(ctx, status)
+			if err != nil {
+				c.log.Warn("failed to create re-authentication link", append(fields, zap.Error(err))...)
+			}
+		}
+
+		if status.ReauthLinked {
+			c.log.Info("requisition has been authenticated again, update the mapping to the accounts of the new requisition",
+				append(fields, zap.String("reauth_requisition_id", status.ReauthRequisitionID))...,
+			)
+
+			continue
+		}
+
+		if status.ReauthLink != "" {
+			fields = append(fields, zap.String("reauth_link", status.ReauthLink))
+		}
+
+		if status.expired() {
+			c.log.Error("requisition has expired, authenticate it again", fields...)
+			continue
+		}
+
+		if threshold, ok := c.threshold(status); ok {
+			c.log.Warn("requisition expires soon, authenticate it again",
+				append(fields, zap.Int("threshold_days", threshold))...,
+			)
+		}
+	}
+
+	return nil
+}
+
+// printStatus prints the expiry status of requisitions.
+func printStatus(
+	ctx context.Context,
+	args []string,
+	out io.Writer,
+	requisitionIDs []string,
+	checker *expiryChecker,
+) error {
+	flags := flag.NewFlagSet("status", flag.ContinueOnError)
+	flags.SetOutput(out)
+
+	reauth := flags.Bool("reauth", false, "create links to authenticate expired or expiring requisitions again")
+
+	err := flags.Parse(args)
+	if err != nil {
+		return errors.Wrap(err, "failed to parse flags")
+	}
+
+	var requisitions []*nordigen.Requisition
+
+	if len(requisitionIDs) == 0 {
+		requisitions, err = checker.nordigenClient.ListAllRequisitions(ctx)
+		if err != nil {
+			return errors.Wrap(err, "failed to list requisitions")
+		}
+	}
+
+	for _, requisitionID := range requisitionIDs {
+		requisition, err := checker.nordigenClient.GetRequisition(ctx, requisitionID)
+		if err != nil {
+			return errors.Wrapf(err, "failed to fetch requisition %s", requisitionID)
+		}
+
+		requisitions = append(requisitions, requisition)
+	}
+
+	statuses, err := checker.statuses(ctx, requisitions)
+	if err != nil {
+		return err
+	}
+
+	if *reauth {
+		for _, status := range statuses {
+			if !checker.needsReauth(status) {
+				continue
+			}
+
+			err = checker.reauthLink(ctx, status)
+			if err != nil {
+				return errors.Wrapf(err, "failed to create re-authentication link for requisition %s", status.Requisition.ID)
+			}
+		}
+	}
+
+	tw := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+
+	fmt.Fprintln(tw, "REQUISITION ID\tINSTITUTION\tSTATUS\tACCOUNTS\tEXPIRES\tDAYS LEFT\tRE-AUTHENTICATION LINK")
+	for _, status := range statuses {
+		expires, daysLeft := "-", "-"
+		if status.Agreement != nil {
+			expires = status.ExpiresAt.Format("2006-01-02")
+			daysLeft = fmt.Sprint(status.DaysLeft)
+		}
+
+		reauthLink := status.ReauthLink
+		if status.ReauthLinked {
+			reauthLink = fmt.Sprintf("linked (%s)", status.ReauthRequisitionID)
+		} else if reauthLink == "" {
+			reauthLink = "-"
+		}
+
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\t%s\n",
+			status.Requisition.ID,
+			status.Requisition.InstitutionID,
+			status.Requisition.Status,
+			len(status.Requisition.Accounts),
+			expires,
+			daysLeft,
+			reauthLink,
+		)
+	}
+
+	return errors.Wrap(tw.Flush(), "failed to write status")
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/state"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestPrintStatusReauth(t *testing.T) {
+	ctx := context.Background()
+	servers := newTestServers(t)
+
+	// the access expires tomorrow
+	agreement := servers.nordigen.AddAgreement(&nordigen.Agreement{
+		Created:            time.Now().AddDate(0, 0, -89),
+		InstitutionID:      "BANK_XYZ",
+		AccessValidForDays: 90,
+	})
+	expiring := servers.nordigen.AddRequisition(&nordigen.Requisition{
+		Status:        nordigen.RequisitionStatusLinked,
+		InstitutionID: "BANK_XYZ",
+		Agreement:     agreement.ID,
+		Accounts:      []string{testAccountID},
+	})
+
+	checker := &expiryChecker{
+		nordigenClient: servers.nordigenClient,
+		store:          state.NewMemoryStore(),
+		warningDays:    defaultExpiryWarningDays,
+		log:            zaptest.NewLogger(t),
+	}
+
+	status := func(args ...string) string {
+		t.Helper()
+
+		var out bytes.Buffer
+
+		err := printStatus(ctx, args, &out, []string{expiring.ID}, checker)
+		if err != nil {
+			t.Fatalf("failed to print status: %v", err)
+		}
+
+		return out.String()
+	}
+
+	// links are only created if asked for
+	if out := status(); len(servers.nordigen.Requisitions()) != 1 || strings.Contains(out, "/link/") {
+		t.Fatalf("expected no re-authentication link, got:\n%s", out)
+	}
+
+	// dry runs never create requisitions
+	checker.dryRun = true
+
+	status("-reauth")
+
+	if requisitions := servers.nordigen.Requisitions(); len(requisitions) != 1 {
+		t.Fatalf("expected no requisition to be created in a dry run, got %d", len(requisitions))
+	}
+
+	checker.dryRun = false
+
+	out := status("-reauth")
+
+	requisitions := servers.nordigen.Requisitions()
+	if len(requisitions) != 2 || !strings.Contains(out, requisitions[1].Link) {
+		t.Fatalf("expected a re-authentication link, got:\n%s", out)
+	}
+
+	reauth := requisitions[1]
+
+	// the pending requisition is reused, also in dry runs
+	checker.dryRun = true
+
+	if out := status("-reauth"); len(servers.nordigen.Requisitions()) != 2 || !strings.Contains(out, reauth.Link) {
+		t.Fatalf("expected the re-authentication link to be reused, got:\n%s", out)
+	}
+
+	checker.dryRun = false
+
+	// no further links are created once the requisition is linked
+	reauth.Status = nordigen.RequisitionStatusLinked
+
+	if out := status("-reauth"); len(servers.nordigen.Requisitions()) != 2 || !strings.Contains(out, "linked ("+reauth.ID+")") {
+		t.Fatalf("expected the requisition to be reported as linked, got:\n%s", out)
+	}
+
+	// a new requisition is created once the link has expired
+	reauth.Status = nordigen.RequisitionStatusExpired
+
+	status("-reauth")
+
+	if requisitions := servers.nordigen.Requisitions(); len(requisitions) != 3 {
+		t.Fatalf("expected a new requisition, got %d", len(requisitions))
+	}
+}
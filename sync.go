@@ -0,0 +1,359 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/lunchmoney"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/rules"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/state"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// exitCodeFailure is used if syncing failed for all mappings.
+	exitCodeFailure = 1
+	// exitCodePartialFailure is used if syncing failed for some mappings only.
+	exitCodePartialFailure = 2
+)
+
+const (
+	syncKindTransactions = "transactions"
+	syncKindBalance      = "balance"
+)
+
+// nordigenAPI is the part of the Nordigen API used for syncing,
+// it is implemented by the client and the cache wrapping it.
+type nordigenAPI interface {
+	ListAllRequisitions(ctx context.Context) ([]*nordigen.Requisition, error)
+	GetRequisition(ctx context.Context, requisitionID string) (*nordigen.Requisition, error)
+	GetAccountDetails(ctx context.Context, accountID string) (*nordigen.Account, error)
+	GetAccountBalances(ctx context.Context, accountID string) ([]*nordigen.Balance, error)
+	Transactions(ctx context.Context, accountID string, opts *nordigen.TransactionsOptions) (*nordigen.Transactions, error)
+	RateLimit(accountID, endpoint string) *nordigen.RateLimit
+}
+
+// syncer syncs all configured mappings.
+type syncer struct {
+	accounts []*accountConfig
+
+	nordigenClient   nordigenAPI
+	lunchmoneyClient lunchmoneyAPI
+	store            state.Store
+	log              *zap.Logger
+
+	// ruleSet are the rules of all accounts, category names used by them are resolved before every run
+	ruleSet *rules.RuleSet
+
+	// quota skips Nordigen requests exceeding the rate limits of an account
+	quota *quotaGuard
+
+	// transfers between accounts are detected if set, optionally grouped and assigned to a category
+	detectTransfers   bool
+	transfersTag      string
+	transfersCategory string
+	transfersGroup    bool
+
+	// expiryChecker warns about requisitions of the accounts which expire soon if set
+	expiryChecker *expiryChecker
+	reauthLinks   bool
+
+	// dryRun collects all changes instead of writing them if set, the report is rendered after every run.
+	dryRun       *dryRunReport
+	dryRunFormat string
+	dryRunOutput io.Writer
+}
+
+// syncResult is the outcome of syncing a single mapping.
+type syncResult struct {
+	Kind              string
+	Name              string
+	NordigenAccountID string
+	LunchmoneyAssetID int
+	Err               error
+	// Skipped is set if the mapping was skipped because of a Nordigen rate limit, Err contains the reason.
+	Skipped bool
+	RetryAt time.Time
+}
+
+// syncError is returned if syncing failed for at least one mapping.
+type syncError struct {
+	Failed int
+	Total  int
+}
+
+// Error returns the error message of a sync error.
+func (e *syncError) Error() string {
+	return fmt.Sprintf("syncing failed for %d of %d mappings", e.Failed, e.Total)
+}
+
+// ExitCode returns the exit code to use for the failure.
+func (e *syncError) ExitCode() int {
+	if e.Failed < e.Total {
+		return exitCodePartialFailure
+	}
+
+	return exitCodeFailure
+}
+
+// exitCode returns the exit code for an error failing a command, *syncError distinguishes partial failures.
+func exitCode(err error) int {
+	var syncErr *syncError
+	if errors.As(err, &syncErr) {
+		return syncErr.ExitCode()
+	}
+
+	return exitCodeFailure
+}
+
+// run syncs all mappings and logs a summary, a *syncError is returned if any mapping failed.
+func (s *syncer) run(ctx context.Context) error {
+	if s.dryRun != nil {
+		s.dryRun.reset()
+	}
+
+	// every dry run starts from the persisted state
+	if store, ok := s.store.(*dryRunStore); ok {
+		store.reset()
+	}
+
+	if s.expiryChecker != nil {
+		nordigenAccountIDs := make([]string, 0, len(s.accounts))
+		for _, account := range s.accounts {
+			nordigenAccountIDs = append(nordigenAccountIDs, account.NordigenAccountID)
+		}
+
+		err := s.expiryChecker.check(ctx, nordigenAccountIDs, s.reauthLinks)
+		if err != nil {
+			s.log.Warn("failed to check requisition expiry", zap.Error(err))
+		}
+	}
+
+	results := s.syncAll(ctx)
+
+	if s.dryRun != nil {
+		err := s.dryRun.render(s.dryRunOutput, s.dryRunFormat)
+		if err != nil {
+			s.log.Error("failed to render dry run report", zap.Error(err))
+		}
+	}
+
+	var failed, skipped int
+
+	for _, result := range results {
+		fields := []zap.Field{
+			zap.String("kind", result.Kind),
+			zap.String("name", result.Name),
+			zap.String("nordigen_account_id", result.NordigenAccountID),
+			zap.Int("lunchmoney_asset_id", result.LunchmoneyAssetID),
+		}
+
+		if result.Skipped {
+			skipped++
+
+			s.log.Warn("sync skipped, Nordigen rate limit exceeded",
+				append(fields, zap.Time("retry_at", result.RetryAt), zap.Error(result.Err))...,
+			)
+
+			continue
+		}
+
+		if result.Err != nil {
+			failed++
+
+			s.log.Error("sync failed", append(fields, zap.Error(result.Err))...)
+
+			continue
+		}
+
+		s.log.Info("sync succeeded", fields...)
+	}
+
+	s.log.Info("sync finished",
+		zap.Int("total", len(results)),
+		zap.Int("succeeded", len(results)-failed-skipped),
+		zap.Int("failed", failed),
+		zap.Int("skipped", skipped),
+	)
+
+	if failed > 0 {
+		return &syncError{
+			Failed: failed,
+			Total:  len(results),
+		}
+	}
+
+	return nil
+}
+
+// resolveCategories resolves the category names used by rules and for transfers
+// to the IDs of the Lunchmoney categories.
+func (s *syncer) resolveCategories(ctx context.Context, transfers *transferDetector) error {
+	transfersCategory := transfers != nil && s.transfersCategory != ""
+
+	if len(s.ruleSet.CategoryNames()) == 0 && !transfersCategory {
+		return nil
+	}
+
+	categories, err := s.lunchmoneyClient.GetCategories(ctx)
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch categories")
+	}
+
+	categoryIDs := rules.NewCategories()
+	for _, category := range categories {
+		// transactions cannot be assigned to category groups
+		if category.IsGroup {
+			continue
+		}
+
+		categoryIDs.Add(category.Name, category.ID)
+	}
+
+	if transfersCategory {
+		transfers.categoryID, err = categoryIDs.Resolve(s.transfersCategory)
+		if err != nil {
+			return errors.Wrap(err, "failed to resolve transfers category")
+		}
+	}
+
+	return s.ruleSet.ResolveCategories(categoryIDs)
+}
+
+// syncAll syncs the transactions and afterwards the balances of all accounts.
+// Every account is attempted independently of failures of other accounts.
+func (s *syncer) syncAll(ctx context.Context) []*syncResult {
+	results := make([]*syncResult, 0, len(s.accounts))
+
+	var transfers *transferDetector
+	if s.detectTransfers {
+		transfers = newTransferDetector(ctx, s.accounts, s.nordigenClient, s.store, s.quota, s.transfersTag, s.transfersGroup, s.log)
+	}
+
+	// transactions cannot be converted without the categories, balances are synced anyway
+	categoriesErr := s.resolveCategories(ctx, transfers)
+
+	// an invalid Lunchmoney access token fails all remaining accounts without making further requests
+	abortErr := lunchmoneyAbortError(categoriesErr)
+
+	for _, account := range s.accounts {
+		if !account.Transactions {
+			continue
+		}
+
+		result := &syncResult{
+			Kind:              syncKindTransactions,
+			Name:              account.name(),
+			NordigenAccountID: account.NordigenAccountID,
+			LunchmoneyAssetID: account.LunchmoneyAssetID,
+		}
+
+		result.Err = ctx.Err()
+		if result.Err == nil {
+			result.Err = abortErr
+		}
+
+		if result.Err == nil {
+			result.Err = categoriesErr
+		}
+
+		if result.Err == nil {
+			result.Err = syncAccount(
+				ctx,
+				account.NordigenAccountID,
+				account.LunchmoneyAssetID,
+				s.nordigenClient,
+				s.lunchmoneyClient,
+				s.store,
+				account.opts,
+				transfers,
+				s.quota,
+				s.log,
+			)
+		}
+
+		result.RetryAt, result.Skipped = rateLimited(result.Err)
+
+		if abortErr == nil {
+			abortErr = lunchmoneyAbortError(result.Err)
+		}
+
+		results = append(results, result)
+	}
+
+	if ctx.Err() == nil && abortErr == nil {
+		err := transfers.link(ctx, s.lunchmoneyClient, s.store, s.log)
+		if err != nil {
+			s.log.Error("failed to link transfers", zap.Error(err))
+		}
+	}
+
+	for _, account := range s.accounts {
+		if !account.Balance {
+			continue
+		}
+
+		result := &syncResult{
+			Kind:              syncKindBalance,
+			Name:              account.name(),
+			NordigenAccountID: account.NordigenAccountID,
+			LunchmoneyAssetID: account.LunchmoneyAssetID,
+		}
+
+		result.Err = ctx.Err()
+		if result.Err == nil {
+			result.Err = abortErr
+		}
+
+		if result.Err == nil {
+			result.Err = syncBalance(
+				ctx,
+				account.NordigenAccountID,
+				account.LunchmoneyAssetID,
+				s.nordigenClient,
+				s.lunchmoneyClient,
+				s.store,
+				s.quota,
+				s.log,
+			)
+		}
+
+		result.RetryAt, result.Skipped = rateLimited(result.Err)
+
+		if abortErr == nil {
+			abortErr = lunchmoneyAbortError(result.Err)
+		}
+
+		results = append(results, result)
+	}
+
+	return results
+}
+
+// lunchmoneyAbortError returns an error to fail all remaining accounts with if the error shows
+// that no request to Lunchmoney can succeed, nil is returned otherwise.
+func lunchmoneyAbortError(err error) error {
+	if !lunchmoney.IsKind(err, lunchmoney.ErrorKindUnauthorized) {
+		return nil
+	}
+
+	return errors.Wrap(err, "skipped, Lunchmoney rejected the access token")
+}
+
+// sortedKeys returns the keys of a mapping in a stable order.
+func sortedKeys(mapping map[string]int) []string {
+	keys := make([]string, 0, len(mapping))
+
+	for key := range mapping {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
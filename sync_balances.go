@@ -3,9 +3,11 @@ package main
 import (
 	"context"
 	"strings"
+	"time"
 
 	"github.com/Seklfreak/nordigen-lunchmoney-sync/lunchmoney"
 	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/state"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
@@ -14,10 +16,29 @@ func syncBalance(
 	ctx context.Context,
 	nordigenAccountID string,
 	lunchmoneyAssetID int,
-	nordigenClient *nordigen.Client,
-	lunchmoneyClient *lunchmoney.Client,
+	nordigenClient nordigenAPI,
+	lunchmoneyClient lunchmoneyAPI,
+	store state.Store,
+	quota *quotaGuard,
 	log *zap.Logger,
 ) error {
+	// the state only contains the rate limits of the balances
+	key := stateKey(nordigenAccountID, lunchmoneyAssetID)
+
+	accountState, err := store.Load(ctx, key)
+	if err != nil {
+		return errors.Wrap(err, "failed to load sync state")
+	}
+
+	// cached balances do not reach Nordigen, the rate limit only applies to actual requests
+	cached := cachedResponse(nordigenClient, nordigenAccountID, nordigen.EndpointBalances)
+	if !cached {
+		err = quota.check(accountState, nordigen.EndpointBalances, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
 	assets, err := lunchmoneyClient.GetAssets(ctx)
 	if err != nil {
 		return errors.Wrap(err, "failed to fetch asses from Lunchmoney")
@@ -36,6 +57,16 @@ func syncBalance(
 	}
 
 	balances, err := nordigenClient.GetAccountBalances(ctx, nordigenAccountID)
+
+	if !cached {
+		rateLimit := nordigenClient.RateLimit(nordigenAccountID, nordigen.EndpointBalances)
+		if quota.record(accountState, nordigen.EndpointBalances, rateLimit, time.Now()) {
+			if saveErr := store.Save(ctx, key, accountState); saveErr != nil {
+				log.Warn("failed to save rate limit", zap.Error(saveErr))
+			}
+		}
+	}
+
 	if err != nil {
 		return errors.Wrap(err, "failed to fetch account balances from Nordigen")
 	}
@@ -54,7 +85,7 @@ func syncBalance(
 		return errors.New("unable to find a balance to sync on Nordigen")
 	}
 
-	lmBalance := lunchmoney.AssetBalance(balance.BalanceAmount.Amount)
+	lmBalance := balance.BalanceAmount.Amount.Round(balance.BalanceAmount.Currency)
 
 	err = lunchmoneyClient.UpdateAsset(ctx, lunchmoneyAssetID, &lunchmoney.Asset{
 		Balance: &lmBalance,
@@ -64,7 +95,7 @@ func syncBalance(
 	}
 
 	log.Info("synced balance",
-		zap.Float64("amount", float64(balance.BalanceAmount.Amount)),
+		zap.Stringer("amount", lmBalance),
 		zap.String("nordigen_account_id", nordigenAccountID),
 		zap.Int("lunchmoney_asset_id", lunchmoneyAssetID),
 	)
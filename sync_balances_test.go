@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen/nordigencache"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen/nordigentest"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/state"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestSyncBalance(t *testing.T) {
+	ctx := context.Background()
+	servers := newTestServers(t)
+
+	servers.nordigen.SetAccount(testAccountID, &nordigentest.Account{
+		Details: &nordigen.Account{Currency: "EUR"},
+		Balances: []*nordigentest.Balance{
+			{Amount: "999.99", Currency: "EUR", Type: "closingBooked"},
+			{Amount: "1234.56", Currency: "USD", Type: "expected"},
+			{Amount: "1234.50", Currency: "EUR", Type: "expected"},
+		},
+	})
+
+	err := syncBalance(ctx, testAccountID, servers.asset.ID, servers.nordigenClient, servers.lunchmoneyClient, state.NewMemoryStore(), nil, zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatalf("failed to sync balance: %v", err)
+	}
+
+	asset := servers.lunchmoney.Asset(servers.asset.ID)
+	if asset.Balance == nil || asset.Balance.String() != "1234.50" {
+		t.Fatalf("expected balance 1234.50, got %v", asset.Balance)
+	}
+
+	// unknown assets cannot be synced
+	err = syncBalance(ctx, testAccountID, servers.asset.ID+1, servers.nordigenClient, servers.lunchmoneyClient, state.NewMemoryStore(), nil, zaptest.NewLogger(t))
+	if err == nil {
+		t.Fatal("expected an error for an unknown asset")
+	}
+}
+
+func TestSyncBalanceCachedQuota(t *testing.T) {
+	ctx := context.Background()
+	servers := newTestServers(t)
+
+	servers.nordigen.SetAccount(testAccountID, &nordigentest.Account{
+		Details:  &nordigen.Account{Currency: "EUR"},
+		Balances: []*nordigentest.Balance{{Amount: "1234.50", Currency: "EUR", Type: "expected"}},
+	})
+
+	cache, err := nordigencache.New(servers.nordigenClient, t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create cache: %v", err)
+	}
+
+	store := state.NewMemoryStore()
+	quota := &quotaGuard{}
+	log := zaptest.NewLogger(t)
+
+	err = syncBalance(ctx, testAccountID, servers.asset.ID, cache, servers.lunchmoneyClient, store, quota, log)
+	if err != nil {
+		t.Fatalf("failed to sync balance: %v", err)
+	}
+
+	// no requests are left until the reset
+	key := stateKey(testAccountID, servers.asset.ID)
+
+	accountState := state.NewAccount()
+	accountState.SetRateLimit(nordigen.EndpointBalances, &state.RateLimit{Remaining: 0, Reset: time.Now().Add(time.Hour)})
+
+	err = store.Save(ctx, key, accountState)
+	if err != nil {
+		t.Fatalf("failed to save state: %v", err)
+	}
+
+	// the cached balances do not reach Nordigen
+	err = syncBalance(ctx, testAccountID, servers.asset.ID, cache, servers.lunchmoneyClient, store, quota, log)
+	if err != nil {
+		t.Fatalf("expected the cached balances to be synced, got %v", err)
+	}
+
+	requests := 0
+	for _, req := range servers.nordigen.Requests() {
+		if strings.HasSuffix(req.Path, "/"+nordigen.EndpointBalances+"/") {
+			requests++
+		}
+	}
+
+	if requests != 1 {
+		t.Errorf("expected a single balances request, got %d", requests)
+	}
+
+	// requests which would reach Nordigen are skipped
+	err = syncBalance(ctx, testAccountID, servers.asset.ID, servers.nordigenClient, servers.lunchmoneyClient, store, quota, log)
+	if _, ok := rateLimited(err); !ok {
+		t.Errorf("expected the request to be skipped, got %v", err)
+	}
+}
@@ -0,0 +1,264 @@
+package main
+
+import (
+	"context"
+	"math"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/lunchmoney"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/state"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// pendingTag is the tag added to pending transactions in Lunchmoney.
+	pendingTag = "pending"
+	// pendingExternalIDPrefix is prepended to the external ID of pending transactions,
+	// some banks reuse the ID of a pending transaction once it is booked.
+	pendingExternalIDPrefix = "pending:"
+	// pendingMatchDays is the maximum number of days between a pending and its booked transaction.
+	pendingMatchDays = 5
+	// pendingExpiryDays is the number of days after which pending transactions which disappeared
+	// from Nordigen without a matching booked transaction are deleted.
+	pendingExpiryDays = 7
+)
+
+// replacePendingTransactions updates pending transactions in Lunchmoney with their booked counterpart.
+// It returns the booked transactions that did not replace a pending transaction and still have to be inserted,
+// and the external IDs of the replaced pending transactions. Replaced transfers are recorded in the state
+// to be linked later.
+func replacePendingTransactions(
+	ctx context.Context,
+	booked []*lunchmoney.Transaction,
+	bookingDates map[string]time.Time,
+	transfers map[string]*state.Transfer,
+	accountState *state.Account,
+	lunchmoneyClient lunchmoneyAPI,
+	saveState func() error,
+	log *zap.Logger,
+) ([]*lunchmoney.Transaction, map[string]bool, error) {
+	remaining := make([]*lunchmoney.Transaction, 0, len(booked))
+	replaced := make(map[string]bool)
+
+	for _, trx := range booked {
+		pendingID, pending := matchPendingTransaction(trx, accountState.Pending)
+		if pending == nil {
+			remaining = append(remaining, trx)
+			continue
+		}
+
+		err := lunchmoneyClient.UpdateTransaction(ctx, pending.LunchmoneyID, trx)
+		if lunchmoney.IsKind(err, lunchmoney.ErrorKindNotFound) {
+			// the pending transaction has been deleted in Lunchmoney, the booked one is inserted instead
+			log.Warn("pending transaction not found in Lunchmoney, inserting booked transaction",
+				zap.Int("lunchmoney_transaction_id", pending.LunchmoneyID),
+				zap.String("pending_external_id", pendingID),
+			)
+
+			delete(accountState.Pending, pendingID)
+			replaced[pendingID] = true
+			remaining = append(remaining, trx)
+
+			continue
+		}
+
+		if err != nil {
+			return nil, nil, errors.Wrapf(err, "failed to update pending Lunchmoney transaction %d", pending.LunchmoneyID)
+		}
+
+		delete(accountState.Pending, pendingID)
+		replaced[pendingID] = true
+		accountState.MarkSynced(trx.ExternalID, bookingDates[trx.ExternalID])
+		accountState.SetValues(trx.ExternalID, transactionValues(trx))
+
+		if transfer := transfers[trx.ExternalID]; transfer != nil {
+			transfer.LunchmoneyID = pending.LunchmoneyID
+			accountState.AddTransfer(trx.ExternalID, transfer)
+		}
+
+		err = saveState()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		log.Info("replaced pending transaction",
+			zap.Int("lunchmoney_transaction_id", pending.LunchmoneyID),
+			zap.String("pending_external_id", pendingID),
+			zap.String("external_id", trx.ExternalID),
+		)
+	}
+
+	return remaining, replaced, nil
+}
+
+// matchPendingTransaction finds the pending transaction that most likely turned into the booked transaction.
+// Candidates need to have the same amount and a close date, a matching payee is preferred.
+func matchPendingTransaction(
+	booked *lunchmoney.Transaction,
+	pending map[string]*state.PendingTransaction,
+) (string, *state.PendingTransaction) {
+	var (
+		bestID    string
+		best      *state.PendingTransaction
+		bestScore = math.MaxInt32
+	)
+
+	for id, candidate := range pending {
+		if !candidate.Amount.Equal(booked.Amount) ||
+			!strings.EqualFold(candidate.Currency, booked.Currency) {
+			continue
+		}
+
+		days := int(math.Abs(time.Time(booked.Date).Sub(candidate.Date).Hours() / 24))
+		if days > pendingMatchDays {
+			continue
+		}
+
+		score := days
+		if !payeesMatch(candidate.Payee, booked.Payee) {
+			score += pendingMatchDays + 1
+		}
+
+		// compare IDs on equal scores so the result does not depend on the map order
+		if score < bestScore || (score == bestScore && id < bestID) {
+			bestID, best, bestScore = id, candidate, score
+		}
+	}
+
+	return bestID, best
+}
+
+// payeesMatch returns true if both payees likely refer to the same counterparty.
+func payeesMatch(a, b string) bool {
+	a, b = normalizePayee(a), normalizePayee(b)
+
+	if a == "" || b == "" {
+		return true
+	}
+
+	return strings.Contains(a, b) || strings.Contains(b, a)
+}
+
+func normalizePayee(payee string) string {
+	return strings.Map(func(r rune) rune {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			return -1
+		}
+
+		return unicode.ToLower(r)
+	}, payee)
+}
+
+// syncPendingTransactions inserts new pending transactions into Lunchmoney
+// and deletes pending transactions that disappeared without being booked. Pending transactions replaced
+// by their booked counterpart in the same run are skipped, as banks often still return them for a while.
+func syncPendingTransactions(
+	ctx context.Context,
+	pending []nordigen.Transaction,
+	account *nordigen.Account,
+	lunchmoneyAssetID int,
+	accountState *state.Account,
+	lunchmoneyClient lunchmoneyAPI,
+	opts *syncOptions,
+	replaced map[string]bool,
+	saveState func() error,
+	log *zap.Logger,
+) error {
+	current := make(map[string]bool, len(pending))
+	lunchmoneyTransactions := make([]*lunchmoney.Transaction, 0, len(pending))
+
+	for _, trx := range pending {
+		lmTrx, err := createLunchmoneyTrx(trx, account, lunchmoneyAssetID, opts.Rules)
+		if err != nil {
+			// pending transactions are often incomplete, they will be synced once they are booked
+			log.Warn("skipping pending transaction", zap.Error(err))
+			continue
+		}
+
+		if lmTrx == nil {
+			continue
+		}
+
+		lmTrx.ExternalID = pendingExternalIDPrefix + lmTrx.ExternalID
+		lmTrx.Tags = append(lmTrx.Tags, pendingTag)
+
+		current[lmTrx.ExternalID] = true
+
+		if _, ok := accountState.Pending[lmTrx.ExternalID]; ok || replaced[lmTrx.ExternalID] {
+			continue
+		}
+
+		lunchmoneyTransactions = append(lunchmoneyTransactions, lmTrx)
+	}
+
+	for _, chunk := range chunkTransactions(lunchmoneyTransactions, insertChunkSize) {
+		ids, err := insertTransactions(ctx, chunk, lunchmoneyClient, log)
+		if err != nil {
+			return errors.Wrap(err, "failed to insert pending transactions")
+		}
+
+		// IDs can only be assigned if every transaction of the chunk has been inserted
+		if len(ids) != len(chunk) {
+			log.Warn("unable to track inserted pending transactions, they will not be replaced once booked",
+				zap.Int("inserted_count", len(ids)),
+				zap.Int("chunk_size", len(chunk)),
+			)
+
+			continue
+		}
+
+		for i, trx := range chunk {
+			if ids[i] <= 0 {
+				continue
+			}
+
+			accountState.AddPending(trx.ExternalID, &state.PendingTransaction{
+				LunchmoneyID: ids[i],
+				Date:         time.Time(trx.Date),
+				Amount:       trx.Amount,
+				Currency:     trx.Currency,
+				Payee:        trx.Payee,
+			})
+		}
+
+		err = saveState()
+		if err != nil {
+			return err
+		}
+
+		log.Info("inserted pending transactions", zap.Int("inserted_count", len(ids)))
+	}
+
+	// delete pending transactions that have disappeared and were not booked in time
+	expiry := time.Now().AddDate(0, 0, -pendingExpiryDays)
+
+	for id, trx := range accountState.Pending {
+		if current[id] || trx.Date.After(expiry) {
+			continue
+		}
+
+		// transactions deleted in Lunchmoney already only have to be forgotten
+		err := lunchmoneyClient.DeleteTransaction(ctx, trx.LunchmoneyID)
+		if err != nil && !lunchmoney.IsKind(err, lunchmoney.ErrorKindNotFound) {
+			return errors.Wrapf(err, "failed to delete stale pending Lunchmoney transaction %d", trx.LunchmoneyID)
+		}
+
+		delete(accountState.Pending, id)
+
+		err = saveState()
+		if err != nil {
+			return err
+		}
+
+		log.Info("deleted stale pending transaction",
+			zap.Int("lunchmoney_transaction_id", trx.LunchmoneyID),
+			zap.String("external_id", id),
+		)
+	}
+
+	return nil
+}
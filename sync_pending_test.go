@@ -0,0 +1,228 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/lunchmoney"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/money"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen/nordigentest"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/state"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestMatchPendingTransaction(t *testing.T) {
+	date := time.Date(2021, 10, 5, 0, 0, 0, 0, time.UTC)
+
+	booked := &lunchmoney.Transaction{
+		Date:     lunchmoney.TransactionDate(date),
+		Amount:   money.MustParse("-12.50"),
+		Currency: "eur",
+		Payee:    "Bakery Ltd",
+	}
+
+	pending := func(days int, amount, currency, payee string) *state.PendingTransaction {
+		return &state.PendingTransaction{
+			Date:     date.AddDate(0, 0, days),
+			Amount:   money.MustParse(amount),
+			Currency: currency,
+			Payee:    payee,
+		}
+	}
+
+	tests := []struct {
+		name    string
+		pending map[string]*state.PendingTransaction
+		wantID  string
+	}{
+		{
+			name:    "same amount and date",
+			pending: map[string]*state.PendingTransaction{"a": pending(0, "-12.5", "EUR", "BAKERY")},
+			wantID:  "a",
+		},
+		{
+			name:    "different amount",
+			pending: map[string]*state.PendingTransaction{"a": pending(0, "-12.51", "eur", "Bakery")},
+		},
+		{
+			name:    "different currency",
+			pending: map[string]*state.PendingTransaction{"a": pending(0, "-12.50", "usd", "Bakery")},
+		},
+		{
+			name:    "within the match days",
+			pending: map[string]*state.PendingTransaction{"a": pending(-pendingMatchDays, "-12.50", "eur", "Bakery")},
+			wantID:  "a",
+		},
+		{
+			name:    "beyond the match days",
+			pending: map[string]*state.PendingTransaction{"a": pending(-pendingMatchDays-1, "-12.50", "eur", "Bakery")},
+		},
+		{
+			name: "closer date",
+			pending: map[string]*state.PendingTransaction{
+				"a": pending(-3, "-12.50", "eur", "Bakery"),
+				"b": pending(-1, "-12.50", "eur", "Bakery"),
+			},
+			wantID: "b",
+		},
+		{
+			name: "matching payee",
+			pending: map[string]*state.PendingTransaction{
+				"a": pending(0, "-12.50", "eur", "Kiosk"),
+				"b": pending(-4, "-12.50", "eur", "bakery"),
+			},
+			wantID: "b",
+		},
+		{
+			name: "different payee",
+			pending: map[string]*state.PendingTransaction{
+				"a": pending(-1, "-12.50", "eur", "Kiosk"),
+			},
+			wantID: "a",
+		},
+		{
+			name: "equal scores",
+			pending: map[string]*state.PendingTransaction{
+				"b": pending(-1, "-12.50", "eur", "Bakery"),
+				"a": pending(1, "-12.50", "eur", "Bakery"),
+			},
+			wantID: "a",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			id, match := matchPendingTransaction(booked, tt.pending)
+			if id != tt.wantID {
+				t.Fatalf("expected match %q, got %q", tt.wantID, id)
+			}
+
+			if (match != nil) != (tt.wantID != "") || (match != nil && match != tt.pending[id]) {
+				t.Errorf("expected the pending transaction of %q, got %+v", tt.wantID, match)
+			}
+		})
+	}
+}
+
+func TestPayeesMatch(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"Bakery", "Bakery", true},
+		{"BAKERY LTD.", "bakery ltd", true},
+		{"CARD 1234 Bakery", "Bakery", true},
+		{"Bakery", "Bakery Ltd", true},
+		{"Bakery", "Kiosk", false},
+		{"", "Kiosk", true},
+		{"***", "Kiosk", true},
+		{"Café", "cafe", false},
+	}
+
+	for _, tt := range tests {
+		if got := payeesMatch(tt.a, tt.b); got != tt.want {
+			t.Errorf("expected payeesMatch(%q, %q) to be %t, got %t", tt.a, tt.b, tt.want, got)
+		}
+	}
+}
+
+func TestSyncAccountPending(t *testing.T) {
+	ctx := context.Background()
+	servers := newTestServers(t)
+	store := state.NewMemoryStore()
+
+	sync := func() {
+		t.Helper()
+
+		err := syncAccount(ctx, testAccountID, servers.asset.ID, servers.nordigenClient, servers.lunchmoneyClient, store, &syncOptions{Pending: true}, nil, nil, zaptest.NewLogger(t))
+		if err != nil {
+			t.Fatalf("failed to sync account: %v", err)
+		}
+	}
+
+	today := time.Now().UTC().Format("2006-01-02")
+	old := time.Now().UTC().AddDate(0, 0, -pendingExpiryDays-1).Format("2006-01-02")
+
+	authorisation := &nordigentest.Transaction{
+		TransactionID: "auth-1",
+		ValueDate:     today,
+		Amount:        "-12.50",
+		Currency:      "EUR",
+		CreditorName:  "BAKERY",
+	}
+	stale := &nordigentest.Transaction{
+		TransactionID: "auth-2",
+		ValueDate:     old,
+		Amount:        "-30.00",
+		Currency:      "EUR",
+		CreditorName:  "Hotel",
+	}
+
+	servers.nordigen.SetPendingTransactions(testAccountID, authorisation, stale)
+
+	sync()
+
+	transactions := servers.lunchmoney.Transactions()
+	if len(transactions) != 2 {
+		t.Fatalf("expected 2 pending transactions, got %+v", transactions)
+	}
+
+	pendingID := transactions[0].ID
+
+	if trx := transactions[0]; trx.ExternalID != pendingExternalIDPrefix+"auth-1" || !hasTag(trx.Tags, pendingTag) {
+		t.Errorf("expected a tagged pending transaction, got %+v", trx)
+	}
+
+	// the authorisation is booked, the bank still returns it as pending as well
+	servers.nordigen.AddBookedTransactions(testAccountID, &nordigentest.Transaction{
+		TransactionID: "trx-1",
+		BookingDate:   today,
+		Amount:        "-12.50",
+		Currency:      "EUR",
+		CreditorName:  "Bakery",
+	})
+
+	sync()
+
+	transactions = servers.lunchmoney.Transactions()
+	if len(transactions) != 2 {
+		t.Fatalf("expected the pending transaction to be replaced without inserting it again, got %+v", transactions)
+	}
+
+	if trx := transactions[0]; trx.ID != pendingID || trx.ExternalID != "trx-1" || trx.Payee != "Bakery" || hasTag(trx.Tags, pendingTag) {
+		t.Errorf("expected the pending transaction to be replaced by the booked one, got %+v", trx)
+	}
+
+	accountState, err := store.Load(ctx, stateKey(testAccountID, servers.asset.ID))
+	if err != nil {
+		t.Fatalf("failed to load state: %v", err)
+	}
+
+	if !accountState.Synced("trx-1") {
+		t.Error("expected the booked transaction to be synced")
+	}
+
+	if _, ok := accountState.Pending[pendingExternalIDPrefix+"auth-1"]; ok {
+		t.Error("expected the replaced pending transaction to be forgotten")
+	}
+
+	// the stale authorisation disappears without being booked
+	servers.nordigen.SetPendingTransactions(testAccountID)
+
+	sync()
+
+	transactions = servers.lunchmoney.Transactions()
+	if len(transactions) != 1 || transactions[0].ExternalID != "trx-1" {
+		t.Fatalf("expected the stale pending transaction to be deleted, got %+v", transactions)
+	}
+
+	accountState, err = store.Load(ctx, stateKey(testAccountID, servers.asset.ID))
+	if err != nil {
+		t.Fatalf("failed to load state: %v", err)
+	}
+
+	if len(accountState.Pending) != 0 {
+		t.Errorf("expected no pending transactions in the state, got %+v", accountState.Pending)
+	}
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/lunchmoney"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/state"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// removedActionReport only logs transactions removed by the bank.
+	removedActionReport = "report"
+	// removedActionTag adds the removed tag to transactions removed by the bank.
+	removedActionTag = "tag"
+	// removedActionDelete deletes transactions removed by the bank from Lunchmoney.
+	removedActionDelete = "delete"
+
+	// removedTag is the tag added to transactions removed by the bank.
+	removedTag = "removed"
+)
+
+// syncRemovedTransactions handles transactions synced before which are no longer returned by the bank
+// within the range of booking dates it returned, e.g. reversed card authorisations. Handled transactions
+// are forgotten, so they are inserted again if the bank returns them again.
+func syncRemovedTransactions(
+	ctx context.Context,
+	booked []nordigen.Transaction,
+	trxOpts *nordigen.TransactionsOptions,
+	lunchmoneyAssetID int,
+	accountState *state.Account,
+	lunchmoneyClient lunchmoneyAPI,
+	action string,
+	saveState func() error,
+	log *zap.Logger,
+) error {
+	// some banks return no transactions at all when they have issues, this must not remove everything
+	if len(booked) == 0 {
+		log.Debug("no booked transactions fetched, skipping detection of removed transactions")
+		return nil
+	}
+
+	fetched := make(map[string]bool, len(booked))
+
+	var fetchedFrom time.Time
+
+	for _, trx := range booked {
+		fetched[externalID(trx)] = true
+
+		if date := bookingDate(trx); fetchedFrom.IsZero() || date.Before(fetchedFrom) {
+			fetchedFrom = date
+		}
+	}
+
+	removed := make([]string, 0)
+
+	var startDate, endDate time.Time
+
+	for externalID, trx := range accountState.Transactions {
+		if fetched[externalID] || !inFetchedRange(trx.BookingDate, fetchedFrom, trxOpts) {
+			continue
+		}
+
+		removed = append(removed, externalID)
+
+		if startDate.IsZero() || trx.BookingDate.Before(startDate) {
+			startDate = trx.BookingDate
+		}
+
+		if trx.BookingDate.After(endDate) {
+			endDate = trx.BookingDate
+		}
+	}
+
+	if len(removed) == 0 {
+		return nil
+	}
+
+	sort.Strings(removed)
+
+	// the date in Lunchmoney is the value date, which can differ from the booking date
+	existing, err := lunchmoneyClient.GetAllTransactions(ctx, &lunchmoney.TransactionFilter{
+		AssetID:   lunchmoneyAssetID,
+		StartDate: startDate.AddDate(0, 0, -syncOverlapDays),
+		EndDate:   endDate.AddDate(0, 0, syncOverlapDays),
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch transactions from Lunchmoney")
+	}
+
+	byExternalID := make(map[string]*lunchmoney.StoredTransaction, len(existing))
+	for _, trx := range existing {
+		if trx.ExternalID != "" {
+			byExternalID[trx.ExternalID] = trx
+		}
+	}
+
+	var affected int
+
+	for _, externalID := range removed {
+		trx := byExternalID[externalID]
+		if trx == nil {
+			// deleted or split in Lunchmoney already
+			log.Debug("removed transaction not found in Lunchmoney", zap.String("external_id", externalID))
+		} else {
+			err = handleRemovedTransaction(ctx, trx, lunchmoneyClient, action)
+			if err != nil {
+				return errors.Wrapf(err, "failed to handle removed Lunchmoney transaction %d", trx.ID)
+			}
+
+			affected++
+
+			log.Warn("transaction removed by the bank",
+				zap.String("action", action),
+				zap.Int("lunchmoney_transaction_id", trx.ID),
+				zap.String("external_id", externalID),
+				zap.String("date", time.Time(trx.Date).Format("2006-01-02")),
+				zap.String("payee", trx.Payee),
+				zap.String("amount", trx.Amount.Format(trx.Currency)),
+				zap.String("currency", trx.Currency),
+			)
+		}
+
+		delete(accountState.Transactions, externalID)
+		delete(accountState.Transfers, externalID)
+
+		err = saveState()
+		if err != nil {
+			return err
+		}
+	}
+
+	log.Info("handled transactions removed by the bank",
+		zap.String("action", action),
+		zap.Int("removed_count", len(removed)),
+		zap.Int("affected_count", affected),
+	)
+
+	return nil
+}
+
+// handleRemovedTransaction applies the action to a transaction removed by the bank.
+func handleRemovedTransaction(
+	ctx context.Context,
+	trx *lunchmoney.StoredTransaction,
+	lunchmoneyClient lunchmoneyAPI,
+	action string,
+) error {
+	switch action {
+	case removedActionTag:
+		if trx.HasTag(removedTag) {
+			return nil
+		}
+
+		tags := make([]string, 0, len(trx.Tags)+1)
+		for _, tag := range trx.Tags {
+			tags = append(tags, tag.Name)
+		}
+
+		// date and amount are required, the values in Lunchmoney are kept
+		return lunchmoneyClient.UpdateTransaction(ctx, trx.ID, &lunchmoney.Transaction{
+			Date:   trx.Date,
+			Amount: trx.Amount,
+			Tags:   append(tags, removedTag),
+		})
+	case removedActionDelete:
+		err := lunchmoneyClient.DeleteTransaction(ctx, trx.ID)
+		if lunchmoney.IsKind(err, lunchmoney.ErrorKindNotFound) {
+			return nil
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// inFetchedRange returns true if transactions booked on the date are covered by the fetched transactions.
+// Banks only return a limited history regardless of the requested date range, so only dates after the earliest
+// returned booking date are covered. The earliest date itself is excluded as it may be covered partially.
+func inFetchedRange(bookingDate time.Time, fetchedFrom time.Time, trxOpts *nordigen.TransactionsOptions) bool {
+	if !bookingDate.After(fetchedFrom) {
+		return false
+	}
+
+	return trxOpts == nil || trxOpts.DateTo.IsZero() || !bookingDate.After(trxOpts.DateTo)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen/nordigentest"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/state"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestSyncAccountRemoved(t *testing.T) {
+	bakery := &nordigentest.Transaction{
+		TransactionID: "trx-1",
+		BookingDate:   "2021-10-01",
+		Amount:        "-12.50",
+		Currency:      "EUR",
+		CreditorName:  "Bakery",
+	}
+	kiosk := &nordigentest.Transaction{
+		TransactionID: "trx-2",
+		BookingDate:   "2021-10-02",
+		Amount:        "-5.00",
+		Currency:      "EUR",
+		CreditorName:  "Kiosk",
+	}
+	bookshop := &nordigentest.Transaction{
+		TransactionID: "trx-3",
+		BookingDate:   "2021-10-03",
+		Amount:        "-20.00",
+		Currency:      "EUR",
+		CreditorName:  "Bookshop",
+	}
+
+	tests := []struct {
+		action      string
+		wantRemoved bool
+		wantTagged  bool
+	}{
+		{removedActionReport, false, false},
+		{removedActionTag, false, true},
+		{removedActionDelete, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.action, func(t *testing.T) {
+			ctx := context.Background()
+			servers := newTestServers(t)
+			store := state.NewMemoryStore()
+
+			sync := func() {
+				t.Helper()
+
+				err := syncAccount(ctx, testAccountID, servers.asset.ID, servers.nordigenClient, servers.lunchmoneyClient, store, &syncOptions{Removed: tt.action}, nil, nil, zaptest.NewLogger(t))
+				if err != nil {
+					t.Fatalf("failed to sync account: %v", err)
+				}
+			}
+
+			servers.nordigen.AddBookedTransactions(testAccountID, bakery, kiosk, bookshop)
+
+			sync()
+
+			// nothing is removed if the bank returns no transactions at all
+			servers.nordigen.SetBookedTransactions(testAccountID)
+
+			sync()
+
+			if transactions := servers.lunchmoney.Transactions(); len(transactions) != 3 || hasTag(transactions[1].Tags, removedTag) {
+				t.Fatalf("expected the transactions to be kept, got %+v", transactions)
+			}
+
+			// the bank removes the second transaction
+			servers.nordigen.SetBookedTransactions(testAccountID, bakery, bookshop)
+
+			sync()
+
+			transactions := servers.lunchmoney.Transactions()
+
+			if tt.wantRemoved {
+				if len(transactions) != 2 || transactions[0].ExternalID != "trx-1" || transactions[1].ExternalID != "trx-3" {
+					t.Fatalf("expected the removed transaction to be deleted, got %+v", transactions)
+				}
+			} else {
+				if len(transactions) != 3 {
+					t.Fatalf("expected the removed transaction to be kept, got %+v", transactions)
+				}
+
+				if tagged := hasTag(transactions[1].Tags, removedTag); tagged != tt.wantTagged {
+					t.Errorf("expected tagged to be %t, got tags %v", tt.wantTagged, transactions[1].Tags)
+				}
+
+				if hasTag(transactions[0].Tags, removedTag) || hasTag(transactions[2].Tags, removedTag) {
+					t.Errorf("expected only the removed transaction to be tagged, got %+v", transactions)
+				}
+			}
+
+			accountState, err := store.Load(ctx, stateKey(testAccountID, servers.asset.ID))
+			if err != nil {
+				t.Fatalf("failed to load state: %v", err)
+			}
+
+			if !accountState.Synced("trx-1") || accountState.Synced("trx-2") || !accountState.Synced("trx-3") {
+				t.Errorf("expected only the removed transaction to be forgotten, got %v", accountState.Transactions)
+			}
+		})
+	}
+}
+
+func TestSyncAccountRemovedOutsideHistory(t *testing.T) {
+	ctx := context.Background()
+	servers := newTestServers(t)
+	store := state.NewMemoryStore()
+
+	// the start date is older than the history returned by the bank
+	opts := &syncOptions{
+		StartDate: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		Removed:   removedActionDelete,
+	}
+
+	sync := func() {
+		t.Helper()
+
+		err := syncAccount(ctx, testAccountID, servers.asset.ID, servers.nordigenClient, servers.lunchmoneyClient, store, opts, nil, nil, zaptest.NewLogger(t))
+		if err != nil {
+			t.Fatalf("failed to sync account: %v", err)
+		}
+	}
+
+	old := &nordigentest.Transaction{
+		TransactionID: "trx-1",
+		BookingDate:   "2021-07-01",
+		Amount:        "-12.50",
+		Currency:      "EUR",
+		CreditorName:  "Bakery",
+	}
+	recent := &nordigentest.Transaction{
+		TransactionID: "trx-2",
+		BookingDate:   "2021-10-02",
+		Amount:        "-20.00",
+		Currency:      "EUR",
+		CreditorName:  "Bookshop",
+	}
+
+	servers.nordigen.AddBookedTransactions(testAccountID, old, recent)
+
+	sync()
+
+	// the old transaction ages out of the history of the bank
+	servers.nordigen.SetBookedTransactions(testAccountID, recent)
+
+	sync()
+
+	if transactions := servers.lunchmoney.Transactions(); len(transactions) != 2 {
+		t.Fatalf("expected transactions outside of the history not to be deleted, got %+v", transactions)
+	}
+}
+
+func hasTag(tags []string, tag string) bool {
+	for _, t := range tags {
+		if t == tag {
+			return true
+		}
+	}
+
+	return false
+}
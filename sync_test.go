@@ -0,0 +1,233 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/lunchmoney"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen/nordigentest"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/state"
+	"github.com/pkg/errors"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"partial failure", &syncError{Failed: 1, Total: 2}, exitCodePartialFailure},
+		{"total failure", &syncError{Failed: 2, Total: 2}, exitCodeFailure},
+		{"wrapped sync error", errors.Wrap(&syncError{Failed: 1, Total: 3}, "failed"), exitCodePartialFailure},
+		{"other error", errors.New("failed"), exitCodeFailure},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if code := exitCode(tt.err); code != tt.want {
+				t.Errorf("expected exit code %d, got %d", tt.want, code)
+			}
+		})
+	}
+}
+
+// newTestSyncer creates a syncer for the accounts talking to the test servers.
+func newTestSyncer(t *testing.T, servers *testServers, accounts ...*accountConfig) *syncer {
+	t.Helper()
+
+	for _, account := range accounts {
+		if account.opts == nil {
+			account.opts = &syncOptions{}
+		}
+	}
+
+	return &syncer{
+		accounts:         accounts,
+		nordigenClient:   servers.nordigenClient,
+		lunchmoneyClient: servers.lunchmoneyClient,
+		store:            state.NewMemoryStore(),
+		log:              zaptest.NewLogger(t),
+		quota:            &quotaGuard{},
+	}
+}
+
+func TestSyncerRun(t *testing.T) {
+	tests := []struct {
+		name     string
+		prepare  func(servers *testServers)
+		secondID string
+		wantErr  *syncError
+	}{
+		{
+			name:     "all succeeded",
+			secondID: testAccountID,
+		},
+		{
+			name:     "partial failure",
+			secondID: "unknown-account",
+			wantErr:  &syncError{Failed: 1, Total: 2},
+		},
+		{
+			name:     "total failure",
+			prepare:  func(servers *testServers) { servers.nordigen.Fail("/accounts/", http.StatusInternalServerError, 10) },
+			secondID: testAccountID,
+			wantErr:  &syncError{Failed: 2, Total: 2},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			servers := newTestServers(t)
+
+			servers.nordigen.SetAccount(testAccountID, &nordigentest.Account{
+				Details:  &nordigen.Account{Currency: "EUR"},
+				Balances: []*nordigentest.Balance{{Amount: "100", Currency: "EUR", Type: "expected"}},
+			})
+
+			if tt.prepare != nil {
+				tt.prepare(servers)
+			}
+
+			s := newTestSyncer(t, servers,
+				&accountConfig{NordigenAccountID: testAccountID, LunchmoneyAssetID: servers.asset.ID, Transactions: true},
+				&accountConfig{NordigenAccountID: tt.secondID, LunchmoneyAssetID: servers.asset.ID, Balance: true},
+			)
+
+			err := s.run(context.Background())
+
+			if tt.wantErr == nil {
+				if err != nil {
+					t.Fatalf("expected the sync to succeed, got %v", err)
+				}
+
+				return
+			}
+
+			var syncErr *syncError
+			if !errors.As(err, &syncErr) || *syncErr != *tt.wantErr {
+				t.Fatalf("expected %v, got %v", tt.wantErr, err)
+			}
+
+			if code, want := exitCode(err), tt.wantErr.ExitCode(); code != want {
+				t.Errorf("expected exit code %d, got %d", want, code)
+			}
+		})
+	}
+}
+
+func TestSyncAllLunchmoneyUnauthorized(t *testing.T) {
+	servers := newTestServers(t)
+
+	servers.nordigen.AddBookedTransactions(testAccountID, &nordigentest.Transaction{
+		TransactionID: "trx-1",
+		BookingDate:   "2021-10-01",
+		Amount:        "-12.50",
+		Currency:      "EUR",
+		CreditorName:  "Bakery",
+	})
+
+	s := newTestSyncer(t, servers,
+		&accountConfig{NordigenAccountID: testAccountID, LunchmoneyAssetID: servers.asset.ID, Transactions: true, Balance: true},
+		&accountConfig{NordigenAccountID: testAccountID, LunchmoneyAssetID: servers.asset.ID + 1, Transactions: true, Balance: true},
+	)
+	s.lunchmoneyClient = lunchmoney.NewClient("revoked", servers.lunchmoney.Server.Client(), lunchmoney.WithBaseURL(servers.lunchmoney.URL))
+
+	results := s.syncAll(context.Background())
+
+	if len(results) != 4 {
+		t.Fatalf("expected 4 results, got %d", len(results))
+	}
+
+	for _, result := range results {
+		if !lunchmoney.IsKind(result.Err, lunchmoney.ErrorKindUnauthorized) {
+			t.Errorf("expected the %s sync of asset %d to fail as unauthorized, got %v", result.Kind, result.LunchmoneyAssetID, result.Err)
+		}
+	}
+
+	// the remaining mappings are failed without requests to Lunchmoney
+	if requests := servers.lunchmoney.Requests(); len(requests) != 1 {
+		t.Errorf("expected a single request to Lunchmoney, got %d", len(requests))
+	}
+
+	err := s.run(context.Background())
+
+	if code := exitCode(err); code != exitCodeFailure {
+		t.Errorf("expected exit code %d, got %d for %v", exitCodeFailure, code, err)
+	}
+}
+
+func TestResolveCategories(t *testing.T) {
+	tests := []struct {
+		name           string
+		categories     []*lunchmoney.Category
+		transfers      string
+		wantCategoryID int
+		wantErr        bool
+	}{
+		{
+			name:           "name ignoring the case",
+			categories:     []*lunchmoney.Category{{ID: 1, Name: "Groceries"}, {ID: 2, Name: "Transfers"}},
+			transfers:      "transfers",
+			wantCategoryID: 2,
+		},
+		{
+			name:           "category group",
+			categories:     []*lunchmoney.Category{{ID: 1, Name: "Transfers", IsGroup: true}, {ID: 2, Name: "transfers", GroupID: 1}},
+			transfers:      "Transfers",
+			wantCategoryID: 2,
+		},
+		{
+			name:       "unknown name",
+			categories: []*lunchmoney.Category{{ID: 1, Name: "Groceries"}},
+			transfers:  "Transfers",
+			wantErr:    true,
+		},
+		{
+			name:       "names only differing in case",
+			categories: []*lunchmoney.Category{{ID: 1, Name: "Transfers"}, {ID: 2, Name: "transfers"}},
+			transfers:  "Transfers",
+			wantErr:    true,
+		},
+		{
+			name:       "duplicate names",
+			categories: []*lunchmoney.Category{{ID: 1, Name: "Transfers"}, {ID: 2, Name: "Transfers"}},
+			transfers:  "Transfers",
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			servers := newTestServers(t)
+
+			for _, category := range tt.categories {
+				servers.lunchmoney.AddCategory(category)
+			}
+
+			s := newTestSyncer(t, servers)
+			s.transfersCategory = tt.transfers
+
+			transfers := &transferDetector{}
+
+			err := s.resolveCategories(context.Background(), transfers)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got category %d", transfers.categoryID)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("failed to resolve categories: %v", err)
+			}
+
+			if transfers.categoryID != tt.wantCategoryID {
+				t.Errorf("expected category %d, got %d", tt.wantCategoryID, transfers.categoryID)
+			}
+		})
+	}
+}
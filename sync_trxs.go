@@ -2,81 +2,410 @@ package main
 
 import (
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/Seklfreak/nordigen-lunchmoney-sync/lunchmoney"
 	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/rules"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/state"
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
 )
 
+// insertChunkSize is the maximum number of transactions inserted into Lunchmoney with a single request.
+const insertChunkSize = 50
+
+// syncOverlapDays is the number of days before the last synced booking date that are fetched again,
+// banks sometimes book transactions with a booking date in the past.
+const syncOverlapDays = 7
+
+// syncOptions configures how transactions of an account are synced.
+type syncOptions struct {
+	// StartDate fetches transactions booked on or after this date, ignoring the sync state.
+	StartDate time.Time
+	// EndDate fetches transactions booked on or before this date.
+	EndDate time.Time
+	// LookbackDays caps how many days into the past transactions are fetched.
+	LookbackDays int
+	// Pending inserts pending transactions and replaces them once they are booked.
+	Pending bool
+	// Updates updates synced transactions which have been changed by the bank since.
+	Updates bool
+	// Removed is the action applied to synced transactions which are no longer returned by the bank,
+	// they are not detected if it is empty.
+	Removed string
+	// Rules rewrite transactions before they are inserted.
+	Rules *rules.RuleSet
+}
+
+// transactionsOptions returns the date range to fetch from Nordigen,
+// nil is returned if all available transactions should be fetched.
+func (o *syncOptions) transactionsOptions(lastBookingDate time.Time, now time.Time) *nordigen.TransactionsOptions {
+	var dateFrom time.Time
+
+	switch {
+	case !o.StartDate.IsZero():
+		dateFrom = o.StartDate
+	case !lastBookingDate.IsZero():
+		dateFrom = lastBookingDate.AddDate(0, 0, -syncOverlapDays)
+	}
+
+	if o.LookbackDays > 0 {
+		earliest := now.AddDate(0, 0, -o.LookbackDays)
+		earliest = time.Date(earliest.Year(), earliest.Month(), earliest.Day(), 0, 0, 0, 0, time.UTC)
+
+		if dateFrom.Before(earliest) {
+			dateFrom = earliest
+		}
+	}
+
+	if dateFrom.IsZero() && o.EndDate.IsZero() {
+		return nil
+	}
+
+	// the API rejects ranges starting after their end, e.g. if the end date has been synced already
+	if !o.EndDate.IsZero() && dateFrom.After(o.EndDate) {
+		dateFrom = o.EndDate
+	}
+
+	return &nordigen.TransactionsOptions{
+		DateFrom: dateFrom,
+		DateTo:   o.EndDate,
+	}
+}
+
+// stateKey returns the key for the sync state of an account mapping.
+func stateKey(nordigenAccountID string, lunchmoneyAssetID int) string {
+	return fmt.Sprintf("%s:%d", nordigenAccountID, lunchmoneyAssetID)
+}
+
 func syncAccount(
 	ctx context.Context,
 	nordigenAccountID string,
 	lunchmoneyAssetID int,
-	nordigenClient *nordigen.Client,
-	lunchmoneyClient *lunchmoney.Client,
+	nordigenClient nordigenAPI,
+	lunchmoneyClient lunchmoneyAPI,
+	store state.Store,
+	opts *syncOptions,
+	transfers *transferDetector,
+	quota *quotaGuard,
 	log *zap.Logger,
 ) error {
-	// fetch account details from Nordigen
-	account, err := nordigenClient.GetAccountDetails(ctx, nordigenAccountID)
+	// load sync state
+	key := stateKey(nordigenAccountID, lunchmoneyAssetID)
+
+	accountState, err := store.Load(ctx, key)
+	if err != nil {
+		return errors.Wrap(err, "failed to load sync state")
+	}
+
+	saveState := func() error {
+		return errors.Wrap(store.Save(ctx, key, accountState), "failed to save sync state")
+	}
+
+	// do not waste a request if there are none left
+	err = quota.check(accountState, nordigen.EndpointTransactions, time.Now())
 	if err != nil {
-		return errors.Wrap(err, "failed to fetch account details from Nordigen")
+		return err
+	}
+
+	// only fetch the new window if the account has been synced before
+	trxOpts := opts.transactionsOptions(accountState.LastBookingDate, time.Now())
+
+	// fetch account details from Nordigen unless they have been fetched for detecting transfers already
+	account := transfers.accountDetails(nordigenAccountID)
+	if account == nil {
+		account, err = fetchAccountDetails(ctx, nordigenAccountID, nordigenClient, accountState, saveState, quota, log)
+		if err != nil {
+			return err
+		}
 	}
 
 	// fetch transactions from Nordigen
-	transactions, err := nordigenClient.Transactions(ctx, nordigenAccountID)
+	transactions, err := nordigenClient.Transactions(ctx, nordigenAccountID, trxOpts)
+
+	// remember the rate limit so the next runs do not request the transactions before it resets
+	rateLimit := nordigenClient.RateLimit(nordigenAccountID, nordigen.EndpointTransactions)
+	if quota.record(accountState, nordigen.EndpointTransactions, rateLimit, time.Now()) {
+		if saveErr := saveState(); saveErr != nil {
+			log.Warn("failed to save rate limit", zap.Error(saveErr))
+		}
+	}
+
 	if err != nil {
 		return errors.Wrap(err, "failed to fetch transactions from Nordigen")
 	}
 
-	log.Info("fetched transactions from Nordigen", zap.Int("total", len(transactions.Booked)))
+	if trxOpts != nil {
+		log.Info("fetched transactions from Nordigen",
+			zap.Int("total", len(transactions.Booked)),
+			zap.Time("date_from", trxOpts.DateFrom),
+			zap.Time("date_to", trxOpts.DateTo),
+		)
+	} else {
+		log.Info("fetched transactions from Nordigen", zap.Int("total", len(transactions.Booked)))
+	}
 
 	// prepare transactions to insert
 	lunchmoneyTransactions := make([]*lunchmoney.Transaction, 0, len(transactions.Booked))
+	bookingDates := make(map[string]time.Time, len(transactions.Booked))
+	transferHalves := make(map[string]*state.Transfer)
+	synced := make([]*lunchmoney.Transaction, 0)
 
 	for _, trx := range transactions.Booked {
-		lmTrx, err := createLunchmoneyTrx(trx, account, lunchmoneyAssetID)
+		lmTrx, err := createLunchmoneyTrx(trx, account, lunchmoneyAssetID, opts.Rules)
 		if err != nil {
 			return errors.Wrapf(err, "failed to create Lunchmoney transaction for Nordigen transaction %s", trx.TransactionID)
 		}
 
-		if lmTrx != nil {
-			lunchmoneyTransactions = append(lunchmoneyTransactions, lmTrx)
+		if lmTrx == nil {
+			continue
 		}
-	}
 
-	for _, trx := range lunchmoneyTransactions {
-		log.Debug("prepared transaction", zap.Any("transaction", trx))
-	}
+		counterparty := transfers.detect(trx, nordigenAccountID)
+		if counterparty != nil {
+			transfers.apply(lmTrx, nordigenAccountID, counterparty)
+		}
+
+		if accountState.Synced(lmTrx.ExternalID) {
+			synced = append(synced, lmTrx)
+			continue
+		}
+
+		if counterparty != nil && transfers.group {
+			transferHalves[lmTrx.ExternalID] = &state.Transfer{
+				Date:         time.Time(lmTrx.Date),
+				Amount:       lmTrx.Amount,
+				Currency:     lmTrx.Currency,
+				Payee:        lmTrx.Payee,
+				Counterparty: counterparty.config.NordigenAccountID,
+			}
+		}
 
-	// split all into chunks
-	chunkSize := 50
-	chunks := make([][]*lunchmoney.Transaction, 0, chunkSize)
+		lunchmoneyTransactions = append(lunchmoneyTransactions, lmTrx)
+		bookingDates[lmTrx.ExternalID] = bookingDate(trx)
+	}
 
-	for i := 0; i < len(lunchmoneyTransactions); i += chunkSize {
-		end := i + chunkSize
+	// replace pending transactions that have been booked since they were inserted
+	var replacedPending map[string]bool
 
-		if end > len(lunchmoneyTransactions) {
-			end = len(lunchmoneyTransactions)
+	if opts.Pending {
+		lunchmoneyTransactions, replacedPending, err = replacePendingTransactions(
+			ctx,
+			lunchmoneyTransactions,
+			bookingDates,
+			transferHalves,
+			accountState,
+			lunchmoneyClient,
+			saveState,
+			log,
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed to replace pending transactions")
 		}
+	}
+
+	log.Info("prepared new transactions", zap.Int("total", len(lunchmoneyTransactions)))
 
-		chunks = append(chunks, lunchmoneyTransactions[i:end])
+	for _, trx := range lunchmoneyTransactions {
+		log.Debug("prepared transaction", zap.Any("transaction", trx))
 	}
 
 	// insert transactions
-	for _, chunk := range chunks {
-		inserted, err := lunchmoneyClient.InsertTransactions(ctx, chunk)
+	for _, chunk := range chunkTransactions(lunchmoneyTransactions, insertChunkSize) {
+		ids, err := insertTransactions(ctx, chunk, lunchmoneyClient, log)
 		if err != nil {
 			return errors.Wrapf(err, "failed to insert transactions")
 		}
 
 		log.Info("inserted transactions",
-			zap.Int("inserted_count", inserted),
+			zap.Int("inserted_count", len(ids)),
 			zap.Int("chunk_size", len(chunk)),
 			zap.String("nordigen_account_id", nordigenAccountID),
 			zap.Int("lunchmoney_asset_id", lunchmoneyAssetID),
 		)
+
+		// persist progress after every chunk so an interrupted run does not insert them again
+		for i, trx := range chunk {
+			accountState.MarkSynced(trx.ExternalID, bookingDates[trx.ExternalID])
+			accountState.SetValues(trx.ExternalID, transactionValues(trx))
+
+			// IDs can only be assigned if all transactions have been inserted, dry runs return negative placeholder IDs
+			if transfer := transferHalves[trx.ExternalID]; transfer != nil && len(ids) == len(chunk) && ids[i] != 0 {
+				transfer.LunchmoneyID = ids[i]
+				accountState.AddTransfer(trx.ExternalID, transfer)
+			}
+		}
+
+		err = saveState()
+		if err != nil {
+			return err
+		}
+	}
+
+	// apply changes of the bank to transactions synced before
+	if opts.Updates {
+		err = updateSyncedTransactions(
+			ctx,
+			synced,
+			lunchmoneyAssetID,
+			accountState,
+			lunchmoneyClient,
+			saveState,
+			log,
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed to update synced transactions")
+		}
+	}
+
+	// handle transactions which are no longer returned by the bank
+	if opts.Removed != "" {
+		err = syncRemovedTransactions(
+			ctx,
+			transactions.Booked,
+			trxOpts,
+			lunchmoneyAssetID,
+			accountState,
+			lunchmoneyClient,
+			opts.Removed,
+			saveState,
+			log,
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed to handle removed transactions")
+		}
+	}
+
+	// insert pending transactions which are not known yet and remove stale ones
+	if opts.Pending {
+		err = syncPendingTransactions(
+			ctx,
+			transactions.Pending,
+			account,
+			lunchmoneyAssetID,
+			accountState,
+			lunchmoneyClient,
+			opts,
+			replacedPending,
+			saveState,
+			log,
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed to sync pending transactions")
+		}
+	}
+
+	// forget transactions which will not be fetched again
+	if trxOpts != nil && !trxOpts.DateFrom.IsZero() {
+		accountState.Prune(trxOpts.DateFrom)
+
+		err = saveState()
+		if err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
+
+// fetchAccountDetails fetches the details of an account from Nordigen unless the rate limit of the endpoint
+// has been reached, the rate limit reported by Nordigen is saved in the state of the account.
+// Cached details do not reach Nordigen and are returned regardless of the rate limit.
+func fetchAccountDetails(
+	ctx context.Context,
+	nordigenAccountID string,
+	nordigenClient nordigenAPI,
+	accountState *state.Account,
+	saveState func() error,
+	quota *quotaGuard,
+	log *zap.Logger,
+) (*nordigen.Account, error) {
+	if cachedResponse(nordigenClient, nordigenAccountID, nordigen.EndpointDetails) {
+		account, err := nordigenClient.GetAccountDetails(ctx, nordigenAccountID)
+
+		return account, errors.Wrap(err, "failed to fetch account details from Nordigen")
+	}
+
+	err := quota.check(accountState, nordigen.EndpointDetails, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	account, err := nordigenClient.GetAccountDetails(ctx, nordigenAccountID)
+
+	rateLimit := nordigenClient.RateLimit(nordigenAccountID, nordigen.EndpointDetails)
+	if quota.record(accountState, nordigen.EndpointDetails, rateLimit, time.Now()) {
+		if saveErr := saveState(); saveErr != nil {
+			log.Warn("failed to save rate limit", zap.Error(saveErr))
+		}
+	}
+
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to fetch account details from Nordigen")
+	}
+
+	return account, nil
+}
+
+// insertTransactions inserts a chunk of transactions into Lunchmoney.
+// If some of them exist already, e.g. because the sync state has been lost, the chunk is inserted
+// one by one skipping the duplicates. The IDs of skipped duplicates are zero in this case.
+func insertTransactions(
+	ctx context.Context,
+	chunk []*lunchmoney.Transaction,
+	lunchmoneyClient lunchmoneyAPI,
+	log *zap.Logger,
+) ([]int, error) {
+	ids, err := lunchmoneyClient.InsertTransactions(ctx, chunk)
+	if !lunchmoney.IsKind(err, lunchmoney.ErrorKindDuplicate) || len(chunk) == 1 {
+		return ids, err
+	}
+
+	ids = make([]int, len(chunk))
+
+	for i, trx := range chunk {
+		inserted, err := lunchmoneyClient.InsertTransactions(ctx, []*lunchmoney.Transaction{trx})
+		if lunchmoney.IsKind(err, lunchmoney.ErrorKindDuplicate) {
+			log.Warn("skipped transaction existing in Lunchmoney already", zap.String("external_id", trx.ExternalID))
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		if len(inserted) == 1 {
+			ids[i] = inserted[0]
+		}
+	}
+
+	return ids, nil
+}
+
+// bookingDate returns the booking date of a transaction, falling back to the value date.
+func bookingDate(trx nordigen.Transaction) time.Time {
+	if !time.Time(trx.BookingDate).IsZero() {
+		return time.Time(trx.BookingDate)
+	}
+
+	return time.Time(trx.ValueDate)
+}
+
+// chunkTransactions splits transactions into chunks of the given size.
+func chunkTransactions(transactions []*lunchmoney.Transaction, size int) [][]*lunchmoney.Transaction {
+	chunks := make([][]*lunchmoney.Transaction, 0, len(transactions)/size+1)
+
+	for i := 0; i < len(transactions); i += size {
+		end := i + size
+
+		if end > len(transactions) {
+			end = len(transactions)
+		}
+
+		chunks = append(chunks, transactions[i:end])
+	}
+
+	return chunks
+}
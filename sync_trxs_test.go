@@ -0,0 +1,431 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen/nordigentest"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/state"
+	"github.com/pkg/errors"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestSyncAccount(t *testing.T) {
+	ctx := context.Background()
+	servers := newTestServers(t)
+	store := state.NewMemoryStore()
+
+	servers.nordigen.AddBookedTransactions(testAccountID,
+		&nordigentest.Transaction{
+			TransactionID:         "trx-1",
+			BookingDate:           "2021-10-01",
+			ValueDate:             "2021-10-01",
+			Amount:                "-12.50",
+			Currency:              "EUR",
+			CreditorName:          "Bakery",
+			RemittanceInformation: "Breakfast",
+		},
+		&nordigentest.Transaction{
+			TransactionID: "trx-2",
+			BookingDate:   "2021-10-02",
+			Amount:        "-20.00",
+			Currency:      "EUR",
+			CreditorName:  "Bookshop",
+			CurrencyExchange: []*nordigen.CurrencyExchange{
+				{SourceCurrency: "GBP", TargetCurrency: "EUR", ExchangeRate: "1.17"},
+			},
+			CurrencyExchangeObject: true,
+		},
+		&nordigentest.Transaction{
+			TransactionID: "trx-3",
+			BookingDate:   "2021-10-03",
+			Amount:        "1000",
+			Currency:      "EUR",
+			DebtorName:    "Employer",
+			CurrencyExchange: []*nordigen.CurrencyExchange{
+				{SourceCurrency: "EUR", TargetCurrency: "EUR", ExchangeRate: "1"},
+			},
+		},
+		&nordigentest.Transaction{
+			TransactionID: "trx-4",
+			BookingDate:   "2021-10-03",
+			Amount:        "0",
+			Currency:      "EUR",
+			CreditorName:  "Card Check",
+		},
+	)
+
+	sync := func() {
+		t.Helper()
+
+		err := syncAccount(ctx, testAccountID, servers.asset.ID, servers.nordigenClient, servers.lunchmoneyClient, store, &syncOptions{}, nil, nil, zaptest.NewLogger(t))
+		if err != nil {
+			t.Fatalf("failed to sync account: %v", err)
+		}
+	}
+
+	sync()
+
+	transactions := servers.lunchmoney.Transactions()
+	if len(transactions) != 3 {
+		t.Fatalf("expected 3 inserted transactions, got %d", len(transactions))
+	}
+
+	expected := []struct {
+		payee, amount, date, externalID, notes string
+	}{
+		{"Bakery", "-12.50", "2021-10-01", "trx-1", "Breakfast"},
+		{"Bookshop", "-20.00", "2021-10-02", "trx-2", ""},
+		{"Employer", "1000.00", "2021-10-03", "trx-3", ""},
+	}
+
+	for i, trx := range transactions {
+		if trx.Payee != expected[i].payee ||
+			trx.Amount.String() != expected[i].amount ||
+			trx.Date != expected[i].date ||
+			trx.ExternalID != expected[i].externalID ||
+			trx.Notes != expected[i].notes {
+			t.Errorf("unexpected transaction %d: %+v", i, trx)
+		}
+
+		if trx.AssetID != servers.asset.ID || trx.Currency != "eur" || trx.Status != "uncleared" {
+			t.Errorf("unexpected asset, currency or status of transaction %d: %+v", i, trx)
+		}
+	}
+
+	// the second run only fetches recent transactions and skips the synced ones
+	servers.nordigen.AddBookedTransactions(testAccountID, &nordigentest.Transaction{
+		TransactionID: "trx-5",
+		BookingDate:   "2021-10-04",
+		Amount:        "-5",
+		Currency:      "EUR",
+		CreditorName:  "Kiosk",
+	})
+
+	sync()
+
+	transactions = servers.lunchmoney.Transactions()
+	if len(transactions) != 4 || transactions[3].ExternalID != "trx-5" {
+		t.Fatalf("expected only the new transaction to be inserted, got %+v", transactions)
+	}
+
+	requests := servers.nordigen.Requests()
+	lastRequest := requests[len(requests)-1]
+
+	if dateFrom := lastRequest.Query.Get("date_from"); dateFrom != "2021-09-26" {
+		t.Errorf("expected transactions to be fetched from 2021-09-26, got %q", dateFrom)
+	}
+}
+
+func TestTransactionsOptions(t *testing.T) {
+	date := func(value string) time.Time {
+		d, err := time.Parse("2006-01-02", value)
+		if err != nil {
+			t.Fatalf("failed to parse date: %v", err)
+		}
+
+		return d
+	}
+
+	now := time.Date(2021, 10, 15, 18, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name            string
+		opts            syncOptions
+		lastBookingDate string
+		wantFrom        string
+		wantTo          string
+		wantNil         bool
+	}{
+		{
+			name:    "empty state",
+			wantNil: true,
+		},
+		{
+			name:            "synced before",
+			lastBookingDate: "2021-10-10",
+			wantFrom:        "2021-10-03",
+		},
+		{
+			name:            "start date ignores the state",
+			opts:            syncOptions{StartDate: date("2021-09-01")},
+			lastBookingDate: "2021-10-10",
+			wantFrom:        "2021-09-01",
+		},
+		{
+			name:     "start and end date",
+			opts:     syncOptions{StartDate: date("2021-09-01"), EndDate: date("2021-09-30")},
+			wantFrom: "2021-09-01",
+			wantTo:   "2021-09-30",
+		},
+		{
+			name:   "end date with empty state",
+			opts:   syncOptions{EndDate: date("2021-09-30")},
+			wantTo: "2021-09-30",
+		},
+		{
+			name:     "lookback with empty state",
+			opts:     syncOptions{LookbackDays: 30},
+			wantFrom: "2021-09-15",
+		},
+		{
+			name:            "lookback caps the state",
+			opts:            syncOptions{LookbackDays: 30},
+			lastBookingDate: "2021-08-01",
+			wantFrom:        "2021-09-15",
+		},
+		{
+			name:            "lookback does not extend the state",
+			opts:            syncOptions{LookbackDays: 30},
+			lastBookingDate: "2021-10-10",
+			wantFrom:        "2021-10-03",
+		},
+		{
+			name:     "lookback caps the start date",
+			opts:     syncOptions{StartDate: date("2021-01-01"), LookbackDays: 30},
+			wantFrom: "2021-09-15",
+		},
+		{
+			name:     "start date after end date",
+			opts:     syncOptions{StartDate: date("2021-10-01"), EndDate: date("2021-09-30")},
+			wantFrom: "2021-09-30",
+			wantTo:   "2021-09-30",
+		},
+		{
+			name:            "end date synced already",
+			opts:            syncOptions{EndDate: date("2021-09-30")},
+			lastBookingDate: "2021-10-10",
+			wantFrom:        "2021-09-30",
+			wantTo:          "2021-09-30",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var lastBookingDate time.Time
+			if tt.lastBookingDate != "" {
+				lastBookingDate = date(tt.lastBookingDate)
+			}
+
+			trxOpts := tt.opts.transactionsOptions(lastBookingDate, now)
+			if tt.wantNil {
+				if trxOpts != nil {
+					t.Errorf("expected all transactions to be fetched, got %+v", trxOpts)
+				}
+
+				return
+			}
+
+			if trxOpts == nil {
+				t.Fatal("expected a date range")
+			}
+
+			if from := formatDate(trxOpts.DateFrom); from != tt.wantFrom {
+				t.Errorf("expected date from %q, got %q", tt.wantFrom, from)
+			}
+
+			if to := formatDate(trxOpts.DateTo); to != tt.wantTo {
+				t.Errorf("expected date to %q, got %q", tt.wantTo, to)
+			}
+		})
+	}
+}
+
+func formatDate(date time.Time) string {
+	if date.IsZero() {
+		return ""
+	}
+
+	return date.Format("2006-01-02")
+}
+
+func TestSyncAccountRenewsExpiredTokens(t *testing.T) {
+	ctx := context.Background()
+	servers := newTestServers(t)
+
+	servers.nordigen.AddBookedTransactions(testAccountID, &nordigentest.Transaction{
+		TransactionID: "trx-1",
+		BookingDate:   "2021-10-01",
+		Amount:        "-12.50",
+		Currency:      "EUR",
+		CreditorName:  "Bakery",
+	})
+
+	servers.nordigen.ExpireAccessTokens()
+	servers.nordigen.ExpireRefreshTokens()
+
+	err := syncAccount(ctx, testAccountID, servers.asset.ID, servers.nordigenClient, servers.lunchmoneyClient, state.NewMemoryStore(), &syncOptions{}, nil, nil, zaptest.NewLogger(t))
+	if err != nil {
+		t.Fatalf("failed to sync account: %v", err)
+	}
+
+	if transactions := servers.lunchmoney.Transactions(); len(transactions) != 1 {
+		t.Fatalf("expected 1 inserted transaction, got %d", len(transactions))
+	}
+}
+
+func TestSyncAccountFailures(t *testing.T) {
+	ctx := context.Background()
+	servers := newTestServers(t)
+	store := state.NewMemoryStore()
+
+	servers.nordigen.AddBookedTransactions(testAccountID, &nordigentest.Transaction{
+		TransactionID: "trx-1",
+		BookingDate:   "2021-10-01",
+		Amount:        "-12.50",
+		Currency:      "EUR",
+		CreditorName:  "Bakery",
+	})
+
+	sync := func() error {
+		return syncAccount(ctx, testAccountID, servers.asset.ID, servers.nordigenClient, servers.lunchmoneyClient, store, &syncOptions{}, nil, nil, zaptest.NewLogger(t))
+	}
+
+	// Nordigen is unavailable
+	servers.nordigen.Fail("/accounts/"+testAccountID+"/transactions/", http.StatusServiceUnavailable, 1)
+
+	err := sync()
+	if err == nil {
+		t.Fatal("expected an error if Nordigen is unavailable")
+	}
+
+	// inserting fails in Lunchmoney, the transaction must not be marked as synced
+	servers.lunchmoney.Fail("/v1/transactions", http.StatusInternalServerError, 1)
+
+	err = sync()
+	if err == nil {
+		t.Fatal("expected an error if inserting fails")
+	}
+
+	accountState, err := store.Load(ctx, stateKey(testAccountID, servers.asset.ID))
+	if err != nil {
+		t.Fatalf("failed to load state: %v", err)
+	}
+
+	if accountState.Synced("trx-1") {
+		t.Fatal("expected the transaction not to be marked as synced")
+	}
+
+	err = sync()
+	if err != nil {
+		t.Fatalf("failed to sync account: %v", err)
+	}
+
+	if transactions := servers.lunchmoney.Transactions(); len(transactions) != 1 {
+		t.Fatalf("expected 1 inserted transaction, got %d", len(transactions))
+	}
+}
+
+func TestSyncAccountRateLimited(t *testing.T) {
+	ctx := context.Background()
+	servers := newTestServers(t)
+	store := state.NewMemoryStore()
+	quota := &quotaGuard{}
+
+	servers.nordigen.SetQuota(testAccountID, nordigen.EndpointTransactions, 1, time.Hour)
+
+	sync := func() error {
+		return syncAccount(ctx, testAccountID, servers.asset.ID, servers.nordigenClient, servers.lunchmoneyClient, store, &syncOptions{}, nil, quota, zaptest.NewLogger(t))
+	}
+
+	countRequests := func() int {
+		var count int
+
+		for _, request := range servers.nordigen.Requests() {
+			if strings.HasSuffix(request.Path, "/transactions/") {
+				count++
+			}
+		}
+
+		return count
+	}
+
+	err := sync()
+	if err != nil {
+		t.Fatalf("failed to sync account: %v", err)
+	}
+
+	// the remaining quota is known, the transactions are not requested again
+	err = sync()
+
+	retryAt, ok := rateLimited(err)
+	if !ok {
+		t.Fatalf("expected the sync to be skipped, got %v", err)
+	}
+
+	if retryAt.Before(time.Now().Add(59 * time.Minute)) {
+		t.Errorf("expected to retry once the limit resets, got %s", retryAt)
+	}
+
+	if count := countRequests(); count != 1 {
+		t.Errorf("expected 1 transactions request, got %d", count)
+	}
+
+	// without the persisted quota the API rejects the request
+	store = state.NewMemoryStore()
+
+	err = sync()
+
+	var rateLimitErr *nordigen.RateLimitError
+	if !errors.As(err, &rateLimitErr) {
+		t.Fatalf("expected a rate limit error, got %v", err)
+	}
+
+	if _, ok := rateLimited(err); !ok {
+		t.Errorf("expected the sync to be skipped, got %v", err)
+	}
+
+	accountState, err := store.Load(ctx, stateKey(testAccountID, servers.asset.ID))
+	if err != nil {
+		t.Fatalf("failed to load state: %v", err)
+	}
+
+	if rateLimit := accountState.RateLimits[nordigen.EndpointTransactions]; rateLimit == nil || rateLimit.Remaining != 0 {
+		t.Fatalf("expected the exhausted rate limit to be saved, got %+v", rateLimit)
+	}
+}
+
+func TestSyncAccountSkipsDuplicates(t *testing.T) {
+	ctx := context.Background()
+	servers := newTestServers(t)
+	servers.lunchmoney.RejectDuplicates = true
+
+	sync := func(store state.Store) {
+		t.Helper()
+
+		err := syncAccount(ctx, testAccountID, servers.asset.ID, servers.nordigenClient, servers.lunchmoneyClient, store, &syncOptions{}, nil, nil, zaptest.NewLogger(t))
+		if err != nil {
+			t.Fatalf("failed to sync account: %v", err)
+		}
+	}
+
+	servers.nordigen.AddBookedTransactions(testAccountID, &nordigentest.Transaction{
+		TransactionID: "trx-1",
+		BookingDate:   "2021-10-01",
+		Amount:        "-12.50",
+		Currency:      "EUR",
+		CreditorName:  "Bakery",
+	})
+
+	sync(state.NewMemoryStore())
+
+	// without the sync state the first transaction is inserted again and rejected as a duplicate
+	servers.nordigen.AddBookedTransactions(testAccountID, &nordigentest.Transaction{
+		TransactionID: "trx-2",
+		BookingDate:   "2021-10-02",
+		Amount:        "-20.00",
+		Currency:      "EUR",
+		CreditorName:  "Bookshop",
+	})
+
+	sync(state.NewMemoryStore())
+
+	transactions := servers.lunchmoney.Transactions()
+	if len(transactions) != 2 || transactions[0].ExternalID != "trx-1" || transactions[1].ExternalID != "trx-2" {
+		t.Fatalf("expected the new transaction to be inserted once, got %+v", transactions)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/lunchmoney"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/state"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// transactionValues returns the values of a transaction which are kept up to date with the bank.
+func transactionValues(trx *lunchmoney.Transaction) *state.TransactionValues {
+	return &state.TransactionValues{
+		Date:   time.Time(trx.Date),
+		Payee:  trx.Payee,
+		Notes:  trx.Notes,
+		Amount: trx.Amount,
+	}
+}
+
+// updateSyncedTransactions updates transactions synced in earlier runs which have been changed by the bank since.
+// Only values which have not been edited in Lunchmoney are updated, i.e. values which still match the values
+// written by the last sync. Transactions synced by older versions without recorded values are not updated,
+// their current values are recorded to detect later changes.
+func updateSyncedTransactions(
+	ctx context.Context,
+	synced []*lunchmoney.Transaction,
+	lunchmoneyAssetID int,
+	accountState *state.Account,
+	lunchmoneyClient lunchmoneyAPI,
+	saveState func() error,
+	log *zap.Logger,
+) error {
+	candidates := make(map[string]*lunchmoney.Transaction, len(synced))
+
+	var startDate, endDate time.Time
+
+	for _, trx := range synced {
+		syncedTrx := accountState.Transactions[trx.ExternalID]
+		if syncedTrx == nil {
+			continue
+		}
+
+		if syncedTrx.Values == nil {
+			accountState.SetValues(trx.ExternalID, transactionValues(trx))
+			continue
+		}
+
+		if !valuesChanged(syncedTrx.Values, trx) {
+			continue
+		}
+
+		candidates[trx.ExternalID] = trx
+
+		// the transaction is searched by the old and the new date, it may have been moved in Lunchmoney as well
+		for _, date := range []time.Time{time.Time(trx.Date), syncedTrx.Values.Date} {
+			if startDate.IsZero() || date.Before(startDate) {
+				startDate = date
+			}
+
+			if date.After(endDate) {
+				endDate = date
+			}
+		}
+	}
+
+	if len(candidates) == 0 {
+		return saveState()
+	}
+
+	existing, err := lunchmoneyClient.GetAllTransactions(ctx, &lunchmoney.TransactionFilter{
+		AssetID:   lunchmoneyAssetID,
+		StartDate: startDate.AddDate(0, 0, -syncOverlapDays),
+		EndDate:   endDate.AddDate(0, 0, syncOverlapDays),
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to fetch transactions from Lunchmoney")
+	}
+
+	var updated int
+
+	for _, current := range existing {
+		trx := candidates[current.ExternalID]
+		if trx == nil {
+			continue
+		}
+
+		delete(candidates, current.ExternalID)
+
+		values := accountState.Transactions[trx.ExternalID].Values
+
+		// the changes are recorded even if they are not applied, the transaction is not fetched again
+		// unless the bank changes it again
+		update, fields := mergeBankChanges(current, values, trx)
+		accountState.SetValues(trx.ExternalID, bankValues(values, trx))
+
+		if len(fields) == 0 {
+			log.Debug("skipped changed transaction edited in Lunchmoney",
+				zap.Int("lunchmoney_transaction_id", current.ID),
+				zap.String("external_id", trx.ExternalID),
+			)
+
+			continue
+		}
+
+		err = lunchmoneyClient.UpdateTransaction(ctx, current.ID, update)
+		if err != nil {
+			return errors.Wrapf(err, "failed to update Lunchmoney transaction %d", current.ID)
+		}
+
+		updated++
+
+		err = saveState()
+		if err != nil {
+			return err
+		}
+
+		log.Info("updated transaction changed by the bank",
+			zap.Int("lunchmoney_transaction_id", current.ID),
+			zap.String("external_id", trx.ExternalID),
+			zap.Strings("fields", fields),
+		)
+	}
+
+	// transactions which have been deleted or split in Lunchmoney cannot be updated
+	for externalID, trx := range candidates {
+		accountState.SetValues(externalID, bankValues(accountState.Transactions[externalID].Values, trx))
+
+		log.Debug("changed transaction not found in Lunchmoney", zap.String("external_id", externalID))
+	}
+
+	log.Info("updated synced transactions", zap.Int("updated_count", updated))
+
+	return saveState()
+}
+
+// valuesChanged returns true if the transaction differs from the values written by the last sync.
+func valuesChanged(values *state.TransactionValues, trx *lunchmoney.Transaction) bool {
+	return !sameDay(values.Date, time.Time(trx.Date)) ||
+		values.Payee != trx.Payee ||
+		(values.Notes != trx.Notes && trx.Notes != "") ||
+		!values.Amount.Equal(trx.Amount)
+}
+
+// bankValues returns the values of the transaction to compare the next changes of the bank to.
+func bankValues(values *state.TransactionValues, trx *lunchmoney.Transaction) *state.TransactionValues {
+	newValues := transactionValues(trx)
+
+	// notes cannot be removed, so removed notes are not considered a change
+	if trx.Notes == "" {
+		newValues.Notes = values.Notes
+	}
+
+	return newValues
+}
+
+// mergeBankChanges returns the update applying the changes of the bank to the transaction in Lunchmoney
+// and the names of the updated fields. Fields edited in Lunchmoney are kept.
+func mergeBankChanges(
+	current *lunchmoney.StoredTransaction,
+	values *state.TransactionValues,
+	trx *lunchmoney.Transaction,
+) (*lunchmoney.Transaction, []string) {
+	// date and amount are always sent, the values in Lunchmoney are kept unless they are updated
+	update := &lunchmoney.Transaction{
+		Date:   current.Date,
+		Amount: current.Amount,
+	}
+
+	var fields []string
+
+	if !sameDay(values.Date, time.Time(trx.Date)) && sameDay(values.Date, time.Time(current.Date)) {
+		update.Date = trx.Date
+		fields = append(fields, "date")
+	}
+
+	if values.Payee != trx.Payee && values.Payee == current.Payee {
+		update.Payee = trx.Payee
+		fields = append(fields, "payee")
+	}
+
+	if values.Notes != trx.Notes && trx.Notes != "" && values.Notes == current.Notes {
+		update.Notes = trx.Notes
+		fields = append(fields, "notes")
+	}
+
+	if !values.Amount.Equal(trx.Amount) && values.Amount.Equal(current.Amount) {
+		update.Amount = trx.Amount
+		fields = append(fields, "amount")
+	}
+
+	return update, fields
+}
+
+// sameDay returns true if both times are on the same date.
+func sameDay(a, b time.Time) bool {
+	return a.Format("2006-01-02") == b.Format("2006-01-02")
+}
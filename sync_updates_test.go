@@ -0,0 +1,106 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/lunchmoney"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/money"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen/nordigentest"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/state"
+	"go.uber.org/zap/zaptest"
+)
+
+func TestSyncAccountUpdates(t *testing.T) {
+	ctx := context.Background()
+	servers := newTestServers(t)
+	store := state.NewMemoryStore()
+
+	sync := func() {
+		t.Helper()
+
+		err := syncAccount(ctx, testAccountID, servers.asset.ID, servers.nordigenClient, servers.lunchmoneyClient, store, &syncOptions{Updates: true}, nil, nil, zaptest.NewLogger(t))
+		if err != nil {
+			t.Fatalf("failed to sync account: %v", err)
+		}
+	}
+
+	servers.nordigen.AddBookedTransactions(testAccountID,
+		&nordigentest.Transaction{
+			TransactionID: "trx-1",
+			BookingDate:   "2021-10-01",
+			Amount:        "-12.50",
+			Currency:      "EUR",
+			CreditorName:  "CARD 1234",
+		},
+		&nordigentest.Transaction{
+			TransactionID: "trx-2",
+			BookingDate:   "2021-10-02",
+			Amount:        "-20.00",
+			Currency:      "EUR",
+			CreditorName:  "CARD 5678",
+		},
+	)
+
+	sync()
+
+	transactions := servers.lunchmoney.Transactions()
+	if len(transactions) != 2 {
+		t.Fatalf("expected 2 inserted transactions, got %d", len(transactions))
+	}
+
+	// the payee of the second transaction is edited by hand
+	err := servers.lunchmoneyClient.UpdateTransaction(ctx, transactions[1].ID, &lunchmoney.Transaction{
+		Date:   lunchmoney.TransactionDate(time.Date(2021, 10, 2, 0, 0, 0, 0, time.UTC)),
+		Amount: money.MustParse("-20.00"),
+		Payee:  "Bookshop",
+	})
+	if err != nil {
+		t.Fatalf("failed to edit transaction: %v", err)
+	}
+
+	// the bank adds the payees and remittance information later
+	servers.nordigen.SetBookedTransactions(testAccountID,
+		&nordigentest.Transaction{
+			TransactionID:         "trx-1",
+			BookingDate:           "2021-10-01",
+			Amount:                "-12.50",
+			Currency:              "EUR",
+			CreditorName:          "Bakery",
+			RemittanceInformation: "Breakfast",
+		},
+		&nordigentest.Transaction{
+			TransactionID:         "trx-2",
+			BookingDate:           "2021-10-02",
+			Amount:                "-20.00",
+			Currency:              "EUR",
+			CreditorName:          "Book Store Ltd",
+			RemittanceInformation: "Invoice 42",
+		},
+	)
+
+	sync()
+
+	transactions = servers.lunchmoney.Transactions()
+	if len(transactions) != 2 {
+		t.Fatalf("expected no new transactions, got %+v", transactions)
+	}
+
+	if trx := transactions[0]; trx.Payee != "Bakery" || trx.Notes != "Breakfast" || trx.ExternalID != "trx-1" || trx.AssetID != servers.asset.ID {
+		t.Errorf("expected the payee and notes to be updated, got %+v", trx)
+	}
+
+	if trx := transactions[1]; trx.Payee != "Bookshop" || trx.Notes != "Invoice 42" {
+		t.Errorf("expected only the notes to be updated, got %+v", trx)
+	}
+
+	// unchanged transactions are not fetched from Lunchmoney again
+	requests := len(servers.lunchmoney.Requests())
+
+	sync()
+
+	for _, request := range servers.lunchmoney.Requests()[requests:] {
+		t.Errorf("unexpected request to Lunchmoney: %s %s", request.Method, request.Path)
+	}
+}
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/lunchmoney"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/state"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+const (
+	// defaultTransfersTag is the tag added to transfers between synced accounts.
+	defaultTransfersTag = "transfer"
+	// transferMatchDays is the maximum number of days between both halves of a transfer.
+	transferMatchDays = 5
+	// transferExpiryDays is the number of days after which halves of a transfer
+	// without a counterpart are no longer linked.
+	transferExpiryDays = 14
+)
+
+// transferAccount is an account taking part in transfer detection.
+type transferAccount struct {
+	config  *accountConfig
+	details *nordigen.Account
+}
+
+// name returns the name of the account used in the payee of transfers.
+func (a *transferAccount) name() string {
+	switch {
+	case a.config.Name != "":
+		return a.config.Name
+	case a.details.Name != "":
+		return a.details.Name
+	case a.details.Product != "":
+		return a.details.Product
+	case a.details.IBAN != "":
+		return a.details.IBAN
+	}
+
+	return a.config.NordigenAccountID
+}
+
+// transferDetector recognises transfers between the synced accounts by the IBAN of the counterparty.
+type transferDetector struct {
+	tag        string
+	categoryID int
+	group      bool
+
+	accounts []*transferAccount
+	byID     map[string]*transferAccount
+	byIBAN   map[string]*transferAccount
+}
+
+// newTransferDetector fetches the details of all accounts syncing transactions within their rate limits.
+// Accounts whose details cannot be fetched do not take part in transfer detection.
+func newTransferDetector(
+	ctx context.Context,
+	accounts []*accountConfig,
+	nordigenClient nordigenAPI,
+	store state.Store,
+	quota *quotaGuard,
+	tag string,
+	group bool,
+	log *zap.Logger,
+) *transferDetector {
+	d := &transferDetector{
+		tag:    tag,
+		group:  group,
+		byID:   make(map[string]*transferAccount),
+		byIBAN: make(map[string]*transferAccount),
+	}
+
+	for _, account := range accounts {
+		if !account.Transactions {
+			continue
+		}
+
+		if _, ok := d.byID[account.NordigenAccountID]; ok {
+			continue
+		}
+
+		key := stateKey(account.NordigenAccountID, account.LunchmoneyAssetID)
+
+		accountState, err := store.Load(ctx, key)
+		if err != nil {
+			log.Warn("failed to load sync state, transfers of the account are not detected",
+				zap.Error(err),
+				zap.String("nordigen_account_id", account.NordigenAccountID),
+			)
+
+			continue
+		}
+
+		saveState := func() error {
+			return store.Save(ctx, key, accountState)
+		}
+
+		details, err := fetchAccountDetails(ctx, account.NordigenAccountID, nordigenClient, accountState, saveState, quota, log)
+		if err != nil {
+			log.Warn("failed to fetch account details, transfers of the account are not detected",
+				zap.Error(err),
+				zap.String("nordigen_account_id", account.NordigenAccountID),
+			)
+
+			continue
+		}
+
+		transferAccount := &transferAccount{
+			config:  account,
+			details: details,
+		}
+
+		d.accounts = append(d.accounts, transferAccount)
+		d.byID[account.NordigenAccountID] = transferAccount
+
+		if iban := normalizeIBAN(details.IBAN); iban != "" {
+			d.byIBAN[iban] = transferAccount
+		}
+	}
+
+	return d
+}
+
+// accountDetails returns the already fetched details of an account, nil is returned if they are unknown.
+func (d *transferDetector) accountDetails(nordigenAccountID string) *nordigen.Account {
+	if d == nil || d.byID[nordigenAccountID] == nil {
+		return nil
+	}
+
+	return d.byID[nordigenAccountID].details
+}
+
+// detect returns the other synced account of a transfer, nil is returned if the transaction is no transfer.
+func (d *transferDetector) detect(trx nordigen.Transaction, nordigenAccountID string) *transferAccount {
+	if d == nil || d.byID[nordigenAccountID] == nil {
+		return nil
+	}
+
+	// the counterparty receives money for expenses and sends it for income
+	counterpartyAccount := trx.DebtorAccount
+	if trx.TransactionAmount.Amount.IsNegative() {
+		counterpartyAccount = trx.CreditorAccount
+	}
+
+	if counterpartyAccount == nil {
+		return nil
+	}
+
+	counterparty := d.byIBAN[normalizeIBAN(counterpartyAccount.IBAN)]
+	if counterparty == nil || counterparty.config.NordigenAccountID == nordigenAccountID {
+		return nil
+	}
+
+	return counterparty
+}
+
+// apply sets the payee, tag and category of a transfer, both halves get the same payee.
+func (d *transferDetector) apply(trx *lunchmoney.Transaction, nordigenAccountID string, counterparty *transferAccount) {
+	from, to := d.byID[nordigenAccountID], counterparty
+	if trx.Amount.IsPositive() {
+		from, to = to, from
+	}
+
+	trx.Payee = fmt.Sprintf("Transfer: %s → %s", from.name(), to.name())
+
+	if d.tag != "" {
+		trx.Tags = append(trx.Tags, d.tag)
+	}
+
+	if d.categoryID > 0 {
+		trx.CategoryID = d.categoryID
+	}
+}
+
+// transferHalf is a transfer waiting to be linked together with the account it belongs to.
+type transferHalf struct {
+	externalID string
+	accountKey string
+	transfer   *state.Transfer
+}
+
+// link groups both halves of transfers which have been inserted into Lunchmoney.
+// Halves without a counterpart are kept until they expire.
+func (d *transferDetector) link(ctx context.Context, lunchmoneyClient lunchmoneyAPI, store state.Store, log *zap.Logger) error {
+	if d == nil || !d.group {
+		return nil
+	}
+
+	states := make(map[string]*state.Account)
+	halves := make(map[string][]*transferHalf) // by Nordigen account ID
+
+	for _, transferAccount := range d.accounts {
+		account := transferAccount.config
+		nordigenAccountID := account.NordigenAccountID
+		key := stateKey(account.NordigenAccountID, account.LunchmoneyAssetID)
+
+		accountState, err := store.Load(ctx, key)
+		if err != nil {
+			return errors.Wrapf(err, "failed to load sync state of account %q", account.name())
+		}
+
+		states[key] = accountState
+
+		for externalID, transfer := range accountState.Transfers {
+			halves[nordigenAccountID] = append(halves[nordigenAccountID], &transferHalf{
+				externalID: externalID,
+				accountKey: key,
+				transfer:   transfer,
+			})
+		}
+
+		// map iteration order is random, link the oldest transfers first
+		sort.Slice(halves[nordigenAccountID], func(i, j int) bool {
+			a, b := halves[nordigenAccountID][i], halves[nordigenAccountID][j]
+			if !a.transfer.Date.Equal(b.transfer.Date) {
+				return a.transfer.Date.Before(b.transfer.Date)
+			}
+
+			return a.externalID < b.externalID
+		})
+	}
+
+	changed := make(map[string]bool)
+
+	for _, transferAccount := range d.accounts {
+		nordigenAccountID := transferAccount.config.NordigenAccountID
+
+		for _, outgoing := range halves[nordigenAccountID] {
+			if !outgoing.transfer.Amount.IsNegative() || states[outgoing.accountKey].Transfers[outgoing.externalID] == nil {
+				continue
+			}
+
+			incoming := matchTransfer(outgoing, nordigenAccountID, halves[outgoing.transfer.Counterparty], states)
+			if incoming == nil {
+				continue
+			}
+
+			groupID, err := lunchmoneyClient.CreateTransactionGroup(ctx, &lunchmoney.TransactionGroup{
+				Date:         lunchmoney.TransactionDate(outgoing.transfer.Date),
+				Payee:        outgoing.transfer.Payee,
+				CategoryID:   d.categoryID,
+				Transactions: []int{outgoing.transfer.LunchmoneyID, incoming.transfer.LunchmoneyID},
+			})
+			if err != nil {
+				return errors.Wrapf(err, "failed to group transfer %q", outgoing.transfer.Payee)
+			}
+
+			log.Info("linked transfer",
+				zap.String("payee", outgoing.transfer.Payee),
+				zap.Stringer("amount", outgoing.transfer.Amount.Neg()),
+				zap.Int("group_id", groupID),
+			)
+
+			delete(states[outgoing.accountKey].Transfers, outgoing.externalID)
+			delete(states[incoming.accountKey].Transfers, incoming.externalID)
+			changed[outgoing.accountKey] = true
+			changed[incoming.accountKey] = true
+		}
+	}
+
+	// forget halves whose counterpart has not shown up in time, e.g. because it was filtered by rules
+	expiry := time.Now().AddDate(0, 0, -transferExpiryDays)
+
+	for key, accountState := range states {
+		for externalID, transfer := range accountState.Transfers {
+			if transfer.Date.Before(expiry) {
+				delete(accountState.Transfers, externalID)
+				changed[key] = true
+			}
+		}
+	}
+
+	for key := range changed {
+		err := store.Save(ctx, key, states[key])
+		if err != nil {
+			return errors.Wrap(err, "failed to save sync state")
+		}
+	}
+
+	return nil
+}
+
+// matchTransfer returns the incoming half of an outgoing transfer with the opposite amount
+// and the closest date, nil is returned if there is none.
+func matchTransfer(
+	outgoing *transferHalf,
+	nordigenAccountID string,
+	candidates []*transferHalf,
+	states map[string]*state.Account,
+) *transferHalf {
+	var best *transferHalf
+	var bestDistance float64
+
+	for _, incoming := range candidates {
+		if states[incoming.accountKey].Transfers[incoming.externalID] == nil {
+			continue // already linked
+		}
+
+		if incoming.transfer.Counterparty != nordigenAccountID ||
+			!strings.EqualFold(incoming.transfer.Currency, outgoing.transfer.Currency) ||
+			!incoming.transfer.Amount.Add(outgoing.transfer.Amount).IsZero() {
+			continue
+		}
+
+		distance := math.Abs(incoming.transfer.Date.Sub(outgoing.transfer.Date).Hours() / 24)
+		if distance > transferMatchDays {
+			continue
+		}
+
+		if best == nil || distance < bestDistance {
+			best, bestDistance = incoming, distance
+		}
+	}
+
+	return best
+}
+
+// normalizeIBAN removes spaces and converts the IBAN to upper case.
+func normalizeIBAN(iban string) string {
+	return strings.ToUpper(strings.ReplaceAll(iban, " ", ""))
+}
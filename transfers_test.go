@@ -0,0 +1,232 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/lunchmoney"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/lunchmoney/lunchmoneytest"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/nordigen/nordigentest"
+	"github.com/Seklfreak/nordigen-lunchmoney-sync/state"
+	"go.uber.org/zap/zaptest"
+)
+
+// savingsAccountID is the second Nordigen account set up by newTransferTest.
+const savingsAccountID = "account-2"
+
+// newTransferTest sets up a transfer from the checking account of the test servers to a savings account
+// and returns a syncer grouping transfers between both.
+func newTransferTest(t *testing.T) (*testServers, *syncer, *lunchmoney.Category) {
+	t.Helper()
+
+	servers := newTestServers(t)
+
+	servers.nordigen.SetAccount(savingsAccountID, &nordigentest.Account{
+		Details: &nordigen.Account{
+			Name:     "Savings",
+			Currency: "EUR",
+			IBAN:     "DE02 1203 0000 0000 2020 51",
+		},
+	})
+
+	savings := servers.lunchmoney.AddAsset(&lunchmoney.Asset{Name: "Savings", TypeName: "cash", Currency: "eur"})
+	category := servers.lunchmoney.AddCategory(&lunchmoney.Category{Name: "Transfers"})
+
+	today := time.Now().UTC()
+
+	servers.nordigen.AddBookedTransactions(testAccountID, &nordigentest.Transaction{
+		TransactionID: "out-1",
+		BookingDate:   today.AddDate(0, 0, -1).Format("2006-01-02"),
+		Amount:        "-100.00",
+		Currency:      "EUR",
+		CreditorName:  "Jane Doe",
+		CreditorIBAN:  "DE02120300000000202051",
+	})
+	servers.nordigen.AddBookedTransactions(savingsAccountID, &nordigentest.Transaction{
+		TransactionID: "in-1",
+		BookingDate:   today.Format("2006-01-02"),
+		Amount:        "100.00",
+		Currency:      "EUR",
+		DebtorName:    "Jane Doe",
+		DebtorIBAN:    "de89370400440532013000",
+	})
+
+	s := newTestSyncer(t, servers,
+		&accountConfig{NordigenAccountID: testAccountID, LunchmoneyAssetID: servers.asset.ID, Transactions: true},
+		&accountConfig{NordigenAccountID: savingsAccountID, LunchmoneyAssetID: savings.ID, Transactions: true},
+	)
+	s.detectTransfers = true
+	s.transfersTag = defaultTransfersTag
+	s.transfersCategory = "transfers"
+	s.transfersGroup = true
+
+	return servers, s, category
+}
+
+func TestTransfers(t *testing.T) {
+	ctx := context.Background()
+	servers, s, category := newTransferTest(t)
+
+	err := s.run(ctx)
+	if err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+
+	transactions := servers.lunchmoney.Transactions()
+	if len(transactions) != 3 {
+		t.Fatalf("expected both halves of the transfer and a group, got %+v", transactions)
+	}
+
+	var group *lunchmoneytest.Transaction
+
+	for _, trx := range transactions {
+		if trx.IsGroup {
+			group = trx
+			continue
+		}
+
+		if trx.Payee != "Transfer: Checking → Savings" || !hasTransferTag(trx.Tags) || trx.CategoryID != category.ID {
+			t.Errorf("expected the payee, tag and category of the transfer, got %+v", trx)
+		}
+	}
+
+	if group == nil {
+		t.Fatal("expected the transfer to be grouped")
+	}
+
+	if group.Payee != "Transfer: Checking → Savings" || group.CategoryID != category.ID || group.Amount != "0.0000" {
+		t.Errorf("unexpected transaction group %+v", group)
+	}
+
+	for _, trx := range transactions {
+		if !trx.IsGroup && trx.GroupID != group.ID {
+			t.Errorf("expected transaction %d to be part of the group, got group %d", trx.ID, trx.GroupID)
+		}
+	}
+
+	// the linked halves are forgotten
+	for _, account := range s.accounts {
+		accountState, err := s.store.Load(ctx, stateKey(account.NordigenAccountID, account.LunchmoneyAssetID))
+		if err != nil {
+			t.Fatalf("failed to load state: %v", err)
+		}
+
+		if len(accountState.Transfers) != 0 {
+			t.Errorf("expected no transfers waiting to be linked for %s, got %+v", account.NordigenAccountID, accountState.Transfers)
+		}
+	}
+
+	// syncing again neither inserts nor groups the transfer again
+	err = s.run(ctx)
+	if err != nil {
+		t.Fatalf("failed to sync: %v", err)
+	}
+
+	if transactions := servers.lunchmoney.Transactions(); len(transactions) != 3 {
+		t.Errorf("expected no further transactions, got %+v", transactions)
+	}
+}
+
+func TestTransfersDryRun(t *testing.T) {
+	ctx := context.Background()
+	servers, s, _ := newTransferTest(t)
+
+	store := s.store
+	report := &dryRunReport{}
+
+	s.lunchmoneyClient = &dryRunClient{Client: servers.lunchmoneyClient, report: report}
+	s.store = &dryRunStore{Store: store}
+	s.dryRun = report
+	s.dryRunFormat = dryRunFormatJSON
+	s.dryRunOutput = io.Discard
+
+	for i := 0; i < 2; i++ {
+		err := s.run(ctx)
+		if err != nil {
+			t.Fatalf("failed to run dry run: %v", err)
+		}
+
+		// every run reports the same changes
+		var actions []string
+		for _, trx := range report.Transactions {
+			actions = append(actions, trx.Action)
+		}
+
+		if len(actions) != 4 || actions[0] != "insert" || actions[1] != "insert" || actions[2] != "group" || actions[3] != "group" {
+			t.Fatalf("expected both halves to be inserted and grouped, got %v", actions)
+		}
+
+		if report.Transactions[0].TransactionID != 0 || report.Transactions[2].Payee != "Transfer: Checking → Savings" {
+			t.Errorf("unexpected report %+v", report.Transactions)
+		}
+	}
+
+	for _, req := range servers.lunchmoney.Requests() {
+		if req.Method != http.MethodGet {
+			t.Errorf("expected no changes to Lunchmoney, got %s %s", req.Method, req.Path)
+		}
+	}
+
+	accountState, err := store.Load(ctx, stateKey(testAccountID, servers.asset.ID))
+	if err != nil {
+		t.Fatalf("failed to load state: %v", err)
+	}
+
+	if accountState.Synced("out-1") || len(accountState.Transfers) != 0 {
+		t.Errorf("expected the state not to be saved, got %+v", accountState)
+	}
+}
+
+func TestTransferDetectorQuota(t *testing.T) {
+	ctx := context.Background()
+	servers, s, _ := newTransferTest(t)
+
+	servers.nordigen.SetQuota(testAccountID, nordigen.EndpointDetails, 4, time.Hour)
+
+	// the details of the savings account cannot be requested anymore
+	savingsKey := stateKey(savingsAccountID, s.accounts[1].LunchmoneyAssetID)
+
+	savingsState := state.NewAccount()
+	savingsState.SetRateLimit(nordigen.EndpointDetails, &state.RateLimit{Remaining: 0, Reset: time.Now().Add(time.Hour)})
+
+	err := s.store.Save(ctx, savingsKey, savingsState)
+	if err != nil {
+		t.Fatalf("failed to save state: %v", err)
+	}
+
+	transfers := newTransferDetector(ctx, s.accounts, s.nordigenClient, s.store, s.quota, defaultTransfersTag, true, zaptest.NewLogger(t))
+
+	if transfers.accountDetails(testAccountID) == nil || transfers.accountDetails(savingsAccountID) != nil {
+		t.Errorf("expected only the details of the checking account, got %+v", transfers.accounts)
+	}
+
+	for _, req := range servers.nordigen.Requests() {
+		if req.Path == "/accounts/"+savingsAccountID+"/details/" {
+			t.Error("expected the details of the savings account not to be requested")
+		}
+	}
+
+	// the reported rate limit is remembered
+	checkingState, err := s.store.Load(ctx, stateKey(testAccountID, servers.asset.ID))
+	if err != nil {
+		t.Fatalf("failed to load state: %v", err)
+	}
+
+	if rateLimit := checkingState.RateLimits[nordigen.EndpointDetails]; rateLimit == nil || rateLimit.Remaining != 3 {
+		t.Errorf("expected the rate limit of the details to be saved, got %+v", rateLimit)
+	}
+}
+
+func hasTransferTag(tags []string) bool {
+	for _, tag := range tags {
+		if tag == defaultTransfersTag {
+			return true
+		}
+	}
+
+	return false
+}